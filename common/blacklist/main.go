@@ -2,28 +2,75 @@ package blacklist
 
 import (
 	"fmt"
-	"sync"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-var blackList sync.Map
+// IpBan is a banned subnet, ExpiredTime -1 means the ban never expires
+type IpBan struct {
+	Net         *net.IPNet
+	ExpiredTime int64
+}
 
-func init() {
-	blackList = sync.Map{}
+type snapshot struct {
+	users map[int]int64 // user id to expired time
+	ips   []IpBan
 }
 
-func userId2Key(id int) string {
-	return fmt.Sprintf("userid_%d", id)
+// the ban list is replaced as a whole whenever it is reloaded from the database,
+// so readers never need a lock
+var current atomic.Pointer[snapshot]
+
+func init() {
+	current.Store(&snapshot{users: map[int]int64{}})
 }
 
-func BanUser(id int) {
-	blackList.Store(userId2Key(id), true)
+// Replace swaps the whole ban list of this node
+func Replace(users map[int]int64, ips []IpBan) {
+	current.Store(&snapshot{users: users, ips: ips})
 }
 
-func UnbanUser(id int) {
-	blackList.Delete(userId2Key(id))
+func isActive(expiredTime int64, now int64) bool {
+	return expiredTime == -1 || expiredTime > now
 }
 
 func IsUserBanned(id int) bool {
-	_, ok := blackList.Load(userId2Key(id))
-	return ok
+	expiredTime, ok := current.Load().users[id]
+	return ok && isActive(expiredTime, time.Now().Unix())
+}
+
+func IsIpBanned(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	now := time.Now().Unix()
+	for _, ban := range current.Load().ips {
+		if isActive(ban.ExpiredTime, now) && ban.Net.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeCidr accepts an IP or a CIDR and returns it in CIDR notation
+func NormalizeCidr(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return "", fmt.Errorf("invalid ip: %s", s)
+		}
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return "", err
+	}
+	return ipNet.String(), nil
 }
@@ -0,0 +1,37 @@
+package blacklist
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBanList(t *testing.T) {
+	Convey("ban list", t, func() {
+		cidr, err := NormalizeCidr("10.1.2.3")
+		So(err, ShouldBeNil)
+		So(cidr, ShouldEqual, "10.1.2.3/32")
+		cidr, err = NormalizeCidr("192.168.1.7/24")
+		So(err, ShouldBeNil)
+		So(cidr, ShouldEqual, "192.168.1.0/24")
+		_, err = NormalizeCidr("not an ip")
+		So(err, ShouldNotBeNil)
+
+		_, subnet, _ := net.ParseCIDR(cidr)
+		_, expiredNet, _ := net.ParseCIDR("172.16.0.0/16")
+		now := time.Now().Unix()
+		Replace(map[int]int64{1: -1, 2: now - 1, 3: now + 60}, []IpBan{
+			{Net: subnet, ExpiredTime: -1},
+			{Net: expiredNet, ExpiredTime: now - 1},
+		})
+		So(IsUserBanned(1), ShouldBeTrue)
+		So(IsUserBanned(2), ShouldBeFalse)
+		So(IsUserBanned(3), ShouldBeTrue)
+		So(IsUserBanned(4), ShouldBeFalse)
+		So(IsIpBanned("192.168.1.200"), ShouldBeTrue)
+		So(IsIpBanned("172.16.3.4"), ShouldBeFalse)
+		So(IsIpBanned("8.8.8.8"), ShouldBeFalse)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"net/http"
 	"net/url"
 	"time"
@@ -41,6 +42,8 @@ func Init() {
 			Proxy: http.ProxyURL(proxyURL),
 		}
 	}
+	// upstream calls get a client span and the traceparent header
+	transport = &tracing.Transport{Base: transport}
 
 	if config.RelayTimeout == 0 {
 		HTTPClient = &http.Client{
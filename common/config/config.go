@@ -7,8 +7,6 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 var SystemName = "One API"
@@ -23,7 +21,11 @@ var DisplayTokenStatEnabled = true
 
 // Any options with "Secret", "Token" in its key won't be return by GetOptions
 
-var SessionSecret = uuid.New().String()
+// SessionSecret is set by SESSION_SECRET, otherwise it's generated once and kept in the options table
+var SessionSecret = ""
+
+// TokenKeySecret is used for hashing token keys, changing it invalidates all tokens
+var TokenKeySecret = os.Getenv("TOKEN_KEY_SECRET")
 
 var OptionMap map[string]string
 var OptionMapRWMutex sync.RWMutex
@@ -36,6 +38,8 @@ var PasswordRegisterEnabled = true
 var EmailVerificationEnabled = false
 var GitHubOAuthEnabled = false
 var WeChatAuthEnabled = false
+var OidcEnabled = false
+var AdminTwoFactorEnabled = false // admins and root must use two-factor authentication to log in
 var TurnstileCheckEnabled = false
 var RegisterEnabled = true
 
@@ -53,6 +57,13 @@ var EmailDomainWhitelist = []string{
 }
 
 var DebugEnabled = strings.ToLower(os.Getenv("DEBUG")) == "true"
+
+// LogLevel is one of debug, info, warn and error, it can be changed at runtime
+var LogLevel = env.String("LOG_LEVEL", "info")
+
+// LogFormat is either text or json
+var LogFormat = env.String("LOG_FORMAT", "text")
+
 var DebugSQLEnabled = strings.ToLower(os.Getenv("DEBUG_SQL")) == "true"
 var MemoryCacheEnabled = strings.ToLower(os.Getenv("MEMORY_CACHE_ENABLED")) == "true"
 
@@ -70,6 +81,17 @@ var GitHubClientSecret = ""
 var LarkClientId = ""
 var LarkClientSecret = ""
 
+var OidcIssuer = ""
+var OidcClientId = ""
+var OidcClientSecret = ""
+var OidcScopes = "openid profile email"
+var OidcUsernameClaim = "preferred_username"
+var OidcEmailClaim = "email"
+var OidcDisplayNameClaim = "name"
+var OidcGroupClaim = ""   // empty means the group is not taken from the IdP
+var OidcGroupMapping = "" // JSON map from IdP group to one api group
+var OidcDefaultGroup = "default"
+
 var WeChatServerAddress = ""
 var WeChatServerToken = ""
 var WeChatAccountQRCodeImageURL = ""
@@ -90,6 +112,13 @@ var QuotaRemindThreshold int64 = 1000
 var PreConsumedQuota int64 = 500
 var ApproximateTokenEnabled = false
 var RetryTimes = 0
+var TokenRotationGracePeriod int64 = 24 * 60 * 60    // unit is second, the old key keeps working this long after a rotation
+var SessionIdleTimeout int64 = 7 * 24 * 60 * 60      // unit is second, 0 means no timeout
+var SessionAbsoluteTimeout int64 = 30 * 24 * 60 * 60 // unit is second, 0 means no timeout
+var LoginLockoutThreshold = 10                       // failed logins before the account is locked, 0 means never
+var LoginLockoutDuration int64 = 15 * 60             // unit is second
+var PasswordMinLength = 8
+var BreachedPasswordFile = os.Getenv("BREACHED_PASSWORD_FILE") // one password per line
 
 var RootUserEmail = ""
 
@@ -141,6 +170,33 @@ var MetricSuccessRateThreshold = env.Float64("METRIC_SUCCESS_RATE_THRESHOLD", 0.
 var MetricSuccessChanSize = env.Int("METRIC_SUCCESS_CHAN_SIZE", 1024)
 var MetricFailChanSize = env.Int("METRIC_FAIL_CHAN_SIZE", 128)
 
+// /metrics is served on MetricsAddress if set, otherwise on the main port when MetricsToken is set
+var MetricsToken = os.Getenv("METRICS_TOKEN")
+var MetricsAddress = os.Getenv("METRICS_ADDRESS")
+
+// OpenTelemetry tracing, disabled unless an OTLP endpoint is set, the exporter reads the other OTEL_EXPORTER_OTLP_* variables itself
+var OtlpEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+var OtlpTracesEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+var TracingServiceName = env.String("OTEL_SERVICE_NAME", "one-api")
+var TracingSampleRatio = env.Float64("OTEL_TRACES_SAMPLER_ARG", 1)
+
+// payload capture for debugging, ids are comma separated
+var CaptureTokenIds = ""
+var CaptureChannelIds = ""
+var CaptureMaxBodySize = 64 * 1024 // bytes kept of each body
+var CaptureRetentionHours = 24
+var CaptureRedactKeys = "api_key,apikey,password,secret,authorization,access_token,refresh_token,email,phone"
+var CaptureRedactPatterns = `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}` // one regular expression per line
+
+// days to keep each type of log, 0 keeps them forever, expired logs are rolled up per day before deletion
+var LogRetentionDaysTopup = 0
+var LogRetentionDaysConsume = 0
+var LogRetentionDaysManage = 0
+var LogRetentionDaysSystem = 0
+
+// deleted logs are archived as gzipped JSON lines here if set
+var LogArchiveDir = os.Getenv("LOG_ARCHIVE_DIR")
+
 var InitialRootToken = os.Getenv("INITIAL_ROOT_TOKEN")
 
 var GeminiVersion = env.String("GEMINI_VERSION", "v1")
@@ -19,4 +19,8 @@ const (
 	TokenName         = "token_name"
 	BaseURL           = "base_url"
 	AvailableModels   = "available_models"
+	ResponseText      = "response_text"
+	ManagementTokenId = "management_token_id"
+	OrgId             = "org_id"
+	SessionId         = "session_id"
 )
@@ -51,3 +51,23 @@ func SetEventStreamHeaders(c *gin.Context) {
 	c.Writer.Header().Set("Transfer-Encoding", "chunked")
 	c.Writer.Header().Set("X-Accel-Buffering", "no")
 }
+
+// IsClientGone reports whether the client has disconnected, net/http cancels
+// the request context once the connection is closed
+func IsClientGone(c *gin.Context) bool {
+	return c.Request.Context().Err() != nil
+}
+
+// DrainStream keeps receiving from the channels of a stream handler after the client is gone,
+// so the goroutine reading the upstream body can exit instead of blocking forever
+func DrainStream[T any](dataChan chan T, stopChan chan bool) {
+	go func() {
+		for {
+			select {
+			case <-dataChan:
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
@@ -5,6 +5,13 @@ import (
 	"time"
 )
 
+const (
+	PeriodHourly  = "hourly"
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+)
+
 func GetTimestamp() int64 {
 	return time.Now().Unix()
 }
@@ -13,3 +20,47 @@ func GetTimeString() string {
 	now := time.Now()
 	return fmt.Sprintf("%s%d", now.Format("20060102150405"), now.UnixNano()%1e9)
 }
+
+func IsValidPeriod(period string) bool {
+	switch period {
+	case PeriodHourly, PeriodDaily, PeriodWeekly, PeriodMonthly:
+		return true
+	}
+	return false
+}
+
+// GetPeriodStart returns the beginning of the calendar period that t falls into,
+// weeks start on Monday and the location of t is respected
+func GetPeriodStart(period string, t time.Time) (time.Time, error) {
+	year, month, day := t.Date()
+	switch period {
+	case PeriodHourly:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location()), nil
+	case PeriodDaily:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location()), nil
+	case PeriodWeekly:
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location()), nil
+	case PeriodMonthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location()), nil
+	}
+	return t, fmt.Errorf("unknown period: %s", period)
+}
+
+// GetNextPeriodStart returns the beginning of the period after the one t falls into
+func GetNextPeriodStart(period string, t time.Time) (time.Time, error) {
+	start, err := GetPeriodStart(period, t)
+	if err != nil {
+		return t, err
+	}
+	switch period {
+	case PeriodHourly:
+		return start.Add(time.Hour), nil
+	case PeriodDaily:
+		return start.AddDate(0, 0, 1), nil
+	case PeriodWeekly:
+		return start.AddDate(0, 0, 7), nil
+	default:
+		return start.AddDate(0, 1, 0), nil
+	}
+}
@@ -0,0 +1,32 @@
+package helper
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetPeriodStart(t *testing.T) {
+	// 2024-05-15 is a Wednesday
+	now := time.Date(2024, 5, 15, 13, 45, 10, 0, time.UTC)
+	Convey("GetPeriodStart", t, func() {
+		start, err := GetPeriodStart(PeriodHourly, now)
+		So(err, ShouldBeNil)
+		So(start, ShouldEqual, time.Date(2024, 5, 15, 13, 0, 0, 0, time.UTC))
+		start, _ = GetPeriodStart(PeriodDaily, now)
+		So(start, ShouldEqual, time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC))
+		start, _ = GetPeriodStart(PeriodWeekly, now)
+		So(start, ShouldEqual, time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC))
+		start, _ = GetPeriodStart(PeriodMonthly, now)
+		So(start, ShouldEqual, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+		_, err = GetPeriodStart("yearly", now)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("GetNextPeriodStart", t, func() {
+		next, _ := GetNextPeriodStart(PeriodWeekly, now)
+		So(next, ShouldEqual, time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC))
+		next, _ = GetNextPeriodStart(PeriodMonthly, time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC))
+		So(next, ShouldEqual, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	})
+}
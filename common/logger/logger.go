@@ -1,13 +1,17 @@
 package logger
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,8 +24,69 @@ const (
 	loggerINFO  = "INFO"
 	loggerWarn  = "WARN"
 	loggerError = "ERR"
+	loggerFatal = "FATAL"
 )
 
+const (
+	levelDebug int32 = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levels = map[string]int32{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+var levelOfTag = map[string]int32{
+	loggerDEBUG: levelDebug,
+	loggerINFO:  levelInfo,
+	loggerWarn:  levelWarn,
+	loggerError: levelError,
+	loggerFatal: levelError,
+}
+
+var jsonLevelNames = map[string]string{
+	loggerDEBUG: "debug",
+	loggerINFO:  "info",
+	loggerWarn:  "warn",
+	loggerError: "error",
+	loggerFatal: "fatal",
+}
+
+var currentLevel atomic.Int32
+
+func init() {
+	if err := SetLevel(config.LogLevel); err != nil {
+		currentLevel.Store(levelInfo)
+	}
+	if config.DebugEnabled {
+		currentLevel.Store(levelDebug)
+	}
+}
+
+func ValidLevel(level string) bool {
+	_, ok := levels[strings.ToLower(level)]
+	return ok
+}
+
+// SetLevel changes the minimum level of the lines written, it takes effect immediately
+func SetLevel(level string) error {
+	value, ok := levels[strings.ToLower(level)]
+	if !ok {
+		return fmt.Errorf("unknown log level: %s", level)
+	}
+	currentLevel.Store(value)
+	return nil
+}
+
+func enabled(level string) bool {
+	return levelOfTag[level] >= currentLevel.Load()
+}
+
 var setupLogOnce sync.Once
 
 func SetupLogger() {
@@ -38,9 +103,102 @@ func SetupLogger() {
 	})
 }
 
+type fieldsKey struct{}
+
+type field struct {
+	key   string
+	value any
+}
+
+// WithFields returns a context whose log lines carry the given key value pairs, later values replace earlier ones
+func WithFields(ctx context.Context, keysAndValues ...any) context.Context {
+	parent, _ := ctx.Value(fieldsKey{}).([]field)
+	fields := make([]field, len(parent), len(parent)+len(keysAndValues)/2)
+	copy(fields, parent)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		value := keysAndValues[i+1]
+		replaced := false
+		for j := range fields {
+			if fields[j].key == key {
+				fields[j].value = value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			fields = append(fields, field{key: key, value: value})
+		}
+	}
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// format renders a line as text or json according to config.LogFormat, an empty id marks a system line
+func format(level string, id string, msg string, fields []field) []byte {
+	msg = Redact(msg)
+	now := time.Now()
+	var buf bytes.Buffer
+	if strings.ToLower(config.LogFormat) == "json" {
+		buf.WriteString(`{"time":`)
+		writeJSON(&buf, now.Format(time.RFC3339Nano))
+		buf.WriteString(`,"level":`)
+		writeJSON(&buf, jsonLevelNames[level])
+		if id == "" {
+			buf.WriteString(`,"logger":"sys"`)
+		} else {
+			buf.WriteString(`,"request_id":`)
+			writeJSON(&buf, id)
+		}
+		buf.WriteString(`,"msg":`)
+		writeJSON(&buf, msg)
+		for _, f := range fields {
+			buf.WriteByte(',')
+			writeJSON(&buf, f.key)
+			buf.WriteByte(':')
+			writeJSON(&buf, redactValue(f.value))
+		}
+		buf.WriteString("}\n")
+		return buf.Bytes()
+	}
+	tag := level
+	if id == "" && level != loggerFatal {
+		tag = "SYS"
+	}
+	_, _ = fmt.Fprintf(&buf, "[%s] %v | ", tag, now.Format("2006/01/02 - 15:04:05"))
+	if id != "" {
+		buf.WriteString(id + " | ")
+	}
+	buf.WriteString(msg)
+	if len(fields) > 0 {
+		buf.WriteString(" |")
+		for _, f := range fields {
+			_, _ = fmt.Fprintf(&buf, " %s=%v", f.key, redactValue(f.value))
+		}
+	}
+	buf.WriteString(" \n")
+	return buf.Bytes()
+}
+
+func writeJSON(buf *bytes.Buffer, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(data)
+}
+
+func redactValue(v any) any {
+	if s, ok := v.(string); ok {
+		return Redact(s)
+	}
+	return v
+}
+
 func SysLog(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	if !enabled(loggerINFO) {
+		return
+	}
+	_, _ = gin.DefaultWriter.Write(format(loggerINFO, "", s, nil))
 }
 
 func SysLogf(format string, a ...any) {
@@ -48,8 +206,7 @@ func SysLogf(format string, a ...any) {
 }
 
 func SysError(s string) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[SYS] %v | %s \n", t.Format("2006/01/02 - 15:04:05"), s)
+	_, _ = gin.DefaultErrorWriter.Write(format(loggerError, "", s, nil))
 }
 
 func SysErrorf(format string, a ...any) {
@@ -57,9 +214,7 @@ func SysErrorf(format string, a ...any) {
 }
 
 func Debug(ctx context.Context, msg string) {
-	if config.DebugEnabled {
-		logHelper(ctx, loggerDEBUG, msg)
-	}
+	logHelper(ctx, loggerDEBUG, msg)
 }
 
 func Info(ctx context.Context, msg string) {
@@ -75,6 +230,9 @@ func Error(ctx context.Context, msg string) {
 }
 
 func Debugf(ctx context.Context, format string, a ...any) {
+	if !enabled(loggerDEBUG) {
+		return
+	}
 	Debug(ctx, fmt.Sprintf(format, a...))
 }
 
@@ -91,21 +249,23 @@ func Errorf(ctx context.Context, format string, a ...any) {
 }
 
 func logHelper(ctx context.Context, level string, msg string) {
+	if !enabled(level) {
+		return
+	}
 	writer := gin.DefaultErrorWriter
 	if level == loggerINFO {
 		writer = gin.DefaultWriter
 	}
-	id := ctx.Value(helper.RequestIdKey)
-	if id == nil {
+	id, _ := ctx.Value(helper.RequestIdKey).(string)
+	if id == "" {
 		id = helper.GenRequestID()
 	}
-	now := time.Now()
-	_, _ = fmt.Fprintf(writer, "[%s] %v | %s | %s \n", level, now.Format("2006/01/02 - 15:04:05"), id, msg)
+	fields, _ := ctx.Value(fieldsKey{}).([]field)
+	_, _ = writer.Write(format(level, id, msg, fields))
 	SetupLogger()
 }
 
 func FatalLog(v ...any) {
-	t := time.Now()
-	_, _ = fmt.Fprintf(gin.DefaultErrorWriter, "[FATAL] %v | %v \n", t.Format("2006/01/02 - 15:04:05"), v)
+	_, _ = gin.DefaultErrorWriter.Write(format(loggerFatal, "", fmt.Sprint(v...), nil))
 	os.Exit(1)
 }
@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+)
+
+var redactPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// values of sensitive keys in json, headers, query strings and key=value pairs
+	{regexp.MustCompile(`(?i)((?:api[_-]?key|password|passwd|secret|authorization|x-lobe-chat-auth|access[_-]?token|refresh[_-]?token)["']?\s*[:=]\s*\[?["']?(?:bearer\s+)?)[^"'\s,;&}\]]+`), "${1}***"},
+	{regexp.MustCompile(`(?i)(bearer\s+)[a-z0-9\-._~+/]+=*`), "${1}***"},
+	{regexp.MustCompile(`sk-[A-Za-z0-9]{16,}`), "sk-***"},
+}
+
+// Redact masks api keys, passwords and authorization headers in s
+func Redact(s string) string {
+	for _, p := range redactPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// PayloadRedactor masks the values of the given json keys and everything matching the given patterns,
+// it works on truncated bodies and event streams as well since it does not parse the json
+type PayloadRedactor struct {
+	keys     *regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+func NewPayloadRedactor(keys []string, patterns []string) (*PayloadRedactor, error) {
+	r := &PayloadRedactor{}
+	quoted := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			quoted = append(quoted, regexp.QuoteMeta(key))
+		}
+	}
+	if len(quoted) > 0 {
+		r.keys = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, compiled)
+	}
+	return r, nil
+}
+
+func (r *PayloadRedactor) Redact(s string) string {
+	if r.keys != nil {
+		s = r.keys.ReplaceAllString(s, `${1}"***"`)
+	}
+	for _, pattern := range r.patterns {
+		s = pattern.ReplaceAllString(s, "***")
+	}
+	return Redact(s)
+}
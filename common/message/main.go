@@ -9,6 +9,7 @@ const (
 	ByAll           = "all"
 	ByEmail         = "email"
 	ByMessagePusher = "message_pusher"
+	ByWebhook       = "webhook"
 )
 
 func Notify(by string, title string, description string, content string) error {
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+
+// Registry holds the metrics served by Handler, it is not the default registry,
+// so that dependencies can't add metrics of their own
+var Registry = prometheus.NewRegistry()
+
+var (
+	RelayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_relay_requests_total",
+		Help: "Relay requests by model, channel, group and HTTP status.",
+	}, []string{"model", "channel", "group", "status"})
+	RelayRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "one_api_relay_request_duration_seconds",
+		Help:    "Time spent on relay requests.",
+		Buckets: latencyBuckets,
+	}, []string{"model", "channel", "group"})
+	RelayFirstTokenDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "one_api_relay_first_token_seconds",
+		Help:    "Time to the first byte of streamed responses.",
+		Buckets: latencyBuckets,
+	}, []string{"model", "channel", "group"})
+	RelayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_relay_retries_total",
+		Help: "Relay requests retried on another channel.",
+	}, []string{"model", "group"})
+	RelayTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_relay_tokens_total",
+		Help: "Tokens billed, by model, channel and type (prompt or completion).",
+	}, []string{"model", "channel", "type"})
+	QuotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_quota_consumed_total",
+		Help: "Quota consumed by model and channel.",
+	}, []string{"model", "channel"})
+	ChannelStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "one_api_channel_status",
+		Help: "Status of the channel, 1 enabled, 2 manually disabled, 3 auto disabled.",
+	}, []string{"channel", "name", "type"})
+	ChannelSuccessRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "one_api_channel_success_rate",
+		Help: "Recent success rate of the channel, only tracked when ENABLE_METRIC is set.",
+	}, []string{"channel"})
+	DBPingDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "one_api_db_ping_seconds",
+		Help: "Latency of pinging the database at scrape time.",
+	}, []string{"db"})
+	RedisPingDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "one_api_redis_ping_seconds",
+		Help: "Latency of pinging Redis at scrape time.",
+	})
+)
+
+var (
+	scrapeHooksMutex sync.Mutex
+	scrapeHooks      []func()
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RelayRequests,
+		RelayRequestDuration,
+		RelayFirstTokenDuration,
+		RelayRetries,
+		RelayTokens,
+		QuotaConsumed,
+		ChannelStatus,
+		ChannelSuccessRate,
+		DBPingDuration,
+		RedisPingDuration,
+	)
+}
+
+// OnScrape registers a function run before every scrape, e.g. to refresh gauges
+func OnScrape(hook func()) {
+	scrapeHooksMutex.Lock()
+	defer scrapeHooksMutex.Unlock()
+	scrapeHooks = append(scrapeHooks, hook)
+}
+
+func gather() ([]*dto.MetricFamily, error) {
+	scrapeHooksMutex.Lock()
+	hooks := append([]func(){}, scrapeHooks...)
+	scrapeHooksMutex.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+	return Registry.Gather()
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.GathererFunc(gather), promhttp.HandlerOpts{})
+}
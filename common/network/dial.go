@@ -0,0 +1,79 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// special purpose ranges the net.IP predicates don't cover
+var nonPublicSubnets = func() []*net.IPNet {
+	var subnets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10", // carrier-grade nat, some clouds serve their metadata here
+		"192.0.0.0/24",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"64:ff9b::/96", // nat64 can reach any ipv4 address
+	} {
+		_, subnet, _ := net.ParseCIDR(cidr)
+		subnets = append(subnets, subnet)
+	}
+	return subnets
+}()
+
+// IsPublicIp reports whether ip is a global unicast address. Loopback, private and link-local
+// addresses, which include the cloud metadata endpoints, are not public.
+func IsPublicIp(ip net.IP) bool {
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, subnet := range nonPublicSubnets {
+		if subnet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// LookupPublicIps resolves host, it fails if any of the addresses is not public
+func LookupPublicIps(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if !IsPublicIp(ip) {
+			return nil, fmt.Errorf("%s resolves to non-public address %s", host, ip.String())
+		}
+	}
+	return ips, nil
+}
+
+var publicDialer = &net.Dialer{
+	Timeout:   10 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+// PublicDialContext only connects to public addresses. The checked address is the one dialed,
+// so a host can't be rebound to an internal address between the check and the connection.
+func PublicDialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := LookupPublicIps(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	for _, ip := range ips {
+		conn, err = publicDialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
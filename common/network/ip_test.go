@@ -2,6 +2,7 @@ package network
 
 import (
 	"context"
+	"net"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -17,3 +18,21 @@ func TestIsIpInSubnet(t *testing.T) {
 		So(isIpInSubnet(ctx, ip2, subnet), ShouldBeFalse)
 	})
 }
+
+func TestIsPublicIp(t *testing.T) {
+	Convey("TestIsPublicIp", t, func() {
+		for _, ip := range []string{"8.8.8.8", "125.216.250.89", "2001:4860:4860::8888"} {
+			So(IsPublicIp(net.ParseIP(ip)), ShouldBeTrue)
+		}
+		for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.0.5", "169.254.169.254",
+			"100.100.100.200", "0.0.0.0", "::1", "fd00:ec2::254", "fe80::1", "::ffff:127.0.0.1"} {
+			So(IsPublicIp(net.ParseIP(ip)), ShouldBeFalse)
+		}
+	})
+	Convey("PublicDialContext", t, func() {
+		_, err := PublicDialContext(context.Background(), "tcp", "127.0.0.1:80")
+		So(err, ShouldNotBeNil)
+		_, err = PublicDialContext(context.Background(), "tcp", "localhost:80")
+		So(err, ShouldNotBeNil)
+	})
+}
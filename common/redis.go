@@ -67,3 +67,8 @@ func RedisDecrease(key string, value int64) error {
 	ctx := context.Background()
 	return RDB.DecrBy(ctx, key, value).Err()
 }
+
+func RedisIncrease(key string, value int64) error {
+	ctx := context.Background()
+	return RDB.IncrBy(ctx, key, value).Err()
+}
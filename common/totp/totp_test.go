@@ -0,0 +1,30 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidate(t *testing.T) {
+	// test vectors of RFC 6238 appendix B, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	Convey("Validate", t, func() {
+		step, ok := Validate(secret, "287082", time.Unix(59, 0))
+		So(ok, ShouldBeTrue)
+		So(step, ShouldEqual, 1)
+		_, ok = Validate(secret, "081804", time.Unix(1111111109, 0))
+		So(ok, ShouldBeTrue)
+		_, ok = Validate(secret, "005924", time.Unix(1234567890, 0))
+		So(ok, ShouldBeTrue)
+		// the previous period is still accepted
+		_, ok = Validate(secret, "005924", time.Unix(1234567890+Period, 0))
+		So(ok, ShouldBeTrue)
+		_, ok = Validate(secret, "005924", time.Unix(1234567890+3*Period, 0))
+		So(ok, ShouldBeFalse)
+		_, ok = Validate(secret, "00592", time.Unix(1234567890, 0))
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+var enabled bool
+
+func setTracerProvider(provider *sdktrace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	enabled = true
+}
+
+// Init enables tracing if an OTLP endpoint is configured. The exporter reads the endpoint
+// and the headers from the standard OTEL_EXPORTER_OTLP_* variables itself.
+func Init() {
+	if config.OtlpEndpoint == "" && config.OtlpTracesEndpoint == "" {
+		return
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		logger.SysError("failed to create the span exporter, tracing disabled: " + err.Error())
+		return
+	}
+	// the exporter's own requests don't go through the relay client, so they aren't traced
+	setTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TracingSampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.TracingServiceName))),
+	))
+	logger.SysLog("tracing enabled, exporting spans over OTLP")
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans are recorded with the OpenTelemetry SDK once Init found an OTLP endpoint,
+// until then the global tracer provider and propagator of otel are no-ops.
+
+const instrumentationName = "github.com/songquanpeng/one-api"
+
+var (
+	String = attribute.String
+	Int    = attribute.Int
+	Bool   = attribute.Bool
+)
+
+func start(ctx context.Context, name string, kind trace.SpanKind, attributes []attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+// Start starts a span as child of the span in ctx, the returned context carries the new span
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return start(ctx, name, trace.SpanKindInternal, attributes)
+}
+
+// StartServer starts the span of a request served by one-api
+func StartServer(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return start(ctx, name, trace.SpanKindServer, attributes)
+}
+
+// TraceIdFromContext returns the hex trace id, empty if there is no trace
+func TraceIdFromContext(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// Extract continues the trace of the caller given by the W3C traceparent header
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject sets the W3C traceparent header for the span in ctx
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
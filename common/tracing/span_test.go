@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	setTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	Convey("child spans continue the incoming trace", t, func() {
+		incoming := http.Header{}
+		incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		ctx, span := Start(Extract(context.Background(), incoming), "test")
+		So(TraceIdFromContext(ctx), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+		outgoing := http.Header{}
+		Inject(ctx, outgoing)
+		So(outgoing.Get("traceparent"), ShouldEqual, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext().SpanID().String()+"-01")
+		span.End()
+		ended := recorder.Ended()
+		So(ended, ShouldHaveLength, 1)
+		So(ended[0].Parent().SpanID().String(), ShouldEqual, "00f067aa0ba902b7")
+	})
+	Convey("unsampled traces are propagated but not recorded", t, func() {
+		incoming := http.Header{}
+		incoming.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		ctx, span := Start(Extract(context.Background(), incoming), "unsampled")
+		So(span.IsRecording(), ShouldBeFalse)
+		So(TraceIdFromContext(ctx), ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+	})
+}
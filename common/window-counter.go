@@ -0,0 +1,199 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Window counters approximate a rolling window with two fixed buckets: the value of
+// the previous bucket is weighted by how much of it still overlaps the rolling window.
+// Counters live in Redis when it is enabled, so all nodes share them, otherwise in memory.
+
+type windowBucket struct {
+	window   time.Duration
+	index    int64
+	current  int64
+	previous int64
+}
+
+// buckets of keys which haven't been used for a whole window are swept this often
+const windowCounterSweepInterval = 10 * time.Minute
+
+type inMemoryWindowCounter struct {
+	store     map[string]*windowBucket
+	mutex     sync.Mutex
+	lastSweep time.Time
+}
+
+var memoryWindowCounter = inMemoryWindowCounter{store: make(map[string]*windowBucket)}
+
+func bucketIndex(window time.Duration, now time.Time) int64 {
+	return now.Unix() / int64(window.Seconds())
+}
+
+func estimate(window time.Duration, index int64, current int64, previous int64, now time.Time) int64 {
+	start := index * int64(window.Seconds())
+	elapsed := float64(now.Unix()-start) / window.Seconds()
+	if elapsed > 1 {
+		elapsed = 1
+	}
+	return current + int64(float64(previous)*(1-elapsed))
+}
+
+// belowLimitAt returns when the estimate drops below limit if nothing more is added,
+// the weight of the previous bucket only reaches 0 at the end of the current bucket
+func belowLimitAt(window time.Duration, index int64, current int64, previous int64, limit int64, now time.Time) time.Time {
+	seconds := window.Seconds()
+	start := float64(index) * seconds
+	var at float64
+	switch {
+	case limit <= 0:
+		// nothing to wait for, both buckets are out of the window by then
+		at = start + 2*seconds
+	case current+previous < limit || estimate(window, index, current, previous, now) < limit:
+		return now
+	case current < limit:
+		// current + previous * (1 - elapsed) < limit
+		at = start + seconds*(1-float64(limit-current)/float64(previous))
+	default:
+		// in the next bucket the current one becomes the previous one: current * (1 - elapsed) < limit
+		at = start + seconds + seconds*(1-float64(limit)/float64(current))
+	}
+	// the estimate is truncated at whole seconds, so the next second is the first one below the limit
+	resetAt := time.Unix(int64(math.Floor(at))+1, 0)
+	if resetAt.Before(now) {
+		return now
+	}
+	return resetAt
+}
+
+func (l *inMemoryWindowCounter) roll(key string, window time.Duration, now time.Time) *windowBucket {
+	index := bucketIndex(window, now)
+	bucket, ok := l.store[key]
+	if !ok {
+		bucket = &windowBucket{window: window, index: index}
+		l.store[key] = bucket
+	}
+	switch {
+	case bucket.index == index-1:
+		bucket.previous = bucket.current
+		bucket.current = 0
+	case bucket.index < index-1:
+		bucket.previous = 0
+		bucket.current = 0
+	}
+	bucket.index = index
+	return bucket
+}
+
+// sweep drops the buckets which no longer count toward their window
+func (l *inMemoryWindowCounter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < windowCounterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, bucket := range l.store {
+		if bucket.index < bucketIndex(bucket.window, now)-1 {
+			delete(l.store, key)
+		}
+	}
+}
+
+func (l *inMemoryWindowCounter) add(key string, window time.Duration, delta int64, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sweep(now)
+	l.roll(key, window, now).current += delta
+}
+
+func (l *inMemoryWindowCounter) increase(key string, window time.Duration, delta int64, limit int64, now time.Time) (int64, time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sweep(now)
+	bucket := l.roll(key, window, now)
+	bucket.current += delta
+	return estimate(window, bucket.index, bucket.current, bucket.previous, now),
+		belowLimitAt(window, bucket.index, bucket.current, bucket.previous, limit+delta, now)
+}
+
+func (l *inMemoryWindowCounter) get(key string, window time.Duration, limit int64, now time.Time) (int64, time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	bucket := l.roll(key, window, now)
+	return estimate(window, bucket.index, bucket.current, bucket.previous, now),
+		belowLimitAt(window, bucket.index, bucket.current, bucket.previous, limit, now)
+}
+
+func redisBucketKey(key string, index int64) string {
+	return fmt.Sprintf("window:%s:%d", key, index)
+}
+
+// WindowCounterAdd adds delta (which can be negative) to the rolling window counter
+func WindowCounterAdd(key string, window time.Duration, delta int64) error {
+	now := time.Now()
+	if !RedisEnabled {
+		memoryWindowCounter.add(key, window, delta, now)
+		return nil
+	}
+	ctx := context.Background()
+	bucketKey := redisBucketKey(key, bucketIndex(window, now))
+	pipe := RDB.TxPipeline()
+	pipe.IncrBy(ctx, bucketKey, delta)
+	pipe.Expire(ctx, bucketKey, 2*window)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// WindowCounterGet returns the estimated value of the rolling window counter,
+// and the time when it drops below limit if nothing more is added
+func WindowCounterGet(key string, window time.Duration, limit int64) (int64, time.Time, error) {
+	now := time.Now()
+	if !RedisEnabled {
+		count, resetAt := memoryWindowCounter.get(key, window, limit, now)
+		return count, resetAt, nil
+	}
+	index := bucketIndex(window, now)
+	values, err := RDB.MGet(context.Background(), redisBucketKey(key, index), redisBucketKey(key, index-1)).Result()
+	if err != nil {
+		return 0, now, err
+	}
+	var counts [2]int64
+	for i, value := range values {
+		if str, ok := value.(string); ok {
+			counts[i], _ = strconv.ParseInt(str, 10, 64)
+		}
+	}
+	return estimate(window, index, counts[0], counts[1], now), belowLimitAt(window, index, counts[0], counts[1], limit, now), nil
+}
+
+// WindowCounterIncrease adds delta to the rolling window counter and returns the estimated value including it
+// in one step, so that concurrent callers can't all pass a limit. The time returned is when delta fits under
+// limit again once it is taken back.
+func WindowCounterIncrease(key string, window time.Duration, delta int64, limit int64) (int64, time.Time, error) {
+	now := time.Now()
+	if !RedisEnabled {
+		count, resetAt := memoryWindowCounter.increase(key, window, delta, limit, now)
+		return count, resetAt, nil
+	}
+	ctx := context.Background()
+	index := bucketIndex(window, now)
+	bucketKey := redisBucketKey(key, index)
+	pipe := RDB.TxPipeline()
+	current := pipe.IncrBy(ctx, bucketKey, delta)
+	pipe.Expire(ctx, bucketKey, 2*window)
+	previous := pipe.Get(ctx, redisBucketKey(key, index-1))
+	_, err := pipe.Exec(ctx)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, now, err
+	}
+	// a missing previous bucket counts as 0
+	count, _ := previous.Int64()
+	return estimate(window, index, current.Val(), count, now), belowLimitAt(window, index, current.Val(), count, limit+delta, now), nil
+}
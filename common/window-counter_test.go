@@ -0,0 +1,59 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInMemoryWindowCounter(t *testing.T) {
+	counter := inMemoryWindowCounter{store: make(map[string]*windowBucket)}
+	window := time.Hour
+	start := time.Unix(1000*3600, 0)
+	Convey("in memory window counter", t, func() {
+		counter.add("k", window, 100, start)
+		count, resetAt := counter.get("k", window, 200, start.Add(10*time.Minute))
+		So(count, ShouldEqual, 100)
+		So(resetAt, ShouldEqual, start.Add(10*time.Minute))
+		// half way through the next bucket, half of the previous bucket still counts
+		counter.add("k", window, 20, start.Add(90*time.Minute))
+		count, _ = counter.get("k", window, 200, start.Add(90*time.Minute))
+		So(count, ShouldEqual, 70)
+		count, _ = counter.get("k", window, 200, start.Add(5*time.Hour))
+		So(count, ShouldEqual, 0)
+	})
+}
+
+func TestWindowCounterResetAt(t *testing.T) {
+	counter := inMemoryWindowCounter{store: make(map[string]*windowBucket)}
+	window := time.Hour
+	start := time.Unix(1000*3600, 0)
+	Convey("reset time of a full window", t, func() {
+		counter.add("k", window, 100, start.Add(50*time.Minute))
+		// the whole limit is used in the current bucket, it drops below the limit
+		// only when enough of it has left the window in the next bucket
+		count, resetAt := counter.get("k", window, 80, start.Add(55*time.Minute))
+		So(count, ShouldEqual, 100)
+		So(resetAt.After(start.Add(time.Hour)), ShouldBeTrue)
+		count, _ = counter.get("k", window, 80, resetAt)
+		So(count, ShouldBeLessThan, 80)
+		count, _ = counter.get("k", window, 80, resetAt.Add(-time.Second))
+		So(count, ShouldBeGreaterThanOrEqualTo, 80)
+		// the previous bucket fills most of the limit
+		counter.add("k", window, 30, start.Add(70*time.Minute))
+		count, resetAt = counter.get("k", window, 100, start.Add(70*time.Minute))
+		So(count, ShouldBeGreaterThanOrEqualTo, 100)
+		count, _ = counter.get("k", window, 100, resetAt)
+		So(count, ShouldBeLessThan, 100)
+		count, _ = counter.get("k", window, 100, resetAt.Add(-time.Second))
+		So(count, ShouldBeGreaterThanOrEqualTo, 100)
+	})
+	Convey("stale buckets are swept", t, func() {
+		counter.add("other", time.Minute, 1, start.Add(2*time.Hour))
+		counter.add("other", time.Minute, 1, start.Add(3*time.Hour))
+		_, ok := counter.store["k"]
+		So(ok, ShouldBeFalse)
+		So(counter.store, ShouldContainKey, "other")
+	})
+}
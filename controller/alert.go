@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+)
+
+func GetAlertRules(c *gin.Context) {
+	rules, err := model.GetUserAlertRules(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    rules,
+	})
+	return
+}
+
+func validateAlertRule(c *gin.Context, rule *model.AlertRule) error {
+	if len(rule.Name) > 30 {
+		return fmt.Errorf("告警规则名称过长")
+	}
+	if rule.TokenId != 0 {
+		// the watched token must belong to the current user
+		if _, err := model.GetTokenByIds(rule.TokenId, c.GetInt(ctxkey.Id)); err != nil {
+			return fmt.Errorf("令牌不存在")
+		}
+	}
+	for _, channel := range rule.GetChannels() {
+		if channel == message.ByMessagePusher && c.GetInt(ctxkey.Role) < model.RoleAdminUser {
+			return fmt.Errorf("仅管理员可使用消息推送通知")
+		}
+	}
+	return rule.Validate()
+}
+
+func AddAlertRule(c *gin.Context) {
+	rule := model.AlertRule{}
+	err := c.ShouldBindJSON(&rule)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = validateAlertRule(c, &rule)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("参数错误：%s", err.Error()),
+		})
+		return
+	}
+	cleanRule := model.AlertRule{
+		UserId:      c.GetInt(ctxkey.Id),
+		TokenId:     rule.TokenId,
+		Name:        rule.Name,
+		Metric:      rule.Metric,
+		Thresholds:  rule.Thresholds,
+		Period:      rule.Period,
+		Channels:    rule.Channels,
+		WebhookURL:  rule.WebhookURL,
+		Status:      model.AlertRuleStatusEnabled,
+		CreatedTime: helper.GetTimestamp(),
+	}
+	err = cleanRule.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanRule,
+	})
+	return
+}
+
+func UpdateAlertRule(c *gin.Context) {
+	rule := model.AlertRule{}
+	err := c.ShouldBindJSON(&rule)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanRule, err := model.GetAlertRuleByIds(rule.Id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = validateAlertRule(c, &rule)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("参数错误：%s", err.Error()),
+		})
+		return
+	}
+	cleanRule.TokenId = rule.TokenId
+	cleanRule.Name = rule.Name
+	cleanRule.Metric = rule.Metric
+	cleanRule.Thresholds = rule.Thresholds
+	cleanRule.Period = rule.Period
+	cleanRule.Channels = rule.Channels
+	cleanRule.WebhookURL = rule.WebhookURL
+	if rule.Status == model.AlertRuleStatusEnabled || rule.Status == model.AlertRuleStatusDisabled {
+		cleanRule.Status = rule.Status
+	}
+	err = cleanRule.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanRule,
+	})
+	return
+}
+
+func DeleteAlertRule(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteAlertRuleById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// the widest time range a single query may cover, per granularity
+var maxUsageRanges = map[string]int64{
+	"hour": 31 * 86400,
+	"day":  366 * 86400,
+	"week": 5 * 366 * 86400,
+}
+
+func getUsageQuery(c *gin.Context) (model.UsageQuery, error) {
+	query := model.UsageQuery{
+		Granularity: c.DefaultQuery("granularity", "day"),
+		ModelName:   c.Query("model_name"),
+		GroupName:   c.Query("group"),
+	}
+	query.Type, _ = strconv.Atoi(c.DefaultQuery("type", strconv.Itoa(model.LogTypeConsume)))
+	query.StartTimestamp, _ = strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	query.EndTimestamp, _ = strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	query.UserId, _ = strconv.Atoi(c.Query("user_id"))
+	query.TokenId, _ = strconv.Atoi(c.Query("token_id"))
+	query.ChannelId, _ = strconv.Atoi(c.Query("channel"))
+	maxRange, ok := maxUsageRanges[query.Granularity]
+	if !ok {
+		return query, fmt.Errorf("无效的时间粒度：%s，可选 hour、day、week", query.Granularity)
+	}
+	for _, dimension := range strings.Split(c.Query("group_by"), ",") {
+		dimension = strings.TrimSpace(dimension)
+		if dimension == "" {
+			continue
+		}
+		if _, ok := model.UsageDimensions[dimension]; !ok {
+			return query, fmt.Errorf("无效的分组维度：%s，可选 model、channel、user、token、group", dimension)
+		}
+		query.GroupBy = append(query.GroupBy, dimension)
+	}
+	if query.EndTimestamp == 0 {
+		query.EndTimestamp = helper.GetTimestamp()
+	}
+	if query.StartTimestamp == 0 {
+		query.StartTimestamp = query.EndTimestamp - 7*86400
+	}
+	if query.EndTimestamp < query.StartTimestamp {
+		return query, fmt.Errorf("结束时间不能早于开始时间")
+	}
+	if query.EndTimestamp-query.StartTimestamp > maxRange {
+		return query, fmt.Errorf("按 %s 统计时查询范围不能超过 %d 天", query.Granularity, maxRange/86400)
+	}
+	return query, nil
+}
+
+func respondUsageStatistics(c *gin.Context, query model.UsageQuery) {
+	statistics, err := model.GetUsageStatistics(query)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    statistics,
+	})
+}
+
+func GetUsageAnalytics(c *gin.Context) {
+	query, err := getUsageQuery(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	respondUsageStatistics(c, query)
+}
+
+// GetSelfUsageAnalytics only covers the requesting user and does not reveal channels
+func GetSelfUsageAnalytics(c *gin.Context) {
+	query, err := getUsageQuery(c)
+	if err == nil {
+		for _, dimension := range query.GroupBy {
+			if dimension == "channel" || dimension == "user" {
+				err = fmt.Errorf("无效的分组维度：%s，可选 model、token、group", dimension)
+				break
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	query.UserId = c.GetInt(ctxkey.Id)
+	query.ChannelId = 0
+	respondUsageStatistics(c, query)
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// an export larger than this should be narrowed down with filters
+const maxAuditExportRows = 50000
+
+func recordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	model.RecordAuditLog(&model.AuditLog{
+		ActorId:           c.GetInt(ctxkey.Id),
+		ActorName:         c.GetString(ctxkey.Username),
+		ActorRole:         c.GetInt(ctxkey.Role),
+		ManagementTokenId: c.GetInt(ctxkey.ManagementTokenId),
+		Action:            action,
+		TargetType:        targetType,
+		TargetId:          fmt.Sprint(targetId),
+		Diff:              model.AuditDiff(before, after),
+		Ip:                c.ClientIP(),
+		RequestId:         c.GetString(helper.RequestIdKey),
+	})
+}
+
+// recordLoginAudit records an action on the account by someone who isn't logged in
+func recordLoginAudit(c *gin.Context, user *model.User, action string) {
+	model.RecordAuditLog(&model.AuditLog{
+		ActorId:    user.Id,
+		ActorName:  user.Username,
+		ActorRole:  user.Role,
+		Action:     action,
+		TargetType: model.AuditTargetUser,
+		TargetId:   fmt.Sprint(user.Id),
+		Ip:         c.ClientIP(),
+		RequestId:  c.GetString(helper.RequestIdKey),
+	})
+}
+
+func getAuditFilter(c *gin.Context) model.AuditFilter {
+	actorId, _ := strconv.Atoi(c.Query("actor_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.AuditFilter{
+		ActorId:        actorId,
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	audits, err := model.GetAuditLogs(getAuditFilter(c), p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    audits,
+	})
+	return
+}
+
+func ExportAuditLogs(c *gin.Context) {
+	audits, err := model.GetAuditLogs(getAuditFilter(c), 0, maxAuditExportRows)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if c.Query("format") != "csv" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%d.json", helper.GetTimestamp()))
+		c.JSON(http.StatusOK, audits)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-%d.csv", helper.GetTimestamp()))
+	// BOM for Excel
+	_, _ = c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "time", "actor_id", "actor_name", "actor_role", "management_token_id", "action", "target_type", "target_id", "diff", "ip", "request_id"})
+	for _, audit := range audits {
+		_ = writer.Write([]string{
+			strconv.Itoa(audit.Id),
+			time.Unix(audit.CreatedAt, 0).Format("2006-01-02 15:04:05"),
+			strconv.Itoa(audit.ActorId),
+			audit.ActorName,
+			strconv.Itoa(audit.ActorRole),
+			strconv.Itoa(audit.ManagementTokenId),
+			audit.Action,
+			audit.TargetType,
+			audit.TargetId,
+			audit.Diff,
+			audit.Ip,
+			audit.RequestId,
+		})
+	}
+	writer.Flush()
+}
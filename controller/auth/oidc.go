@@ -0,0 +1,454 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/controller"
+	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IdToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+var oidcClient = http.Client{
+	Timeout: 10 * time.Second,
+}
+
+var oidcDiscoveryCache struct {
+	sync.Mutex
+	issuer    string
+	discovery *oidcDiscovery
+	fetchedAt time.Time
+}
+
+// getOidcDiscovery fetches the provider metadata of the issuer, it's cached for an hour
+func getOidcDiscovery() (*oidcDiscovery, error) {
+	oidcDiscoveryCache.Lock()
+	defer oidcDiscoveryCache.Unlock()
+	issuer := strings.TrimSuffix(config.OidcIssuer, "/")
+	if oidcDiscoveryCache.discovery != nil && oidcDiscoveryCache.issuer == issuer && time.Since(oidcDiscoveryCache.fetchedAt) < time.Hour {
+		return oidcDiscoveryCache.discovery, nil
+	}
+	res, err := oidcClient.Get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		logger.SysLog(err.Error())
+		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取 OIDC 配置失败，状态码 %d", res.StatusCode)
+	}
+	var discovery oidcDiscovery
+	err = json.NewDecoder(res.Body).Decode(&discovery)
+	if err != nil {
+		return nil, err
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" {
+		return nil, errors.New("OIDC 配置缺少 authorization_endpoint 或 token_endpoint")
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, errors.New("OIDC 配置中的 issuer 与设置不一致")
+	}
+	oidcDiscoveryCache.issuer = issuer
+	oidcDiscoveryCache.discovery = &discovery
+	oidcDiscoveryCache.fetchedAt = time.Now()
+	return &discovery, nil
+}
+
+func oidcRedirectURI() string {
+	return fmt.Sprintf("%s/oauth/oidc", config.ServerAddress)
+}
+
+func pkceChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// OidcAuthorize redirects the browser to the IdP with state, nonce and a PKCE challenge kept in the session
+func OidcAuthorize(c *gin.Context) {
+	if !config.OidcEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过 OIDC 登录以及注册",
+		})
+		return
+	}
+	discovery, err := getOidcDiscovery()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	state := random.GetRandomString(16)
+	nonce := random.GetRandomString(16)
+	verifier := random.GetRandomString(64)
+	session := sessions.Default(c)
+	session.Set("oauth_state", state)
+	session.Set("oidc_nonce", nonce)
+	session.Set("oidc_code_verifier", verifier)
+	err = session.Save()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", config.OidcClientId)
+	query.Set("redirect_uri", oidcRedirectURI())
+	query.Set("scope", config.OidcScopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", pkceChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	c.Redirect(http.StatusFound, discovery.AuthorizationEndpoint+separator+query.Encode())
+}
+
+// parseOidcIdToken reads the claims of an ID token received directly from the token endpoint,
+// in this case TLS validates the issuer in place of the signature (OIDC core 3.1.3.7)
+func parseOidcIdToken(idToken string, issuer string, clientId string, nonce string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("无效的 ID Token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errors.New("无效的 ID Token")
+	}
+	claims := make(map[string]any)
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, errors.New("无效的 ID Token")
+	}
+	if strings.TrimSuffix(claimString(claims, "iss"), "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, errors.New("ID Token 的 issuer 不匹配")
+	}
+	audienceMatched := false
+	for _, audience := range claimStrings(claims, "aud") {
+		if audience == clientId {
+			audienceMatched = true
+		}
+	}
+	if !audienceMatched {
+		return nil, errors.New("ID Token 的 audience 不匹配")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.Unix() > int64(exp) {
+		return nil, errors.New("ID Token 已过期")
+	}
+	if claimString(claims, "nonce") != nonce {
+		return nil, errors.New("ID Token 的 nonce 不匹配")
+	}
+	if claimString(claims, "sub") == "" {
+		return nil, errors.New("ID Token 缺少 sub")
+	}
+	return claims, nil
+}
+
+func claimString(claims map[string]any, name string) string {
+	if name == "" {
+		return ""
+	}
+	value, _ := claims[name].(string)
+	return value
+}
+
+// claimStrings reads a claim which can be either a string or an array of strings
+func claimStrings(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		var values []string
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// mapOidcGroup returns the first group of the claims found in OidcGroupMapping, or "" if none matches
+func mapOidcGroup(claims map[string]any) string {
+	if config.OidcGroupClaim == "" || config.OidcGroupMapping == "" {
+		return ""
+	}
+	mapping := make(map[string]string)
+	err := json.Unmarshal([]byte(config.OidcGroupMapping), &mapping)
+	if err != nil {
+		logger.SysError("failed to parse OidcGroupMapping: " + err.Error())
+		return ""
+	}
+	for _, idpGroup := range claimStrings(claims, config.OidcGroupClaim) {
+		group, ok := mapping[idpGroup]
+		if !ok {
+			continue
+		}
+		if _, ok := billingratio.GroupRatio[group]; ok {
+			return group
+		}
+	}
+	return ""
+}
+
+func getOidcClaimsByCode(code string, verifier string, nonce string) (map[string]any, error) {
+	if code == "" || verifier == "" {
+		return nil, errors.New("无效的参数")
+	}
+	discovery, err := getOidcDiscovery()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", oidcRedirectURI())
+	form.Set("client_id", config.OidcClientId)
+	// public clients have no secret, PKCE protects the code exchange
+	if config.OidcClientSecret != "" {
+		form.Set("client_secret", config.OidcClientSecret)
+	}
+	form.Set("code_verifier", verifier)
+	res, err := oidcClient.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		logger.SysLog(err.Error())
+		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+	}
+	defer res.Body.Close()
+	var tokenResponse oidcTokenResponse
+	err = json.NewDecoder(res.Body).Decode(&tokenResponse)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResponse.Error != "" {
+		return nil, fmt.Errorf("OIDC 授权失败：%s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	claims, err := parseOidcIdToken(tokenResponse.IdToken, discovery.Issuer, config.OidcClientId, nonce, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if discovery.UserinfoEndpoint == "" || tokenResponse.AccessToken == "" {
+		return claims, nil
+	}
+	// the ID token may only carry sub, the other claims come from the userinfo endpoint
+	req, err := http.NewRequest("GET", discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenResponse.AccessToken)
+	res2, err := oidcClient.Do(req)
+	if err != nil {
+		logger.SysLog(err.Error())
+		return nil, errors.New("无法连接至 OIDC 服务器，请稍后重试！")
+	}
+	defer res2.Body.Close()
+	userinfo := make(map[string]any)
+	err = json.NewDecoder(res2.Body).Decode(&userinfo)
+	if err != nil {
+		return nil, err
+	}
+	if claimString(userinfo, "sub") != claimString(claims, "sub") {
+		return nil, errors.New("OIDC 用户信息与 ID Token 不一致")
+	}
+	for k, v := range userinfo {
+		if _, ok := claims[k]; !ok {
+			claims[k] = v
+		}
+	}
+	return claims, nil
+}
+
+var oidcUsernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,12}$`)
+
+func newOidcUser(claims map[string]any) *model.User {
+	user := model.User{
+		Role:   model.RoleCommonUser,
+		Status: model.UserStatusEnabled,
+		Group:  config.OidcDefaultGroup,
+	}
+	username := claimString(claims, config.OidcUsernameClaim)
+	if oidcUsernamePattern.MatchString(username) && !model.IsUsernameAlreadyTaken(username) {
+		user.Username = username
+	} else {
+		user.Username = "oidc_" + strconv.Itoa(model.GetMaxUserId()+1)
+	}
+	user.DisplayName = claimString(claims, config.OidcDisplayNameClaim)
+	if user.DisplayName == "" || len(user.DisplayName) > 20 {
+		user.DisplayName = "OIDC User"
+	}
+	email := claimString(claims, config.OidcEmailClaim)
+	if len(email) <= 50 {
+		user.Email = email
+	}
+	if group := mapOidcGroup(claims); group != "" {
+		user.Group = group
+	}
+	if user.Group == "" {
+		user.Group = "default"
+	}
+	return &user
+}
+
+func OidcOAuth(c *gin.Context) {
+	session := sessions.Default(c)
+	state := c.Query("state")
+	if state == "" || session.Get("oauth_state") == nil || state != session.Get("oauth_state").(string) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "state is empty or not same",
+		})
+		return
+	}
+	if !config.OidcEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员未开启通过 OIDC 登录以及注册",
+		})
+		return
+	}
+	verifier, _ := session.Get("oidc_code_verifier").(string)
+	nonce, _ := session.Get("oidc_nonce").(string)
+	// the verifier and nonce are single use
+	session.Delete("oidc_code_verifier")
+	session.Delete("oidc_nonce")
+	_ = session.Save()
+	claims, err := getOidcClaimsByCode(c.Query("code"), verifier, nonce)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	subject := claimString(claims, "sub")
+	if session.Get("username") != nil {
+		oidcBind(c, session.Get("id").(int), subject, claims)
+		return
+	}
+	user := model.User{}
+	identity, err := model.GetUserIdentity(model.IdentityProviderOidc, subject)
+	if err == nil {
+		user.Id = identity.UserId
+		err = user.FillUserById()
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		if group := mapOidcGroup(claims); group != "" && group != user.Group {
+			// keep the group in sync with the IdP
+			user.Group = group
+			err = model.UpdateUserGroup(user.Id, group)
+			if err != nil {
+				logger.SysError("failed to sync oidc group: " + err.Error())
+			}
+		}
+		_ = identity.UpdateLoginTime()
+	} else {
+		if !config.RegisterEnabled {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "管理员关闭了新用户注册",
+			})
+			return
+		}
+		user = *newOidcUser(claims)
+		if err := user.Insert(0); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		identity = &model.UserIdentity{
+			UserId:   user.Id,
+			Provider: model.IdentityProviderOidc,
+			Subject:  subject,
+			Email:    user.Email,
+		}
+		if err := identity.Insert(); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if user.Status != model.UserStatusEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	controller.SetupLogin(&user, c)
+}
+
+func oidcBind(c *gin.Context, userId int, subject string, claims map[string]any) {
+	if _, err := model.GetUserIdentity(model.IdentityProviderOidc, subject); err == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该 OIDC 账户已被绑定",
+		})
+		return
+	}
+	identity := model.UserIdentity{
+		UserId:   userId,
+		Provider: model.IdentityProviderOidc,
+		Subject:  subject,
+		Email:    claimString(claims, config.OidcEmailClaim),
+	}
+	err := identity.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "bind",
+	})
+	return
+}
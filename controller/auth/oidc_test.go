@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func buildOidcIdToken(claims map[string]any) string {
+	payload, _ := json.Marshal(claims)
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+func TestParseOidcIdToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"iss":   "https://idp.example.com/",
+			"aud":   []any{"other", "one-api"},
+			"exp":   float64(now.Unix() + 60),
+			"nonce": "nonce",
+			"sub":   "user-1",
+		}
+	}
+
+	Convey("valid ID tokens are parsed", t, func() {
+		claims, err := parseOidcIdToken(buildOidcIdToken(validClaims()), "https://idp.example.com", "one-api", "nonce", now)
+		So(err, ShouldBeNil)
+		So(claimString(claims, "sub"), ShouldEqual, "user-1")
+	})
+	Convey("a single audience string is accepted", t, func() {
+		claims := validClaims()
+		claims["aud"] = "one-api"
+		_, err := parseOidcIdToken(buildOidcIdToken(claims), "https://idp.example.com", "one-api", "nonce", now)
+		So(err, ShouldBeNil)
+	})
+	Convey("invalid ID tokens are rejected", t, func() {
+		cases := map[string]func(claims map[string]any){
+			"issuer":   func(claims map[string]any) { claims["iss"] = "https://evil.example.com" },
+			"audience": func(claims map[string]any) { claims["aud"] = "other" },
+			"expired":  func(claims map[string]any) { claims["exp"] = float64(now.Unix() - 1) },
+			"no exp":   func(claims map[string]any) { delete(claims, "exp") },
+			"nonce":    func(claims map[string]any) { claims["nonce"] = "replayed" },
+			"no sub":   func(claims map[string]any) { delete(claims, "sub") },
+		}
+		for name, modify := range cases {
+			modify := modify
+			Convey(name, func() {
+				claims := validClaims()
+				modify(claims)
+				_, err := parseOidcIdToken(buildOidcIdToken(claims), "https://idp.example.com", "one-api", "nonce", now)
+				So(err, ShouldNotBeNil)
+			})
+		}
+		_, err := parseOidcIdToken("not-a-jwt", "https://idp.example.com", "one-api", "nonce", now)
+		So(err, ShouldNotBeNil)
+		_, err = parseOidcIdToken("a.!!!.c", "https://idp.example.com", "one-api", "nonce", now)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestMapOidcGroup(t *testing.T) {
+	claim, mapping := config.OidcGroupClaim, config.OidcGroupMapping
+	defer func() {
+		config.OidcGroupClaim, config.OidcGroupMapping = claim, mapping
+	}()
+	config.OidcGroupClaim = "groups"
+	config.OidcGroupMapping = `{"admins": "svip", "staff": "vip", "ghosts": "no-such-group"}`
+
+	Convey("the first mapped group is used", t, func() {
+		So(mapOidcGroup(map[string]any{"groups": []any{"users", "staff", "admins"}}), ShouldEqual, "vip")
+		So(mapOidcGroup(map[string]any{"groups": "admins"}), ShouldEqual, "svip")
+	})
+	Convey("groups unknown to the group ratios are skipped", t, func() {
+		So(mapOidcGroup(map[string]any{"groups": []any{"ghosts", "staff"}}), ShouldEqual, "vip")
+		So(mapOidcGroup(map[string]any{"groups": []any{"ghosts"}}), ShouldEqual, "")
+	})
+	Convey("nothing is mapped without a matching claim or a valid mapping", t, func() {
+		So(mapOidcGroup(map[string]any{"roles": []any{"admins"}}), ShouldEqual, "")
+		config.OidcGroupMapping = "not json"
+		So(mapOidcGroup(map[string]any{"groups": []any{"admins"}}), ShouldEqual, "")
+		config.OidcGroupMapping = ""
+		So(mapOidcGroup(map[string]any{"groups": []any{"admins"}}), ShouldEqual, "")
+	})
+}
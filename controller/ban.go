@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+)
+
+func GetBans(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	bans, err := model.GetBans(p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    bans,
+	})
+	return
+}
+
+func validateBan(c *gin.Context, ban *model.Ban) error {
+	if ban.ExpiredTime == 0 {
+		ban.ExpiredTime = -1
+	}
+	if ban.ExpiredTime != -1 && ban.ExpiredTime <= helper.GetTimestamp() {
+		return errors.New("过期时间不能早于当前时间")
+	}
+	switch ban.Type {
+	case model.BanTypeUser:
+		if ban.UserId == 0 && ban.Username != "" {
+			user := model.User{}
+			model.DB.Select("id").Where("username = ?", ban.Username).First(&user)
+			ban.UserId = user.Id
+		}
+		user, err := model.GetUserById(ban.UserId, false)
+		if err != nil {
+			return errors.New("用户不存在")
+		}
+		myRole := c.GetInt(ctxkey.Role)
+		if user.Role == model.RoleRootUser || (myRole <= user.Role && myRole != model.RoleRootUser) {
+			return errors.New("无权封禁同权限等级或更高权限等级的用户")
+		}
+		ban.Cidr = ""
+	case model.BanTypeIp:
+		cidr, err := blacklist.NormalizeCidr(ban.Cidr)
+		if err != nil {
+			return fmt.Errorf("无效的 IP 或网段：%s", err.Error())
+		}
+		ban.Cidr = cidr
+		ban.UserId = 0
+	default:
+		return errors.New("无效的封禁类型")
+	}
+	return nil
+}
+
+func AddBan(c *gin.Context) {
+	ban := model.Ban{}
+	err := c.ShouldBindJSON(&ban)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = validateBan(c, &ban)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanBan := model.Ban{
+		Type:        ban.Type,
+		UserId:      ban.UserId,
+		Cidr:        ban.Cidr,
+		Reason:      ban.Reason,
+		ExpiredTime: ban.ExpiredTime,
+		CreatedBy:   c.GetInt(ctxkey.Id),
+	}
+	err = cleanBan.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "ban.create", model.AuditTargetBan, cleanBan.Id, nil, cleanBan)
+	if cleanBan.Type == model.BanTypeUser {
+		model.RecordLog(cleanBan.UserId, model.LogTypeManage, fmt.Sprintf("账户被封禁，原因：%s", cleanBan.Reason))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanBan,
+	})
+	return
+}
+
+func DeleteBan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteBanById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "ban.delete", model.AuditTargetBan, id, nil, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+)
+
+func GetPayloadCaptures(c *gin.Context) {
+	captures, err := model.GetPayloadCaptures(c.Param("request_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if len(captures) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "未找到该请求的抓包记录，可能未开启抓包或已过期",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    captures,
+	})
+}
@@ -103,6 +103,9 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	for _, channel := range channels {
+		recordAudit(c, "channel.create", model.AuditTargetChannel, channel.Id, nil, channel)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -112,8 +115,16 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	originChannel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	channel := model.Channel{Id: id}
-	err := channel.Delete()
+	err = channel.Delete()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -121,6 +132,7 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "channel.delete", model.AuditTargetChannel, id, originChannel, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -137,6 +149,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "channel.delete_disabled", model.AuditTargetChannel, "", nil, gin.H{"count": rows})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -155,6 +168,14 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	originChannel, err := model.GetChannelById(channel.Id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -163,6 +184,10 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	updatedChannel, err := model.GetChannelById(channel.Id, true)
+	if err == nil {
+		recordAudit(c, "channel.update", model.AuditTargetChannel, channel.Id, originChannel, updatedChannel)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
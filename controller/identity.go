@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+)
+
+func GetSelfIdentities(c *gin.Context) {
+	identities, err := model.GetUserIdentities(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    identities,
+	})
+	return
+}
+
+func DeleteSelfIdentity(c *gin.Context) {
+	userId := c.GetInt(ctxkey.Id)
+	id, _ := strconv.Atoi(c.Param("id"))
+	user, err := model.GetUserById(userId, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	identities, err := model.GetUserIdentities(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// don't let the user lock themselves out
+	hasOtherLogin := user.Password != "" || user.GitHubId != "" || user.WeChatId != "" || user.LarkId != "" || len(identities) > 1
+	if !hasOtherLogin {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "这是你唯一的登录方式，请先设置密码或绑定其他账户",
+		})
+		return
+	}
+	err = model.DeleteUserIdentity(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
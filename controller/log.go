@@ -152,18 +152,28 @@ func DeleteHistoryLogs(c *gin.Context) {
 		})
 		return
 	}
-	count, err := model.DeleteOldLog(targetTimestamp)
-	if err != nil {
+	// large deletions take longer than a request may, the status is polled with GetLogDeletion
+	deletion, started := model.StartLogDeletion(targetTimestamp)
+	if !started {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": err.Error(),
+			"message": "已有日志清理任务正在进行",
+			"data":    deletion,
 		})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    count,
+		"data":    deletion,
 	})
 	return
 }
+
+func GetLogDeletion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetLogDeletion(),
+	})
+}
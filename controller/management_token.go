@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func validateManagementToken(token *model.ManagementToken) error {
+	if token.Name == "" || len(token.Name) > 30 {
+		return fmt.Errorf("令牌名称为空或过长")
+	}
+	scopes := token.ScopeList()
+	if len(scopes) == 0 {
+		return fmt.Errorf("请至少选择一个权限")
+	}
+	for _, scope := range scopes {
+		if !model.ValidScopes[scope] {
+			return fmt.Errorf("无效的权限：%s", scope)
+		}
+	}
+	token.Scopes = strings.Join(scopes, ",")
+	if token.AllowedIps != "" {
+		err := network.IsValidSubnets(token.AllowedIps)
+		if err != nil {
+			return fmt.Errorf("无效的网段：%s", err.Error())
+		}
+	}
+	if token.ExpiredTime == 0 {
+		token.ExpiredTime = -1
+	}
+	if token.ExpiredTime != -1 && token.ExpiredTime < helper.GetTimestamp() {
+		return fmt.Errorf("过期时间不能早于当前时间")
+	}
+	return nil
+}
+
+func GetSelfManagementTokens(c *gin.Context) {
+	tokens, err := model.GetUserManagementTokens(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    tokens,
+	})
+	return
+}
+
+func AddManagementToken(c *gin.Context) {
+	token := model.ManagementToken{}
+	err := c.ShouldBindJSON(&token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = validateManagementToken(&token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("参数错误：%s", err.Error()),
+		})
+		return
+	}
+	cleanToken := model.ManagementToken{
+		UserId:      c.GetInt(ctxkey.Id),
+		Name:        token.Name,
+		Scopes:      token.Scopes,
+		AllowedIps:  token.AllowedIps,
+		ExpiredTime: token.ExpiredTime,
+	}
+	key, err := cleanToken.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// the key can't be shown again, only its hash is stored
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"token": cleanToken,
+			"key":   key,
+		},
+	})
+	return
+}
+
+func UpdateManagementToken(c *gin.Context) {
+	token := model.ManagementToken{}
+	err := c.ShouldBindJSON(&token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = validateManagementToken(&token)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("参数错误：%s", err.Error()),
+		})
+		return
+	}
+	cleanToken, err := model.GetManagementTokenByIds(token.Id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanToken.Name = token.Name
+	cleanToken.Scopes = token.Scopes
+	cleanToken.AllowedIps = token.AllowedIps
+	cleanToken.ExpiredTime = token.ExpiredTime
+	err = cleanToken.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanToken,
+	})
+	return
+}
+
+func DeleteManagementToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteManagementTokenById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	"strconv"
+	"time"
+)
+
+const metricsPingTimeout = 5 * time.Second
+
+func collectChannelMetrics() {
+	channels, err := model.GetChannelStatuses()
+	if err != nil {
+		logger.SysError("failed to get channels for metrics: " + err.Error())
+		return
+	}
+	metrics.ChannelStatus.Reset()
+	for _, channel := range channels {
+		metrics.ChannelStatus.WithLabelValues(strconv.Itoa(channel.Id), channel.Name, strconv.Itoa(channel.Type)).Set(float64(channel.Status))
+	}
+	metrics.ChannelSuccessRate.Reset()
+	for channelId, rate := range monitor.SuccessRates() {
+		metrics.ChannelSuccessRate.WithLabelValues(strconv.Itoa(channelId)).Set(rate)
+	}
+}
+
+func pingDB(name string, ping func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsPingTimeout)
+	defer cancel()
+	start := time.Now()
+	err := ping(ctx)
+	if err != nil {
+		logger.SysError("failed to ping " + name + ": " + err.Error())
+		metrics.DBPingDuration.WithLabelValues(name).Set(-1)
+		return
+	}
+	metrics.DBPingDuration.WithLabelValues(name).Set(time.Since(start).Seconds())
+}
+
+func collectStorageMetrics() {
+	if sqlDB, err := model.DB.DB(); err == nil {
+		pingDB("main", sqlDB.PingContext)
+	}
+	if model.LOG_DB != model.DB {
+		if sqlDB, err := model.LOG_DB.DB(); err == nil {
+			pingDB("log", sqlDB.PingContext)
+		}
+	}
+	if common.RedisEnabled {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsPingTimeout)
+		defer cancel()
+		start := time.Now()
+		err := common.RDB.Ping(ctx).Err()
+		if err != nil {
+			logger.SysError("failed to ping redis: " + err.Error())
+			metrics.RedisPingDuration.Set(-1)
+			return
+		}
+		metrics.RedisPingDuration.Set(time.Since(start).Seconds())
+	}
+}
+
+func init() {
+	metrics.OnScrape(collectChannelMetrics)
+	metrics.OnScrape(collectStorageMetrics)
+}
+
+var metricsHandler = metrics.Handler()
+
+func Metrics(c *gin.Context) {
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -43,6 +45,74 @@ func UpdateOption(c *gin.Context) {
 		return
 	}
 	switch option.Key {
+	case "TokenKeySecret", "SessionSecret":
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "该配置项无法修改",
+		})
+		return
+	case "PasswordMinLength":
+		length, _ := strconv.Atoi(option.Value)
+		if length < 8 || length > 20 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密码最小长度需在 8 到 20 之间",
+			})
+			return
+		}
+	case "LogLevel":
+		if !logger.ValidLevel(option.Value) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的日志级别，可选 debug、info、warn、error",
+			})
+			return
+		}
+	case "CaptureTokenIds", "CaptureChannelIds":
+		for _, id := range strings.Split(option.Value, ",") {
+			if _, err := strconv.Atoi(strings.TrimSpace(id)); err != nil && strings.TrimSpace(id) != "" {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "请填写以英文逗号分隔的 Id",
+				})
+				return
+			}
+		}
+	case "CaptureMaxBodySize":
+		size, _ := strconv.Atoi(option.Value)
+		if size <= 0 || size > 1024*1024 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "抓包大小上限需在 1 字节到 1 MB 之间",
+			})
+			return
+		}
+	case "CaptureRetentionHours":
+		hours, _ := strconv.Atoi(option.Value)
+		if hours <= 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "抓包保留时长必须大于 0 小时",
+			})
+			return
+		}
+	case "LogRetentionDaysTopup", "LogRetentionDaysConsume", "LogRetentionDaysManage", "LogRetentionDaysSystem":
+		days, err := strconv.Atoi(option.Value)
+		if err != nil || days < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "日志保留天数需为非负整数，0 表示永久保留",
+			})
+			return
+		}
+	case "CaptureRedactPatterns":
+		if _, err := logger.NewPayloadRedactor(nil, strings.Split(option.Value, "\n")); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的正则表达式：" + err.Error(),
+			})
+			return
+		}
 	case "Theme":
 		if !config.ValidThemes[option.Value] {
 			c.JSON(http.StatusOK, gin.H{
@@ -59,6 +129,14 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "OidcEnabled":
+		if option.Value == "true" && (config.OidcIssuer == "" || config.OidcClientId == "") {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无法启用 OIDC 登录，请先填入 Issuer 以及 Client Id！",
+			})
+			return
+		}
 	case "EmailDomainRestrictionEnabled":
 		if option.Value == "true" && len(config.EmailDomainWhitelist) == 0 {
 			c.JSON(http.StatusOK, gin.H{
@@ -84,6 +162,9 @@ func UpdateOption(c *gin.Context) {
 			return
 		}
 	}
+	config.OptionMapRWMutex.RLock()
+	originValue := config.OptionMap[option.Key]
+	config.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -92,6 +173,7 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "option.update", model.AuditTargetOption, option.Key, gin.H{option.Key: originValue}, gin.H{option.Key: option.Value})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
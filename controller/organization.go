@@ -0,0 +1,403 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+)
+
+// getOrgMemberWithRole checks that the current user has at least the role in the organization of the :id param
+func getOrgMemberWithRole(c *gin.Context, minRole int) (*model.OrganizationMember, error) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	member, err := model.GetOrgMember(orgId, c.GetInt(ctxkey.Id))
+	if err != nil {
+		return nil, err
+	}
+	if member.Role < minRole {
+		return nil, errors.New("无权进行此操作，组织权限不足")
+	}
+	return member, nil
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	orgs, err := model.GetAllOrganizations(p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+	})
+	return
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orgs,
+	})
+	return
+}
+
+func AddOrganization(c *gin.Context) {
+	org := model.Organization{}
+	err := c.ShouldBindJSON(&org)
+	if err != nil || org.Name == "" || len(org.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "组织名称为空或过长",
+		})
+		return
+	}
+	cleanOrg := model.Organization{
+		Name:   org.Name,
+		Status: model.OrgStatusEnabled,
+		Models: org.Models,
+	}
+	err = model.InsertOrganization(&cleanOrg, c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanOrg.Role = model.OrgRoleOwner
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanOrg,
+	})
+	return
+}
+
+func UpdateOrganization(c *gin.Context) {
+	member, err := getOrgMemberWithRole(c, model.OrgRoleAdmin)
+	org := model.Organization{}
+	if err == nil {
+		err = c.ShouldBindJSON(&org)
+	}
+	if err == nil && (org.Name == "" || len(org.Name) > 64) {
+		err = errors.New("组织名称为空或过长")
+	}
+	var cleanOrg *model.Organization
+	if err == nil {
+		cleanOrg, err = model.GetOrganizationById(member.OrgId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanOrg.Name = org.Name
+	cleanOrg.Models = org.Models
+	if org.Status == model.OrgStatusEnabled || org.Status == model.OrgStatusDisabled {
+		cleanOrg.Status = org.Status
+	}
+	err = cleanOrg.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanOrg,
+	})
+	return
+}
+
+func DeleteOrganization(c *gin.Context) {
+	member, err := getOrgMemberWithRole(c, model.OrgRoleOwner)
+	if err == nil {
+		err = model.DeleteOrganization(member.OrgId, member.UserId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func GetOrgMembers(c *gin.Context) {
+	member, err := getOrgMemberWithRole(c, model.OrgRoleMember)
+	var members []*model.OrganizationMember
+	if err == nil {
+		members, err = model.GetOrgMembers(member.OrgId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+	return
+}
+
+func validateOrgMember(operator *model.OrganizationMember, member *model.OrganizationMember) error {
+	if member.Role != model.OrgRoleMember && member.Role != model.OrgRoleAdmin {
+		return errors.New("无效的组织角色")
+	}
+	if member.Role == model.OrgRoleAdmin && operator.Role != model.OrgRoleOwner {
+		return errors.New("只有组织所有者可以设置管理员")
+	}
+	if member.QuotaLimit < 0 {
+		return errors.New("额度上限不能为负数")
+	}
+	return nil
+}
+
+type orgMemberRequest struct {
+	Username   string `json:"username"`
+	UserId     int    `json:"user_id"`
+	Role       int    `json:"role"`
+	QuotaLimit int64  `json:"quota_limit"`
+}
+
+func AddOrgMember(c *gin.Context) {
+	operator, err := getOrgMemberWithRole(c, model.OrgRoleAdmin)
+	req := orgMemberRequest{}
+	if err == nil {
+		err = c.ShouldBindJSON(&req)
+	}
+	member := model.OrganizationMember{}
+	if err == nil {
+		user := model.User{}
+		model.DB.Select("id").Where("username = ?", req.Username).First(&user)
+		if user.Id == 0 {
+			err = errors.New("用户不存在")
+		}
+		member = model.OrganizationMember{
+			OrgId:      operator.OrgId,
+			UserId:     user.Id,
+			Role:       req.Role,
+			QuotaLimit: req.QuotaLimit,
+		}
+		if member.Role == 0 {
+			member.Role = model.OrgRoleMember
+		}
+	}
+	if err == nil {
+		err = validateOrgMember(operator, &member)
+	}
+	if err == nil {
+		err = member.Insert()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+	return
+}
+
+func UpdateOrgMember(c *gin.Context) {
+	operator, err := getOrgMemberWithRole(c, model.OrgRoleAdmin)
+	req := orgMemberRequest{}
+	if err == nil {
+		err = c.ShouldBindJSON(&req)
+	}
+	var member *model.OrganizationMember
+	if err == nil {
+		member, err = model.GetOrgMember(operator.OrgId, req.UserId)
+		if err != nil {
+			err = errors.New("该成员不存在")
+		}
+	}
+	if err == nil && member.Role >= operator.Role && operator.Role != model.OrgRoleOwner {
+		err = errors.New("无权更新同权限等级或更高权限等级的成员")
+	}
+	if err == nil && member.Role == model.OrgRoleOwner {
+		// the owner keeps its role, only the limit can be changed
+		req.Role = model.OrgRoleOwner
+		member.QuotaLimit = req.QuotaLimit
+	} else if err == nil {
+		member.Role = req.Role
+		member.QuotaLimit = req.QuotaLimit
+		err = validateOrgMember(operator, member)
+	}
+	if err == nil {
+		err = member.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+	return
+}
+
+// DeleteOrgMember removes a member, members can also remove themselves to leave the organization
+func DeleteOrgMember(c *gin.Context) {
+	operator, err := getOrgMemberWithRole(c, model.OrgRoleMember)
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	if err == nil && userId != operator.UserId {
+		var member *model.OrganizationMember
+		member, err = model.GetOrgMember(operator.OrgId, userId)
+		if err != nil {
+			err = errors.New("该成员不存在")
+		} else if operator.Role < model.OrgRoleAdmin || (member.Role >= operator.Role && operator.Role != model.OrgRoleOwner) {
+			err = errors.New("无权进行此操作，组织权限不足")
+		}
+	}
+	if err == nil {
+		err = model.DeleteOrgMember(operator.OrgId, userId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+type orgQuotaRequest struct {
+	OrgId int   `json:"org_id"`
+	Quota int64 `json:"quota"`
+}
+
+// FundOrganization lets a member move own quota into the pool
+func FundOrganization(c *gin.Context) {
+	member, err := getOrgMemberWithRole(c, model.OrgRoleMember)
+	req := orgQuotaRequest{}
+	if err == nil {
+		err = c.ShouldBindJSON(&req)
+	}
+	if err == nil {
+		err = model.FundOrganization(member.OrgId, member.UserId, req.Quota)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// AdminTopUpOrganization adds quota to the pool of an organization, only for admins
+func AdminTopUpOrganization(c *gin.Context) {
+	req := orgQuotaRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err == nil {
+		err = model.IncreaseOrgQuota(req.OrgId, req.Quota)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(c.GetInt(ctxkey.Id), model.LogTypeManage, fmt.Sprintf("为组织 #%d 充值 %s", req.OrgId, common.LogQuota(req.Quota)))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// GetOrgLogs shows the logs billed to the organization, members only see their own ones
+func GetOrgLogs(c *gin.Context) {
+	member, err := getOrgMemberWithRole(c, model.OrgRoleMember)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	modelName := c.Query("model_name")
+	username := c.Query("username")
+	if member.Role < model.OrgRoleAdmin {
+		username = model.GetUsernameById(member.UserId)
+	}
+	logs, err := model.GetOrgLogs(member.OrgId, logType, startTimestamp, endTimestamp, modelName, username, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logs,
+	})
+	return
+}
@@ -1,12 +1,16 @@
 package controller
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"net/http"
 	"strconv"
 )
@@ -75,6 +79,37 @@ func GetRedemption(c *gin.Context) {
 	return
 }
 
+const maxRedemptionBatch = 1000
+
+func validateRedemption(redemption *model.Redemption) error {
+	if len(redemption.Name) == 0 || len(redemption.Name) > 20 {
+		return errors.New("兑换码名称长度必须在1-20之间")
+	}
+	if redemption.MaxUses <= 0 {
+		redemption.MaxUses = 1
+	}
+	if redemption.ExpiredTime == 0 {
+		redemption.ExpiredTime = -1
+	}
+	switch redemption.RewardType {
+	case "":
+		redemption.RewardType = model.RedemptionRewardQuota
+	case model.RedemptionRewardQuota, model.RedemptionRewardToken:
+	case model.RedemptionRewardGroup:
+		if _, ok := billingratio.GroupRatio[redemption.RewardGroup]; !ok {
+			return fmt.Errorf("分组 %s 不存在", redemption.RewardGroup)
+		}
+	default:
+		return fmt.Errorf("无效的兑换奖励类型：%s", redemption.RewardType)
+	}
+	if redemption.CampaignId != 0 {
+		if _, err := model.GetCampaignById(redemption.CampaignId); err != nil {
+			return errors.New("兑换码所属活动不存在")
+		}
+	}
+	return nil
+}
+
 func AddRedemption(c *gin.Context) {
 	redemption := model.Redemption{}
 	err := c.ShouldBindJSON(&redemption)
@@ -85,10 +120,11 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
-	if len(redemption.Name) == 0 || len(redemption.Name) > 20 {
+	err = validateRedemption(&redemption)
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "兑换码名称长度必须在1-20之间",
+			"message": err.Error(),
 		})
 		return
 	}
@@ -99,33 +135,61 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
-	if redemption.Count > 100 {
+	if redemption.Count > maxRedemptionBatch {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "一次兑换码批量生成的个数不能大于 100",
+			"message": fmt.Sprintf("一次兑换码批量生成的个数不能大于 %d", maxRedemptionBatch),
 		})
 		return
 	}
+	var redemptions []*model.Redemption
 	var keys []string
 	for i := 0; i < redemption.Count; i++ {
 		key := random.GetUUID()
-		cleanRedemption := model.Redemption{
+		redemptions = append(redemptions, &model.Redemption{
 			UserId:      c.GetInt(ctxkey.Id),
 			Name:        redemption.Name,
 			Key:         key,
 			CreatedTime: helper.GetTimestamp(),
 			Quota:       redemption.Quota,
-		}
-		err = cleanRedemption.Insert()
-		if err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": err.Error(),
-				"data":    keys,
+			ExpiredTime: redemption.ExpiredTime,
+			MaxUses:     redemption.MaxUses,
+			CampaignId:  redemption.CampaignId,
+			RewardType:  redemption.RewardType,
+			RewardGroup: redemption.RewardGroup,
+		})
+		keys = append(keys, key)
+	}
+	err = model.BatchInsertRedemptions(redemptions)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	for _, r := range redemptions {
+		recordAudit(c, "redemption.create", model.AuditTargetRedemption, r.Id, nil, r)
+	}
+	if c.Query("format") == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=redemptions-%d.csv", helper.GetTimestamp()))
+		writer := csv.NewWriter(c.Writer)
+		_ = writer.Write([]string{"key", "name", "reward_type", "quota", "reward_group", "max_uses", "expired_time", "campaign_id"})
+		for _, r := range redemptions {
+			_ = writer.Write([]string{
+				r.Key,
+				r.Name,
+				r.RewardType,
+				strconv.FormatInt(r.Quota, 10),
+				r.RewardGroup,
+				strconv.Itoa(r.MaxUses),
+				strconv.FormatInt(r.ExpiredTime, 10),
+				strconv.Itoa(r.CampaignId),
 			})
-			return
 		}
-		keys = append(keys, key)
+		writer.Flush()
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -137,7 +201,7 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	err := model.DeleteRedemptionById(id)
+	originRedemption, err := model.GetRedemptionById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -145,6 +209,15 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	err = model.DeleteRedemptionById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "redemption.delete", model.AuditTargetRedemption, id, originRedemption, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -171,12 +244,26 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	originRedemption := *cleanRedemption
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
+		err = validateRedemption(&redemption)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 		// If you add more fields, please also update redemption.Update()
 		cleanRedemption.Name = redemption.Name
 		cleanRedemption.Quota = redemption.Quota
+		cleanRedemption.ExpiredTime = redemption.ExpiredTime
+		cleanRedemption.MaxUses = redemption.MaxUses
+		cleanRedemption.CampaignId = redemption.CampaignId
+		cleanRedemption.RewardType = redemption.RewardType
+		cleanRedemption.RewardGroup = redemption.RewardGroup
 	}
 	err = cleanRedemption.Update()
 	if err != nil {
@@ -186,6 +273,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "redemption.update", model.AuditTargetRedemption, cleanRedemption.Id, originRedemption, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -193,3 +281,136 @@ func UpdateRedemption(c *gin.Context) {
 	})
 	return
 }
+
+func GetAllCampaigns(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	campaigns, err := model.GetAllCampaigns(p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    campaigns,
+	})
+	return
+}
+
+func validateCampaign(campaign *model.RedemptionCampaign) error {
+	if len(campaign.Name) == 0 || len(campaign.Name) > 64 {
+		return errors.New("活动名称长度必须在1-64之间")
+	}
+	if campaign.Budget < 0 {
+		return errors.New("活动预算不能为负数")
+	}
+	if campaign.ExpiredTime == 0 {
+		campaign.ExpiredTime = -1
+	}
+	return nil
+}
+
+func AddCampaign(c *gin.Context) {
+	campaign := model.RedemptionCampaign{}
+	err := c.ShouldBindJSON(&campaign)
+	if err == nil {
+		err = validateCampaign(&campaign)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanCampaign := model.RedemptionCampaign{
+		Name:        campaign.Name,
+		Status:      model.CampaignStatusEnabled,
+		Budget:      campaign.Budget,
+		ExpiredTime: campaign.ExpiredTime,
+	}
+	err = cleanCampaign.Insert()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "campaign.create", model.AuditTargetCampaign, cleanCampaign.Id, nil, cleanCampaign)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanCampaign,
+	})
+	return
+}
+
+func UpdateCampaign(c *gin.Context) {
+	campaign := model.RedemptionCampaign{}
+	err := c.ShouldBindJSON(&campaign)
+	if err == nil {
+		err = validateCampaign(&campaign)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	cleanCampaign, err := model.GetCampaignById(campaign.Id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	originCampaign := *cleanCampaign
+	cleanCampaign.Name = campaign.Name
+	cleanCampaign.Budget = campaign.Budget
+	cleanCampaign.ExpiredTime = campaign.ExpiredTime
+	if campaign.Status == model.CampaignStatusEnabled || campaign.Status == model.CampaignStatusDisabled {
+		cleanCampaign.Status = campaign.Status
+	}
+	err = cleanCampaign.Update()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "campaign.update", model.AuditTargetCampaign, cleanCampaign.Id, originCampaign, cleanCampaign)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    cleanCampaign,
+	})
+	return
+}
+
+func DeleteCampaign(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteCampaignById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "campaign.delete", model.AuditTargetCampaign, id, nil, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
@@ -13,17 +13,33 @@ import (
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/middleware"
 	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/monitor"
 	"github.com/songquanpeng/one-api/relay/controller"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // https://platform.openai.com/docs/api-reference/chat
 
-func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
+func relayHelper(c *gin.Context, relayMode int, attempt int) *model.ErrorWithStatusCode {
+	parentCtx := c.Request.Context()
+	ctx, span := tracing.Start(parentCtx, "relay_attempt",
+		tracing.Int("relay.attempt", attempt),
+		tracing.String("relay.mode", relaymode.Name(relayMode)),
+		tracing.Int("channel.id", c.GetInt(ctxkey.ChannelId)),
+		tracing.String("channel.name", c.GetString(ctxkey.ChannelName)),
+		tracing.String("model", c.GetString(ctxkey.OriginalModel)),
+	)
+	c.Request = c.Request.WithContext(ctx)
+	defer func() {
+		c.Request = c.Request.WithContext(parentCtx)
+		span.End()
+	}()
 	var err *model.ErrorWithStatusCode
 	switch relayMode {
 	case relaymode.ImagesGenerations:
@@ -37,6 +53,10 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 	default:
 		err = controller.RelayTextHelper(c)
 	}
+	if err != nil {
+		span.SetAttributes(tracing.Int("http.response.status_code", err.StatusCode))
+		span.SetStatus(codes.Error, err.Message)
+	}
 	return err
 }
 
@@ -49,11 +69,16 @@ func Relay(c *gin.Context) {
 	}
 	channelId := c.GetInt(ctxkey.ChannelId)
 	userId := c.GetInt("id")
-	bizErr := relayHelper(c, relayMode)
+	bizErr := relayHelper(c, relayMode, 0)
 	if bizErr == nil {
 		monitor.Emit(channelId, true)
 		return
 	}
+	if common.IsClientGone(c) {
+		// the error is caused by the client, neither retry nor blame the channel
+		logger.Warnf(ctx, "client cancelled the request: %s", bizErr.Message)
+		return
+	}
 	lastFailedChannelId := channelId
 	channelName := c.GetString(ctxkey.ChannelName)
 	group := c.GetString(ctxkey.Group)
@@ -75,13 +100,19 @@ func Relay(c *gin.Context) {
 		if channel.Id == lastFailedChannelId {
 			continue
 		}
+		metrics.RelayRetries.WithLabelValues(originalModel, group).Inc()
+		dbmodel.RelayStatsFromContext(ctx).AddRetry()
 		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
 		requestBody, err := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
-		bizErr = relayHelper(c, relayMode)
+		bizErr = relayHelper(c, relayMode, retryTimes-i+1)
 		if bizErr == nil {
 			return
 		}
+		if common.IsClientGone(c) {
+			logger.Warnf(ctx, "client cancelled the request: %s", bizErr.Message)
+			return
+		}
 		channelId := c.GetInt(ctxkey.ChannelId)
 		lastFailedChannelId = channelId
 		channelName := c.GetString(ctxkey.ChannelName)
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+)
+
+func GetSelfSessions(c *gin.Context) {
+	userSessions, err := model.GetUserSessions(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	currentId := c.GetInt(ctxkey.SessionId)
+	for _, session := range userSessions {
+		session.Current = session.Id == currentId
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    userSessions,
+	})
+	return
+}
+
+func DeleteSelfSession(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeleteSessionById(id, c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if id == c.GetInt(ctxkey.SessionId) {
+		session := sessions.Default(c)
+		session.Clear()
+		_ = session.Save()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+// DeleteSelfSessions logs the user out everywhere, including the current session
+func DeleteSelfSessions(c *gin.Context) {
+	err := model.DeleteUserSessions(c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	session := sessions.Default(c)
+	session.Clear()
+	_ = session.Save()
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// getStatementPeriod reads the billing period from either month (e.g. 2024-05) or
+// start_timestamp & end_timestamp, the current month is used by default
+func getStatementPeriod(c *gin.Context) (int64, int64, string, error) {
+	month := c.Query("month")
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	if month == "" && startTimestamp != 0 && endTimestamp != 0 {
+		if endTimestamp < startTimestamp {
+			return 0, 0, "", errors.New("结束时间不能早于开始时间")
+		}
+		label := fmt.Sprintf("%s_%s", time.Unix(startTimestamp, 0).Format("20060102"), time.Unix(endTimestamp, 0).Format("20060102"))
+		return startTimestamp, endTimestamp, label, nil
+	}
+	start := time.Now()
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+	if month != "" {
+		var err error
+		start, err = time.ParseInLocation("2006-01", month, time.Local)
+		if err != nil {
+			return 0, 0, "", errors.New("无效的账单月份")
+		}
+	}
+	end := start.AddDate(0, 1, 0)
+	return start.Unix(), end.Unix() - 1, start.Format("2006-01"), nil
+}
+
+func renderStatement(c *gin.Context, statement *model.Statement, label string) {
+	switch c.Query("format") {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=statement-%s-%s.csv", statement.Username, label))
+		// BOM for Excel
+		_, _ = c.Writer.Write([]byte("\xEF\xBB\xBF"))
+		writer := csv.NewWriter(c.Writer)
+		_ = writer.Write([]string{"day", "model_name", "token_name", "request_count", "prompt_tokens", "completion_tokens", "quota", "amount_usd"})
+		for _, line := range statement.Lines {
+			_ = writer.Write([]string{
+				line.Day,
+				line.ModelName,
+				line.TokenName,
+				strconv.FormatInt(line.RequestCount, 10),
+				strconv.FormatInt(line.PromptTokens, 10),
+				strconv.FormatInt(line.CompletionTokens, 10),
+				strconv.FormatInt(line.Quota, 10),
+				strconv.FormatFloat(line.Amount, 'f', 6, 64),
+			})
+		}
+		_ = writer.Write([]string{
+			"total", "", "",
+			strconv.FormatInt(statement.TotalRequests, 10),
+			strconv.FormatInt(statement.TotalPromptTokens, 10),
+			strconv.FormatInt(statement.TotalCompletionTokens, 10),
+			strconv.FormatInt(statement.TotalQuota, 10),
+			strconv.FormatFloat(statement.TotalAmount, 'f', 6, 64),
+		})
+		writer.Flush()
+	case "html":
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		err := statementTemplate.Execute(c.Writer, gin.H{
+			"Statement":  statement,
+			"Label":      label,
+			"SystemName": config.SystemName,
+		})
+		if err != nil {
+			_ = c.Error(err)
+		}
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    statement,
+		})
+	}
+}
+
+func GetSelfStatement(c *gin.Context) {
+	getStatement(c, c.GetInt(ctxkey.Id))
+}
+
+func GetUserStatement(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的用户 ID",
+		})
+		return
+	}
+	getStatement(c, userId)
+}
+
+func getStatement(c *gin.Context, userId int) {
+	startTimestamp, endTimestamp, label, err := getStatementPeriod(c)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	statement, err := model.GetUserStatement(userId, startTimestamp, endTimestamp)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	renderStatement(c, statement, label)
+}
+
+var statementTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"time": func(timestamp int64) string {
+		return time.Unix(timestamp, 0).Format("2006-01-02 15:04:05")
+	},
+	"amount": func(amount float64) string {
+		return fmt.Sprintf("$%.4f", amount)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.SystemName}} 账单 {{.Statement.Username}} {{.Label}}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 24px; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 24px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+td.num, th.num { text-align: right; }
+tfoot td { font-weight: bold; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h2>{{.SystemName}} 使用账单</h2>
+<p>用户：{{.Statement.Username}}（#{{.Statement.UserId}}）<br>
+账单周期：{{time .Statement.StartTimestamp}} 至 {{time .Statement.EndTimestamp}}<br>
+换算比例：{{.Statement.QuotaPerUnit}} 额度 = $1</p>
+<h3>消费明细</h3>
+<table>
+<thead><tr><th>日期</th><th>模型</th><th>令牌</th><th class="num">请求数</th><th class="num">提示 tokens</th><th class="num">补全 tokens</th><th class="num">额度</th><th class="num">金额</th></tr></thead>
+<tbody>
+{{range .Statement.Lines}}<tr><td>{{.Day}}</td><td>{{.ModelName}}</td><td>{{.TokenName}}</td><td class="num">{{.RequestCount}}</td><td class="num">{{.PromptTokens}}</td><td class="num">{{.CompletionTokens}}</td><td class="num">{{.Quota}}</td><td class="num">{{amount .Amount}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td colspan="3">合计</td><td class="num">{{.Statement.TotalRequests}}</td><td class="num">{{.Statement.TotalPromptTokens}}</td><td class="num">{{.Statement.TotalCompletionTokens}}</td><td class="num">{{.Statement.TotalQuota}}</td><td class="num">{{amount .Statement.TotalAmount}}</td></tr></tfoot>
+</table>
+<h3>充值记录</h3>
+<table>
+<thead><tr><th>时间</th><th>说明</th><th class="num">额度</th></tr></thead>
+<tbody>
+{{range .Statement.Topups}}<tr><td>{{time .CreatedAt}}</td><td>{{.Content}}</td><td class="num">{{.Quota}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td colspan="2">合计</td><td class="num">{{.Statement.TotalTopupQuota}}（{{amount .Statement.TotalTopupAmount}}）</td></tr></tfoot>
+</table>
+<h3>兑换码</h3>
+<table>
+<thead><tr><th>时间</th><th>名称</th><th class="num">额度</th><th class="num">金额</th></tr></thead>
+<tbody>
+{{range .Statement.Redemptions}}<tr><td>{{time .RedeemedTime}}</td><td>{{.Name}}</td><td class="num">{{.Quota}}</td><td class="num">{{amount .Amount}}</td></tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
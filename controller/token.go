@@ -7,7 +7,6 @@ import (
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/network"
-	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
 	"strconv"
@@ -117,6 +116,20 @@ func validateToken(c *gin.Context, token model.Token) error {
 			return fmt.Errorf("无效的网段：%s", err.Error())
 		}
 	}
+	if token.OrgId != 0 {
+		if _, err := model.GetOrgMember(token.OrgId, c.GetInt(ctxkey.Id)); err != nil {
+			return err
+		}
+	}
+	if err := token.QuotaAllowance.Validate(); err != nil {
+		return err
+	}
+	if err := token.TokenLimit.Validate(); err != nil {
+		return err
+	}
+	if err := token.TokenCapability.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -140,17 +153,22 @@ func AddToken(c *gin.Context) {
 	}
 
 	cleanToken := model.Token{
-		UserId:         c.GetInt(ctxkey.Id),
-		Name:           token.Name,
-		Key:            random.GenerateKey(),
-		CreatedTime:    helper.GetTimestamp(),
-		AccessedTime:   helper.GetTimestamp(),
-		ExpiredTime:    token.ExpiredTime,
-		RemainQuota:    token.RemainQuota,
-		UnlimitedQuota: token.UnlimitedQuota,
-		Models:         token.Models,
-		Subnet:         token.Subnet,
+		UserId:          c.GetInt(ctxkey.Id),
+		Name:            token.Name,
+		CreatedTime:     helper.GetTimestamp(),
+		AccessedTime:    helper.GetTimestamp(),
+		ExpiredTime:     token.ExpiredTime,
+		RemainQuota:     token.RemainQuota,
+		UnlimitedQuota:  token.UnlimitedQuota,
+		Models:          token.Models,
+		Subnet:          token.Subnet,
+		OrgId:           token.OrgId,
+		QuotaAllowance:  token.QuotaAllowance,
+		TokenLimit:      token.TokenLimit,
+		TokenCapability: token.TokenCapability,
 	}
+	// the allowance starts with the next period, the current one has the quota set on creation
+	cleanToken.LastQuotaResetTime = helper.GetTimestamp()
 	err = cleanToken.Insert()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -159,6 +177,7 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "token.create", model.AuditTargetToken, cleanToken.Id, nil, cleanToken)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -170,7 +189,15 @@ func AddToken(c *gin.Context) {
 func DeleteToken(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	userId := c.GetInt(ctxkey.Id)
-	err := model.DeleteTokenById(id, userId)
+	originToken, err := model.GetTokenByIds(id, userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = model.DeleteTokenById(id, userId)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -178,6 +205,7 @@ func DeleteToken(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "token.delete", model.AuditTargetToken, id, originToken, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -229,16 +257,28 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	originToken := *cleanToken
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
 		// If you add more fields, please also update token.Update()
+		if cleanToken.QuotaResetPeriod == "" && token.QuotaResetPeriod != "" {
+			// an allowance enabled now starts with the next period, so the remaining quota set along with it is kept
+			cleanToken.LastQuotaResetTime = helper.GetTimestamp()
+		}
 		cleanToken.Name = token.Name
 		cleanToken.ExpiredTime = token.ExpiredTime
 		cleanToken.RemainQuota = token.RemainQuota
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.OrgId = token.OrgId
+		cleanToken.QuotaResetPeriod = token.QuotaResetPeriod
+		cleanToken.QuotaResetAmount = token.QuotaResetAmount
+		cleanToken.QuotaResetAccrue = token.QuotaResetAccrue
+		cleanToken.QuotaAccrueCap = token.QuotaAccrueCap
+		cleanToken.TokenLimit = token.TokenLimit
+		cleanToken.TokenCapability = token.TokenCapability
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -248,6 +288,7 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "token.update", model.AuditTargetToken, cleanToken.Id, originToken, cleanToken)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -255,3 +296,52 @@ func UpdateToken(c *gin.Context) {
 	})
 	return
 }
+
+type rotateTokenRequest struct {
+	GracePeriod *int64 `json:"grace_period"` // unit is second, TokenRotationGracePeriod is used if not set
+}
+
+// the old key can't be kept valid for longer than this after a rotation
+const maxTokenRotationGracePeriod = 30 * 24 * 60 * 60
+
+func RotateToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	userId := c.GetInt(ctxkey.Id)
+	req := rotateTokenRequest{}
+	if c.Request.ContentLength > 0 {
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	gracePeriod := config.TokenRotationGracePeriod
+	if req.GracePeriod != nil {
+		gracePeriod = *req.GracePeriod
+	}
+	if gracePeriod < 0 || gracePeriod > maxTokenRotationGracePeriod {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "宽限期需在 0 到 30 天之间",
+		})
+		return
+	}
+	token, err := model.RotateTokenKey(id, userId, gracePeriod)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	recordAudit(c, "token.rotate", model.AuditTargetToken, id, nil, gin.H{"key": token.RawKey, "grace_period": gracePeriod})
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    token,
+	})
+	return
+}
@@ -0,0 +1,345 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/totp"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"time"
+)
+
+// a password or oauth login waiting for the second step expires after this many seconds
+const twoFactorPendingTimeout = 5 * 60
+
+type TwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+// requireTwoFactor holds the login back when a second factor is needed,
+// the session only remembers the pending user until the second step succeeds
+func requireTwoFactor(user *model.User, c *gin.Context) bool {
+	enabled := model.IsTwoFactorEnabled(user.Id)
+	setupRequired := !enabled && config.AdminTwoFactorEnabled && user.Role >= model.RoleAdminUser
+	if !enabled && !setupRequired {
+		return false
+	}
+	session := sessions.Default(c)
+	session.Delete("id")
+	session.Delete("username")
+	session.Delete("role")
+	session.Delete("status")
+	session.Set("two_factor_user_id", user.Id)
+	session.Set("two_factor_nonce", random.GetUUID())
+	session.Set("two_factor_time", helper.GetTimestamp())
+	session.Set("two_factor_setup", setupRequired)
+	err := session.Save()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无法保存会话信息，请重试",
+			"success": false,
+		})
+		return true
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "",
+		"success": true,
+		"data": gin.H{
+			"require_two_factor":       enabled,
+			"require_two_factor_setup": setupRequired,
+		},
+	})
+	return true
+}
+
+func getPendingTwoFactorUserId(c *gin.Context, setup bool) (int, error) {
+	session := sessions.Default(c)
+	id, ok := session.Get("two_factor_user_id").(int)
+	if !ok || id == 0 {
+		return 0, errors.New("请先登录")
+	}
+	pendingTime, _ := session.Get("two_factor_time").(int64)
+	if helper.GetTimestamp()-pendingTime > twoFactorPendingTimeout {
+		return 0, errors.New("登录已过期，请重新登录")
+	}
+	pendingSetup, _ := session.Get("two_factor_setup").(bool)
+	if pendingSetup != setup {
+		return 0, errors.New("无效的请求")
+	}
+	nonce, _ := session.Get("two_factor_nonce").(string)
+	if nonce == "" {
+		return 0, errors.New("请先登录")
+	}
+	failures, err := model.GetPendingTwoFactorFailures(nonce)
+	if err != nil {
+		return 0, err
+	}
+	if failures >= model.TwoFactorMaxPendingFailures {
+		clearPendingTwoFactor(session)
+		return 0, errors.New("验证失败次数过多，请重新登录")
+	}
+	return id, nil
+}
+
+func clearPendingTwoFactor(session sessions.Session) {
+	session.Delete("two_factor_user_id")
+	session.Delete("two_factor_nonce")
+	session.Delete("two_factor_time")
+	session.Delete("two_factor_setup")
+	_ = session.Save()
+}
+
+// recordTwoFactorFailure counts a wrong code, the pending login is dropped after too many of them
+func recordTwoFactorFailure(c *gin.Context, userId int, err error) error {
+	var throttledErr *model.LoginThrottledError
+	if errors.As(err, &throttledErr) {
+		if !throttledErr.Locked {
+			// the code wasn't checked, the user only has to wait
+			return err
+		}
+		if user, err := model.GetUserById(userId, false); err == nil {
+			recordLoginAudit(c, user, "user.locked")
+		}
+	}
+	session := sessions.Default(c)
+	nonce, _ := session.Get("two_factor_nonce").(string)
+	failures, countErr := model.AddPendingTwoFactorFailure(nonce, twoFactorPendingTimeout*time.Second)
+	if countErr != nil {
+		return countErr
+	}
+	if failures >= model.TwoFactorMaxPendingFailures {
+		clearPendingTwoFactor(session)
+		return errors.New("验证失败次数过多，请重新登录")
+	}
+	return err
+}
+
+func finishTwoFactorLogin(userId int, c *gin.Context) (*model.User, error) {
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != model.UserStatusEnabled {
+		return nil, errors.New("用户已被封禁")
+	}
+	session := sessions.Default(c)
+	session.Delete("two_factor_user_id")
+	session.Delete("two_factor_nonce")
+	session.Delete("two_factor_time")
+	session.Delete("two_factor_setup")
+	err = saveLoginSession(user, c)
+	if err != nil {
+		return nil, errors.New("无法保存会话信息，请重试")
+	}
+	if user.FailedLoginCount != 0 || user.LockedUntil != 0 {
+		model.ClearLoginFailures(user.Id)
+	}
+	return user, nil
+}
+
+// LoginTwoFactor is the second step of a login of a user with two-factor authentication
+func LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无效的参数",
+			"success": false,
+		})
+		return
+	}
+	userId, err := getPendingTwoFactorUserId(c, false)
+	if err == nil {
+		err = model.VerifyTwoFactorLogin(userId, req.Code)
+		if err != nil {
+			err = recordTwoFactorFailure(c, userId, err)
+		}
+	}
+	var user *model.User
+	if err == nil {
+		user, err = finishTwoFactorLogin(userId, c)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"message": err.Error(),
+			"success": false,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "",
+		"success": true,
+		"data":    cleanLoginUser(user),
+	})
+}
+
+// getTwoFactorSetupUserId allows enrollment for logged-in users and for admins
+// whose login is pending because two-factor authentication is enforced
+func getTwoFactorSetupUserId(c *gin.Context) (int, bool, error) {
+	session := sessions.Default(c)
+	if id, ok := session.Get("id").(int); ok && id != 0 {
+		return id, false, nil
+	}
+	id, err := getPendingTwoFactorUserId(c, true)
+	return id, true, err
+}
+
+func SetupTwoFactor(c *gin.Context) {
+	userId, _, err := getTwoFactorSetupUserId(c)
+	var user *model.User
+	if err == nil {
+		user, err = model.GetUserById(userId, false)
+	}
+	var twoFactor *model.TwoFactor
+	if err == nil {
+		twoFactor, err = model.SetupTwoFactor(userId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret": twoFactor.Secret,
+			"uri":    totp.URI(config.SystemName, user.Username, twoFactor.Secret),
+		},
+	})
+	return
+}
+
+func EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	userId, pending, err := getTwoFactorSetupUserId(c)
+	var codes []string
+	if err == nil {
+		codes, err = model.EnableTwoFactor(userId, req.Code)
+	}
+	data := gin.H{
+		"recovery_codes": codes,
+	}
+	if err == nil && pending {
+		var user *model.User
+		user, err = finishTwoFactorLogin(userId, c)
+		if err == nil {
+			data["user"] = cleanLoginUser(user)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+	return
+}
+
+func GetSelfTwoFactor(c *gin.Context) {
+	data := gin.H{
+		"enabled":                  false,
+		"recovery_codes_remaining": 0,
+		"required":                 config.AdminTwoFactorEnabled && c.GetInt(ctxkey.Role) >= model.RoleAdminUser,
+	}
+	twoFactor, err := model.GetTwoFactor(c.GetInt(ctxkey.Id))
+	if err == nil && twoFactor.Enabled {
+		data["enabled"] = true
+		data["recovery_codes_remaining"] = twoFactor.RemainingRecoveryCodes()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+	return
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	if config.AdminTwoFactorEnabled && c.GetInt(ctxkey.Role) >= model.RoleAdminUser {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "管理员必须启用两步验证",
+		})
+		return
+	}
+	userId := c.GetInt(ctxkey.Id)
+	err = model.VerifyTwoFactor(userId, req.Code)
+	if err == nil {
+		err = model.DeleteTwoFactor(userId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorRequest
+	err := json.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil || req.Code == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	userId := c.GetInt(ctxkey.Id)
+	var codes []string
+	err = model.VerifyTwoFactor(userId, req.Code)
+	if err == nil {
+		codes, err = model.RegenerateRecoveryCodes(userId)
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    codes,
+	})
+	return
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestLoginTwoFactorFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t, &model.User{}, &model.TwoFactor{}, &model.Log{}, &model.AuditLog{}, &model.Session{})
+	config.LoginLockoutThreshold = 10
+	hashedPassword, _ := common.Password2Hash("12345678")
+	user := model.User{Username: "alice", Password: hashedPassword, Status: model.UserStatusEnabled, Role: model.RoleCommonUser}
+	if err := model.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := model.DB.Create(&model.TwoFactor{UserId: user.Id, Secret: "JBSWY3DPEHPK3PXP", Enabled: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	server := gin.New()
+	server.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	server.POST("/api/user/login", Login)
+	server.POST("/api/user/login/2fa", LoginTwoFactor)
+	post := func(path string, body any, cookies []*http.Cookie) (string, []*http.Cookie) {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		var resp struct {
+			Message string `json:"message"`
+		}
+		So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+		return resp.Message, w.Result().Cookies()
+	}
+
+	Convey("a pending login is dropped after too many wrong codes, even if the cookie is replayed", t, func() {
+		_, pending := post("/api/user/login", LoginRequest{Username: "alice", Password: "12345678"}, nil)
+		So(pending, ShouldNotBeEmpty)
+		// skips the delay of the attempts after a few failures
+		skipDelay := func() {
+			model.DB.Model(&model.User{}).Where("id = ?", user.Id).Update("last_failed_login_time", time.Now().Unix()-100)
+		}
+		for i := 0; i < model.TwoFactorMaxPendingFailures-1; i++ {
+			skipDelay()
+			message, _ := post("/api/user/login/2fa", TwoFactorRequest{Code: "000000"}, pending)
+			So(message, ShouldEqual, "验证码错误")
+		}
+		skipDelay()
+		message, _ := post("/api/user/login/2fa", TwoFactorRequest{Code: "000000"}, pending)
+		So(message, ShouldEqual, "验证失败次数过多，请重新登录")
+		skipDelay()
+		message, _ = post("/api/user/login/2fa", TwoFactorRequest{Code: "000000"}, pending)
+		So(message, ShouldEqual, "验证失败次数过多，请重新登录")
+
+		var failures int
+		model.DB.Model(&model.User{}).Where("id = ?", user.Id).Select("failed_login_count").Scan(&failures)
+		So(failures, ShouldEqual, model.TwoFactorMaxPendingFailures)
+	})
+}
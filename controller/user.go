@@ -2,10 +2,13 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
@@ -53,8 +56,20 @@ func Login(c *gin.Context) {
 	}
 	err = user.ValidateAndFill()
 	if err != nil {
+		message := err.Error()
+		var throttledErr *model.LoginThrottledError
+		if errors.As(err, &throttledErr) {
+			if throttledErr.Locked {
+				recordLoginAudit(c, &user, "user.locked")
+			}
+			// a locked or throttled account answers like a wrong password, so it can't be used
+			// to find out which accounts exist, the owner is notified when it gets locked
+			message = model.InvalidLoginMessage
+		} else if user.Id != 0 {
+			recordLoginAudit(c, &user, "user.login_failed")
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"message": err.Error(),
+			"message": message,
 			"success": false,
 		})
 		return
@@ -64,12 +79,17 @@ func Login(c *gin.Context) {
 
 // setup session & cookies and then return user info
 func SetupLogin(user *model.User, c *gin.Context) {
-	session := sessions.Default(c)
-	session.Set("id", user.Id)
-	session.Set("username", user.Username)
-	session.Set("role", user.Role)
-	session.Set("status", user.Status)
-	err := session.Save()
+	if blacklist.IsUserBanned(user.Id) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "用户已被封禁",
+			"success": false,
+		})
+		return
+	}
+	if requireTwoFactor(user, c) {
+		return
+	}
+	err := saveLoginSession(user, c)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "无法保存会话信息，请重试",
@@ -77,22 +97,53 @@ func SetupLogin(user *model.User, c *gin.Context) {
 		})
 		return
 	}
-	cleanUser := model.User{
+	c.JSON(http.StatusOK, gin.H{
+		"message": "",
+		"success": true,
+		"data":    cleanLoginUser(user),
+	})
+}
+
+func saveLoginSession(user *model.User, c *gin.Context) error {
+	key, err := model.CreateSession(user.Id, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return err
+	}
+	session := sessions.Default(c)
+	session.Set("sid", key)
+	session.Set("id", user.Id)
+	session.Set("username", user.Username)
+	session.Set("role", user.Role)
+	session.Set("status", user.Status)
+	return session.Save()
+}
+
+func cleanLoginUser(user *model.User) model.User {
+	return model.User{
 		Id:          user.Id,
 		Username:    user.Username,
 		DisplayName: user.DisplayName,
 		Role:        user.Role,
 		Status:      user.Status,
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"message": "",
-		"success": true,
-		"data":    cleanUser,
-	})
+}
+
+// hideCredentials blanks the access token of the users when the caller authenticated with
+// a management token, a scoped token must not be able to read a full-authority credential
+func hideCredentials(c *gin.Context, users ...*model.User) {
+	if c.GetInt(ctxkey.ManagementTokenId) == 0 {
+		return
+	}
+	for _, user := range users {
+		user.AccessToken = ""
+	}
 }
 
 func Logout(c *gin.Context) {
 	session := sessions.Default(c)
+	if key, ok := session.Get("sid").(string); ok {
+		_ = model.DeleteSessionByKey(key)
+	}
 	session.Clear()
 	err := session.Save()
 	if err != nil {
@@ -139,6 +190,13 @@ func Register(c *gin.Context) {
 		})
 		return
 	}
+	if err := model.ValidatePasswordPolicy(user.Password); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if config.EmailVerificationEnabled {
 		if user.Email == "" || user.VerificationCode == "" {
 			c.JSON(http.StatusOK, gin.H{
@@ -197,6 +255,7 @@ func GetAllUsers(c *gin.Context) {
 		})
 		return
 	}
+	hideCredentials(c, users...)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -215,6 +274,7 @@ func SearchUsers(c *gin.Context) {
 		})
 		return
 	}
+	hideCredentials(c, users...)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -248,6 +308,7 @@ func GetUser(c *gin.Context) {
 		})
 		return
 	}
+	hideCredentials(c, user)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -353,6 +414,7 @@ func GetSelf(c *gin.Context) {
 		})
 		return
 	}
+	hideCredentials(c, user)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -381,7 +443,7 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
-	originUser, err := model.GetUserById(updatedUser.Id, false)
+	originUser, err := model.GetUserById(updatedUser.Id, true)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -404,9 +466,31 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := updatedUser.QuotaAllowance.Validate(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
+	} else if err := model.ValidatePasswordPolicy(updatedUser.Password); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	// maintained by the system only
+	updatedUser.LastQuotaResetTime = 0
+	if originUser.QuotaResetPeriod == "" && updatedUser.QuotaResetPeriod != "" {
+		// an allowance enabled now starts with the next period, so the quota set along with it is kept
+		updatedUser.LastQuotaResetTime = helper.GetTimestamp()
 	}
+	updatedUser.FailedLoginCount = 0
+	updatedUser.LastFailedLoginTime = 0
+	updatedUser.LockedUntil = 0
 	updatePassword := updatedUser.Password != ""
 	if err := updatedUser.Update(updatePassword); err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -415,9 +499,19 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := updatedUser.UpdateQuotaAllowance(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
+	if user, err := model.GetUserById(updatedUser.Id, true); err == nil {
+		recordAudit(c, "user.update", model.AuditTargetUser, user.Id, originUser, user)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -455,6 +549,12 @@ func UpdateSelf(c *gin.Context) {
 	if user.Password == "$I_LOVE_U" {
 		user.Password = "" // rollback to what it should be
 		cleanUser.Password = ""
+	} else if err := model.ValidatePasswordPolicy(user.Password); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
 	}
 	updatePassword := user.Password != ""
 	if err := cleanUser.Update(updatePassword); err != nil {
@@ -500,11 +600,17 @@ func DeleteUser(c *gin.Context) {
 	err = model.DeleteUserById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"message": "",
+			"success": false,
+			"message": err.Error(),
 		})
 		return
 	}
+	recordAudit(c, "user.delete", model.AuditTargetUser, id, originUser, nil)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+	return
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -551,6 +657,13 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	if err := model.ValidatePasswordPolicy(user.Password); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	if user.DisplayName == "" {
 		user.DisplayName = user.Username
 	}
@@ -575,6 +688,7 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, "user.create", model.AuditTargetUser, cleanUser.Id, nil, cleanUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -620,6 +734,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	originUser := user
 	switch req.Action {
 	case "disable":
 		user.Status = model.UserStatusDisabled
@@ -679,6 +794,24 @@ func ManageUser(c *gin.Context) {
 			return
 		}
 		user.Role = model.RoleCommonUser
+	case "reset_2fa":
+		if err := model.DeleteTwoFactor(user.Id); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "unlock":
+		model.ClearLoginFailures(user.Id)
+	case "logout":
+		if err := model.DeleteUserSessions(user.Id); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 
 	if err := user.Update(false); err != nil {
@@ -692,6 +825,7 @@ func ManageUser(c *gin.Context) {
 		Role:   user.Role,
 		Status: user.Status,
 	}
+	recordAudit(c, "user."+req.Action, model.AuditTargetUser, user.Id, model.User{Role: originUser.Role, Status: originUser.Status}, clearUser)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -757,7 +891,7 @@ func TopUp(c *gin.Context) {
 		return
 	}
 	id := c.GetInt("id")
-	quota, err := model.Redeem(req.Key, id)
+	redemption, err := model.Redeem(req.Key, id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -765,10 +899,21 @@ func TopUp(c *gin.Context) {
 		})
 		return
 	}
+	var data any
+	message := ""
+	switch redemption.RewardType {
+	case model.RedemptionRewardGroup:
+		message = fmt.Sprintf("已升级至分组 %s", redemption.RewardGroup)
+	case model.RedemptionRewardToken:
+		message = fmt.Sprintf("已为您创建令牌「%s」，请妥善保存，密钥仅显示一次", redemption.Name)
+		data = "sk-" + redemption.RewardKey
+	default:
+		data = redemption.Quota
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "",
-		"data":    quota,
+		"message": message,
+		"data":    data,
 	})
 	return
 }
@@ -801,6 +946,7 @@ func AdminTopUp(c *gin.Context) {
 		req.Remark = fmt.Sprintf("通过 API 充值 %s", common.LogQuota(int64(req.Quota)))
 	}
 	model.RecordTopupLog(req.UserId, req.Remark, req.Quota)
+	recordAudit(c, "user.topup", model.AuditTargetUser, req.UserId, nil, req)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
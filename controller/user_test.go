@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/middleware"
+	"github.com/songquanpeng/one-api/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T, models ...any) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	model.DB, model.LOG_DB = db, db
+	common.RedisEnabled = false
+}
+
+func TestGetSelfWithManagementToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setupTestDB(t, &model.User{}, &model.ManagementToken{})
+	user := model.User{Username: "alice", Password: "12345678", Status: model.UserStatusEnabled, Role: model.RoleCommonUser, AccessToken: "legacy-full-authority-token"}
+	if err := model.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := model.ManagementToken{UserId: user.Id, Name: "readonly", Scopes: model.ScopeUserRead, ExpiredTime: -1}
+	key, err := token.Insert()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := gin.New()
+	server.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	server.GET("/api/user/self", middleware.UserAuth(), GetSelf)
+	getSelf := func(authorization string) map[string]any {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/self", nil)
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		var resp struct {
+			Success bool           `json:"success"`
+			Data    map[string]any `json:"data"`
+		}
+		So(json.Unmarshal(w.Body.Bytes(), &resp), ShouldBeNil)
+		So(resp.Success, ShouldBeTrue)
+		return resp.Data
+	}
+
+	Convey("a scoped management token can't read the access token", t, func() {
+		data := getSelf("Bearer " + key)
+		So(data["username"], ShouldEqual, "alice")
+		So(data["access_token"], ShouldEqual, "")
+		So(data["password"], ShouldEqual, "")
+	})
+	Convey("the access token itself still sees it", t, func() {
+		data := getSelf(user.AccessToken)
+		So(data["access_token"], ShouldEqual, user.AccessToken)
+	})
+}
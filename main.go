@@ -11,6 +11,7 @@ import (
 	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
@@ -48,6 +49,20 @@ func main() {
 	} else {
 		model.LOG_DB = model.DB
 	}
+	err = model.InitTokenKeys()
+	if err != nil {
+		logger.FatalLog("failed to initialize token keys: " + err.Error())
+	}
+	if config.BreachedPasswordFile != "" {
+		err = model.LoadBreachedPasswords(config.BreachedPasswordFile)
+		if err != nil {
+			logger.SysError("failed to load breached passwords: " + err.Error())
+		}
+	}
+	err = model.InitSessionSecret()
+	if err != nil {
+		logger.FatalLog("failed to initialize session secret: " + err.Error())
+	}
 	err = model.CreateRootAccountIfNeed()
 	if err != nil {
 		logger.FatalLog("database init error: " + err.Error())
@@ -77,6 +92,17 @@ func main() {
 		logger.SysLog(fmt.Sprintf("sync frequency: %d seconds", config.SyncFrequency))
 		model.InitChannelCache()
 	}
+	err = model.LoadBans()
+	if err != nil {
+		logger.FatalLog("failed to load bans: " + err.Error())
+	}
+	go model.SyncBans(config.SyncFrequency)
+	go model.SyncChannelLatencies(60)
+	go model.SyncUsageRollups(60)
+	if config.IsMasterNode {
+		go model.CleanPayloadCaptures(3600)
+		go model.SyncLogRetention(3600)
+	}
 	if config.MemoryCacheEnabled {
 		go model.SyncOptions(config.SyncFrequency)
 		go model.SyncChannelCache(config.SyncFrequency)
@@ -97,6 +123,7 @@ func main() {
 		logger.SysLog("metric enabled, will disable channel if too much request failed")
 	}
 	openai.InitTokenEncoders()
+	tracing.Init()
 	client.Init()
 
 	// Initialize HTTP server
@@ -111,6 +138,18 @@ func main() {
 	server.Use(sessions.Sessions("session", store))
 
 	router.SetRouter(server, buildFS)
+	if config.MetricsAddress != "" {
+		go func() {
+			metricsServer := gin.New()
+			metricsServer.Use(gin.Recovery())
+			router.SetMetricsRouter(metricsServer)
+			logger.SysLogf("metrics server started on %s", config.MetricsAddress)
+			err := metricsServer.Run(config.MetricsAddress)
+			if err != nil {
+				logger.FatalLog("failed to start metrics server: " + err.Error())
+			}
+		}()
+	}
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
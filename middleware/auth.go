@@ -1,12 +1,15 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/blacklist"
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/model"
 	"net/http"
 	"strings"
@@ -18,6 +21,21 @@ func authHelper(c *gin.Context, minRole int) {
 	role := session.Get("role")
 	id := session.Get("id")
 	status := session.Get("status")
+	if username != nil {
+		key, _ := session.Get("sid").(string)
+		serverSession, err := model.ValidateSession(key)
+		if err != nil {
+			session.Clear()
+			_ = session.Save()
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"success": false,
+				"message": "无权进行此操作，" + err.Error() + "，请重新登录",
+			})
+			c.Abort()
+			return
+		}
+		c.Set(ctxkey.SessionId, serverSession.Id)
+	}
 	if username == nil {
 		// Check access token
 		accessToken := c.Request.Header.Get("Authorization")
@@ -29,8 +47,22 @@ func authHelper(c *gin.Context, minRole int) {
 			c.Abort()
 			return
 		}
-		user := model.ValidateAccessToken(accessToken)
-		if user != nil && user.Username != "" {
+		accessToken = strings.TrimPrefix(accessToken, "Bearer ")
+		if model.IsManagementTokenKey(accessToken) {
+			user, err := managementTokenAuth(c, accessToken)
+			if err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "无权进行此操作，" + err.Error(),
+				})
+				c.Abort()
+				return
+			}
+			username = user.Username
+			role = user.Role
+			id = user.Id
+			status = user.Status
+		} else if user := model.ValidateAccessToken(accessToken); user != nil && user.Username != "" {
 			// Token is valid
 			username = user.Username
 			role = user.Role
@@ -91,6 +123,12 @@ func RootAuth() func(c *gin.Context) {
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
+		_, span := tracing.Start(ctx, "token_auth")
+		defer endStageSpan(c, span)
+		if blacklist.IsIpBanned(c.ClientIP()) {
+			abortWithMessage(c, http.StatusForbidden, "该 IP 已被封禁")
+			return
+		}
 		key := c.Request.Header.Get("Authorization")
 		key = strings.TrimPrefix(key, "Bearer ")
 		key = strings.TrimPrefix(key, "sk-")
@@ -116,12 +154,23 @@ func TokenAuth() func(c *gin.Context) {
 			abortWithMessage(c, http.StatusForbidden, "用户已被封禁")
 			return
 		}
+		if !checkTokenRelayMode(c, token) {
+			return
+		}
 		requestModel, err := getRequestModel(c)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			abortWithMessage(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("请求体大小超过令牌限制 %d 字节", token.MaxBodySize))
+			return
+		}
 		if err != nil && shouldCheckModel(c) {
 			abortWithMessage(c, http.StatusBadRequest, err.Error())
 			return
 		}
 		c.Set(ctxkey.RequestModel, requestModel)
+		if !checkTokenCapability(c, token) {
+			return
+		}
 		if token.Models != nil && *token.Models != "" {
 			c.Set(ctxkey.AvailableModels, *token.Models)
 			if requestModel != "" && !isModelInList(requestModel, *token.Models) {
@@ -129,9 +178,26 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		if token.OrgId != 0 {
+			org, err := model.ValidateOrgToken(token)
+			if err != nil {
+				abortWithMessage(c, http.StatusForbidden, err.Error())
+				return
+			}
+			if requestModel != "" && !org.AllowsModel(requestModel) {
+				abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌所属组织无权使用模型：%s", requestModel))
+				return
+			}
+			if org.Models != "" && (token.Models == nil || *token.Models == "") {
+				c.Set(ctxkey.AvailableModels, org.Models)
+			}
+			c.Set(ctxkey.OrgId, org.Id)
+			c.Request = c.Request.WithContext(model.WithOrgId(c.Request.Context(), org.Id))
+		}
 		c.Set(ctxkey.Id, token.UserId)
 		c.Set(ctxkey.TokenId, token.Id)
 		c.Set(ctxkey.TokenName, token.Name)
+		c.Request = c.Request.WithContext(logger.WithFields(c.Request.Context(), "user_id", token.UserId, "token_id", token.Id))
 		if len(parts) > 1 {
 			if model.IsAdmin(token.UserId) {
 				c.Set(ctxkey.SpecificChannelId, parts[1])
@@ -140,6 +206,23 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		err = model.CheckAndCountTokenRequest(token)
+		if err != nil {
+			var limitErr *model.TokenLimitExceededError
+			if errors.As(err, &limitErr) {
+				abortWithTokenLimitExceeded(c, limitErr)
+				return
+			}
+			abortWithMessage(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		span.SetAttributes(
+			tracing.Int("token.id", token.Id),
+			tracing.String("token.name", token.Name),
+			tracing.Int("user.id", token.UserId),
+			tracing.String("model", requestModel),
+		)
+		span.End()
 		c.Next()
 	}
 }
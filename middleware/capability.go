@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// capabilityRequest holds the request fields restricted by TokenCapability
+type capabilityRequest struct {
+	MaxTokens           int               `json:"max_tokens"`
+	MaxCompletionTokens int               `json:"max_completion_tokens"`
+	N                   int               `json:"n"`
+	Stream              bool              `json:"stream"`
+	Tools               []json.RawMessage `json:"tools"`
+	Functions           []json.RawMessage `json:"functions"`
+	Messages            []struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+func (request *capabilityRequest) hasImage() bool {
+	for _, message := range request.Messages {
+		var parts []struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(message.Content, &parts) != nil {
+			continue
+		}
+		for _, part := range parts {
+			if part.Type == "image_url" || part.Type == "image" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkTokenRelayMode checks the endpoint and body size, it must run before the body is read
+func checkTokenRelayMode(c *gin.Context, token *model.Token) bool {
+	mode := relaymode.GetByPath(c.Request.URL.Path)
+	if !token.AllowsRelayMode(mode) {
+		abortWithMessage(c, http.StatusForbidden, fmt.Sprintf("该令牌无权调用此接口：%s", relaymode.Name(mode)))
+		return false
+	}
+	if token.MaxBodySize > 0 {
+		if c.Request.ContentLength > token.MaxBodySize {
+			abortWithMessage(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("请求体大小超过令牌限制 %d 字节", token.MaxBodySize))
+			return false
+		}
+		// the content length may be unknown, so reading is limited as well
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, token.MaxBodySize)
+	}
+	return true
+}
+
+// checkTokenCapability checks the request body against the token's restrictions
+func checkTokenCapability(c *gin.Context, token *model.Token) bool {
+	if !token.RestrictsBody() || !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return true
+	}
+	var request capabilityRequest
+	err := common.UnmarshalBodyReusable(c, &request)
+	if err != nil {
+		abortWithMessage(c, http.StatusBadRequest, "无效的请求体："+err.Error())
+		return false
+	}
+	maxTokens := request.MaxTokens
+	if request.MaxCompletionTokens > maxTokens {
+		maxTokens = request.MaxCompletionTokens
+	}
+	if token.MaxTokensLimit > 0 && maxTokens == 0 {
+		// without max_tokens the upstream default applies, which can be above the limit
+		err = limitMaxTokens(c, token.MaxTokensLimit)
+		if err != nil {
+			abortWithMessage(c, http.StatusBadRequest, "无效的请求体："+err.Error())
+			return false
+		}
+	}
+	var message string
+	switch {
+	case token.MaxTokensLimit > 0 && maxTokens > token.MaxTokensLimit:
+		message = fmt.Sprintf("max_tokens 不能超过令牌限制 %d", token.MaxTokensLimit)
+	case token.MaxN > 0 && request.N > token.MaxN:
+		message = fmt.Sprintf("n 不能超过令牌限制 %d", token.MaxN)
+	case token.StreamDisabled && request.Stream:
+		message = "该令牌不允许使用流式输出"
+	case token.ToolsDisabled && (len(request.Tools) > 0 || len(request.Functions) > 0):
+		message = "该令牌不允许使用工具调用"
+	case token.VisionDisabled && request.hasImage():
+		message = "该令牌不允许输入图片"
+	}
+	if message != "" {
+		abortWithMessage(c, http.StatusForbidden, message)
+		return false
+	}
+	return true
+}
+
+// limitMaxTokens sets max_tokens of a completion request that doesn't specify it
+func limitMaxTokens(c *gin.Context, limit int) error {
+	mode := relaymode.GetByPath(c.Request.URL.Path)
+	if mode != relaymode.ChatCompletions && mode != relaymode.Completions {
+		return nil
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	var request map[string]json.RawMessage
+	err = json.Unmarshal(requestBody, &request)
+	if err != nil {
+		return err
+	}
+	request["max_tokens"], _ = json.Marshal(limit)
+	requestBody, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	c.Set(common.KeyRequestBody, requestBody)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	c.Request.ContentLength = int64(len(requestBody))
+	return nil
+}
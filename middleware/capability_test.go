@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func TestCheckTokenCapabilityMaxTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	token := &model.Token{TokenCapability: model.TokenCapability{MaxTokensLimit: 100}}
+	check := func(path string, body string) (bool, int, map[string]any) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		ok := checkTokenCapability(c, token)
+		forwarded, _ := io.ReadAll(c.Request.Body)
+		var request map[string]any
+		_ = json.Unmarshal(forwarded, &request)
+		return ok, w.Code, request
+	}
+
+	Convey("max_tokens above the limit is rejected", t, func() {
+		ok, code, _ := check("/v1/chat/completions", `{"model":"gpt-4o","max_tokens":200}`)
+		So(ok, ShouldBeFalse)
+		So(code, ShouldEqual, http.StatusForbidden)
+		ok, _, _ = check("/v1/chat/completions", `{"model":"gpt-4o","max_completion_tokens":200}`)
+		So(ok, ShouldBeFalse)
+	})
+	Convey("max_tokens within the limit is forwarded as is", t, func() {
+		ok, _, request := check("/v1/chat/completions", `{"model":"gpt-4o","max_tokens":50}`)
+		So(ok, ShouldBeTrue)
+		So(request["max_tokens"], ShouldEqual, 50)
+	})
+	Convey("an omitted max_tokens is set to the limit", t, func() {
+		ok, _, request := check("/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+		So(ok, ShouldBeTrue)
+		So(request["max_tokens"], ShouldEqual, 100)
+		So(request["model"], ShouldEqual, "gpt-4o")
+		So(request["messages"], ShouldHaveLength, 1)
+		ok, _, request = check("/v1/completions", `{"model":"gpt-3.5-turbo-instruct","prompt":"hi"}`)
+		So(ok, ShouldBeTrue)
+		So(request["max_tokens"], ShouldEqual, 100)
+	})
+	Convey("requests without max_tokens on other endpoints are not changed", t, func() {
+		ok, _, request := check("/v1/embeddings", `{"model":"text-embedding-3-small","input":"hi"}`)
+		So(ok, ShouldBeTrue)
+		So(request, ShouldNotContainKey, "max_tokens")
+	})
+}
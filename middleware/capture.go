@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"io"
+	"strings"
+)
+
+// captureWriter keeps a copy of the response written to the client, up to limit bytes
+type captureWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *captureWriter) keep(data []byte) {
+	remaining := w.limit - w.body.Len()
+	if len(data) > remaining {
+		data = data[:remaining]
+		w.truncated = true
+	}
+	w.body.Write(data)
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.keep(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func isTextualContent(contentType string) bool {
+	return contentType == "" ||
+		strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json")
+}
+
+// capturedBody redacts a captured body, binary bodies are only recorded by size
+func capturedBody(contentType string, body []byte, size int64) (string, bool) {
+	if !isTextualContent(contentType) {
+		return fmt.Sprintf("[%s body omitted, %d bytes]", contentType, size), false
+	}
+	return model.RedactCapturedBody(body)
+}
+
+// PayloadCapture records the request and response of tokens and channels selected by the capture options
+func PayloadCapture() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		tokenId := c.GetInt(ctxkey.TokenId)
+		if !model.ShouldCapture(tokenId, c.GetInt(ctxkey.ChannelId)) {
+			c.Next()
+			return
+		}
+		requestContentType := c.Request.Header.Get("Content-Type")
+		var requestBody []byte
+		if isTextualContent(requestContentType) {
+			var err error
+			requestBody, err = common.GetRequestBody(c)
+			if err == nil {
+				c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+			}
+		}
+		// redaction may shorten the body, so keep some more than the cap
+		writer := &captureWriter{ResponseWriter: c.Writer, limit: 2 * config.CaptureMaxBodySize}
+		c.Writer = writer
+		c.Next()
+
+		capture := &model.PayloadCapture{
+			RequestId:  c.GetString(helper.RequestIdKey),
+			UserId:     c.GetInt(ctxkey.Id),
+			TokenId:    tokenId,
+			ChannelId:  c.GetInt(ctxkey.ChannelId),
+			Model:      c.GetString(ctxkey.OriginalModel),
+			Path:       c.Request.URL.Path,
+			StatusCode: c.Writer.Status(),
+		}
+		responseContentType := writer.Header().Get("Content-Type")
+		responseBody := writer.body.Bytes()
+		responseSize := int64(writer.Size())
+		requestSize := c.Request.ContentLength
+		go func() {
+			var requestTruncated, responseTruncated bool
+			capture.RequestBody, requestTruncated = capturedBody(requestContentType, requestBody, requestSize)
+			capture.ResponseBody, responseTruncated = capturedBody(responseContentType, responseBody, responseSize)
+			capture.Truncated = requestTruncated || responseTruncated || writer.truncated
+			model.RecordPayloadCapture(capture)
+		}()
+	}
+}
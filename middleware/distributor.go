@@ -5,6 +5,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"net/http"
@@ -17,6 +18,8 @@ type ModelRequest struct {
 
 func Distribute() func(c *gin.Context) {
 	return func(c *gin.Context) {
+		_, span := tracing.Start(c.Request.Context(), "distribute")
+		defer endStageSpan(c, span)
 		userId := c.GetInt(ctxkey.Id)
 		userGroup, _ := model.CacheGetUserGroup(userId)
 		c.Set(ctxkey.Group, userGroup)
@@ -53,6 +56,14 @@ func Distribute() func(c *gin.Context) {
 			}
 		}
 		SetupContextForSelectedChannel(c, channel, requestModel)
+		model.RelayStatsFromContext(c.Request.Context()).SetUsageDimensions(c.GetInt(ctxkey.TokenId), userGroup, c.GetString(ctxkey.RequestModel))
+		span.SetAttributes(
+			tracing.String("group", userGroup),
+			tracing.Int("channel.id", channel.Id),
+			tracing.String("channel.name", channel.Name),
+			tracing.String("model", requestModel),
+		)
+		span.End()
 		c.Next()
 	}
 }
@@ -92,4 +103,5 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		}
 	}
 	c.Set(ctxkey.Config, cfg)
+	c.Request = c.Request.WithContext(logger.WithFields(c.Request.Context(), "channel_id", channel.Id, "model", c.GetString(ctxkey.RequestModel)))
 }
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"net/http"
+)
+
+// IpBanCheck rejects requests from banned IPs, it's used for the login endpoints
+func IpBanCheck() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if blacklist.IsIpBanned(c.ClientIP()) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "该 IP 已被封禁",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
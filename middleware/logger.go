@@ -1,16 +1,46 @@
 package middleware
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
+	"strings"
+	"time"
 )
 
+type accessLog struct {
+	Time      string  `json:"time"`
+	Level     string  `json:"level"`
+	Logger    string  `json:"logger"`
+	RequestId string  `json:"request_id"`
+	Status    int     `json:"status"`
+	Latency   float64 `json:"latency_ms"`
+	ClientIp  string  `json:"client_ip"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+}
+
 func SetUpLogger(server *gin.Engine) {
 	server.Use(gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 		var requestID string
 		if param.Keys != nil {
-			requestID = param.Keys[helper.RequestIdKey].(string)
+			requestID, _ = param.Keys[helper.RequestIdKey].(string)
+		}
+		if strings.ToLower(config.LogFormat) == "json" {
+			data, _ := json.Marshal(accessLog{
+				Time:      param.TimeStamp.Format(time.RFC3339Nano),
+				Level:     "info",
+				Logger:    "gin",
+				RequestId: requestID,
+				Status:    param.StatusCode,
+				Latency:   float64(param.Latency.Microseconds()) / 1000,
+				ClientIp:  param.ClientIP,
+				Method:    param.Method,
+				Path:      param.Path,
+			})
+			return string(data) + "\n"
 		}
 		return fmt.Sprintf("[GIN] %s | %s | %3d | %13v | %15s | %7s %s\n",
 			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// firstWriteRecorder remembers when the first byte of a streamed response was written
+type firstWriteRecorder struct {
+	gin.ResponseWriter
+	stats   *model.RelayStats
+	written bool
+}
+
+func (w *firstWriteRecorder) recordFirstWrite() {
+	if w.written {
+		return
+	}
+	w.written = true
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stats.FirstTokenTime = time.Now()
+	}
+}
+
+func (w *firstWriteRecorder) Write(data []byte) (int, error) {
+	w.recordFirstWrite()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *firstWriteRecorder) WriteString(s string) (int, error) {
+	w.recordFirstWrite()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func RelayMetrics() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		start := time.Now()
+		stats := &model.RelayStats{StartTime: start}
+		c.Request = c.Request.WithContext(model.WithRelayStats(c.Request.Context(), stats))
+		recorder := &firstWriteRecorder{ResponseWriter: c.Writer, stats: stats}
+		c.Writer = recorder
+		c.Next()
+		// the model of a request which got no channel is client input, keep it out of the labels
+		modelName := "unknown"
+		if c.GetInt(ctxkey.ChannelId) != 0 {
+			modelName = c.GetString(ctxkey.OriginalModel)
+			if modelName == "" {
+				modelName = c.GetString(ctxkey.RequestModel)
+			}
+		}
+		channel := strconv.Itoa(c.GetInt(ctxkey.ChannelId))
+		group := c.GetString(ctxkey.Group)
+		metrics.RelayRequests.WithLabelValues(modelName, channel, group, strconv.Itoa(c.Writer.Status())).Inc()
+		if c.Writer.Status() >= http.StatusBadRequest {
+			model.RecordUsageError(stats, c.GetInt(ctxkey.Id), c.GetInt(ctxkey.ChannelId))
+		}
+		metrics.RelayRequestDuration.WithLabelValues(modelName, channel, group).Observe(time.Since(start).Seconds())
+		if !stats.FirstTokenTime.IsZero() {
+			metrics.RelayFirstTokenDuration.WithLabelValues(modelName, channel, group).Observe(stats.FirstTokenTime.Sub(start).Seconds())
+		}
+	}
+}
+
+// MetricsAuth requires METRICS_TOKEN as bearer token if it is set
+func MetricsAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if config.MetricsToken == "" {
+			c.Next()
+			return
+		}
+		token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.MetricsToken)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/metrics"
+)
+
+func TestRelayMetricsModelLabel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.Use(RelayMetrics())
+	server.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.Set(ctxkey.RequestModel, "client-chosen-model-1")
+		if c.Query("channel") != "" {
+			c.Set(ctxkey.ChannelId, 1)
+			c.Set(ctxkey.OriginalModel, "gpt-4o")
+			c.Status(http.StatusOK)
+			return
+		}
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+	})
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return recorder.Body.String()
+	}
+
+	Convey("requests without a channel are labelled with an unknown model", t, func() {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+		output := scrape()
+		So(output, ShouldNotContainSubstring, "client-chosen-model-1")
+		So(output, ShouldContainSubstring, `one_api_relay_requests_total{channel="0",group="",model="unknown",status="503"} 1`)
+	})
+	Convey("requests with a channel are labelled with their model", t, func() {
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions?channel=1", nil))
+		So(scrape(), ShouldContainSubstring, `one_api_relay_requests_total{channel="1",group="",model="gpt-4o",status="200"} 1`)
+	})
+}
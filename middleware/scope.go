@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strings"
+)
+
+// routeResources maps the api routes to the resource part of a scope,
+// routes not listed here can only be used by management tokens with the "*" scope
+var routeResources = []struct {
+	prefix   string
+	resource string
+}{
+	{"/api/log", "log"},
+	{"/api/token", "token"},
+	{"/api/channel", "channel"},
+	{"/api/group", "channel"},
+	{"/api/user", "user"},
+	{"/api/topup", "user"},
+	{"/api/ban", "user"},
+	{"/api/audit", "log"},
+	{"/api/capture", "log"},
+	{"/api/redemption", "redemption"},
+	{"/api/option", "option"},
+	{"/api/alert", "alert"},
+	{"/api/org", "org"},
+}
+
+// these routes manage the credentials of the user, they require a logged-in session
+var sessionOnlyRoutes = []struct {
+	prefix   string
+	readOnly bool // GET is still allowed for management tokens
+}{
+	{"/api/user/token", false},
+	{"/api/user/self/access_token", false},
+	{"/api/user/self/2fa", false},
+	{"/api/user/self/session", false},
+	{"/api/user/self", true},
+}
+
+func requiredScope(c *gin.Context) (string, bool) {
+	path := c.FullPath()
+	for _, route := range sessionOnlyRoutes {
+		if strings.HasPrefix(path, route.prefix) && !(route.readOnly && c.Request.Method == http.MethodGet) {
+			return "", false
+		}
+	}
+	for _, route := range routeResources {
+		if strings.HasPrefix(path, route.prefix) {
+			if c.Request.Method == http.MethodGet {
+				return route.resource + ":read", true
+			}
+			return route.resource + ":write", true
+		}
+	}
+	return model.ScopeAll, true
+}
+
+func managementTokenAuth(c *gin.Context, key string) (*model.User, error) {
+	token, err := model.ValidateManagementToken(key)
+	if err != nil {
+		return nil, err
+	}
+	if token.AllowedIps != "" && !network.IsIpInSubnets(c.Request.Context(), c.ClientIP(), token.AllowedIps) {
+		return nil, errors.New("access token 不允许从该 IP 访问")
+	}
+	scope, ok := requiredScope(c)
+	if !ok {
+		return nil, errors.New("该操作不能使用 access token")
+	}
+	if !token.HasScope(scope) {
+		return nil, errors.New("access token 缺少权限 " + scope)
+	}
+	user, err := model.GetUserById(token.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	c.Set(ctxkey.ManagementTokenId, token.Id)
+	return user, nil
+}
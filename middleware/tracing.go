@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Tracing starts the server span of a relay request, continuing the trace of the caller if any
+func Tracing() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+		ctx, span := tracing.StartServer(ctx, c.Request.Method+" "+c.FullPath(),
+			tracing.String("http.request.method", c.Request.Method),
+			tracing.String("http.route", c.FullPath()),
+			tracing.String("request.id", c.GetString(helper.RequestIdKey)),
+		)
+		if traceId := tracing.TraceIdFromContext(ctx); traceId != "" {
+			ctx = logger.WithFields(ctx, "trace_id", traceId)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		span.SetAttributes(
+			tracing.Int("http.response.status_code", c.Writer.Status()),
+			tracing.Int("user.id", c.GetInt(ctxkey.Id)),
+			tracing.Int("token.id", c.GetInt(ctxkey.TokenId)),
+			tracing.Int("channel.id", c.GetInt(ctxkey.ChannelId)),
+			tracing.String("model", c.GetString(ctxkey.OriginalModel)),
+		)
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(c.Writer.Status()))
+		}
+		span.End()
+	}
+}
+
+// endStageSpan ends the span of a middleware stage, marking it failed if the stage aborted
+func endStageSpan(c *gin.Context, span trace.Span) {
+	if c.IsAborted() {
+		span.SetStatus(codes.Error, http.StatusText(c.Writer.Status()))
+	}
+	span.End()
+}
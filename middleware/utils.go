@@ -6,7 +6,11 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func abortWithMessage(c *gin.Context, statusCode int, message string) {
@@ -20,6 +24,25 @@ func abortWithMessage(c *gin.Context, statusCode int, message string) {
 	logger.Error(c.Request.Context(), message)
 }
 
+func abortWithTokenLimitExceeded(c *gin.Context, err *model.TokenLimitExceededError) {
+	retryAfter := int64(time.Until(err.ResetAt).Seconds())
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(err.ResetAt.Unix(), 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": gin.H{
+			"message":  helper.MessageWithRequestId(err.Message, c.GetString(helper.RequestIdKey)),
+			"type":     "one_api_error",
+			"code":     "token_limit_exceeded",
+			"reset_at": err.ResetAt.Unix(),
+		},
+	})
+	c.Abort()
+	logger.Warn(c.Request.Context(), err.Message)
+}
+
 func getRequestModel(c *gin.Context) (string, error) {
 	var modelRequest ModelRequest
 	err := common.UnmarshalBodyReusable(c, &modelRequest)
@@ -0,0 +1,321 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
+	"github.com/songquanpeng/one-api/common/network"
+	"github.com/songquanpeng/one-api/common/random"
+	"gorm.io/gorm/clause"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlertRuleStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	AlertRuleStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	AlertMetricQuotaUsedPercent = "quota_used_percent" // thresholds are percentages of the allowance or total quota
+	AlertMetricSpend            = "spend"              // thresholds are quota spent in the period
+)
+
+type AlertRule struct {
+	Id               int    `json:"id"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index;default:0"` // 0 means the rule watches the user
+	Name             string `json:"name"`
+	Metric           string `json:"metric" gorm:"type:varchar(32)"`
+	Thresholds       string `json:"thresholds"` // comma separated
+	Period           string `json:"period" gorm:"type:varchar(16);default:'daily'"`
+	Channels         string `json:"channels"` // comma separated: email, webhook, message_pusher
+	WebhookURL       string `json:"webhook_url"`
+	WebhookSecret    string `json:"-" gorm:"type:varchar(64);default:''"`  // signs the webhook deliveries of the rule
+	NewWebhookSecret string `json:"webhook_secret,omitempty" gorm:"-:all"` // only set when the rule is created
+	Status           int    `json:"status" gorm:"default:1"`
+	CreatedTime      int64  `json:"created_time" gorm:"bigint"`
+}
+
+// AlertFiring records that a threshold of a rule has fired in a period,
+// the unique index makes sure each threshold fires once per period across nodes
+type AlertFiring struct {
+	Id          int   `json:"id"`
+	RuleId      int   `json:"rule_id" gorm:"uniqueIndex:idx_alert_firing"`
+	Threshold   int64 `json:"threshold" gorm:"bigint;uniqueIndex:idx_alert_firing"`
+	PeriodStart int64 `json:"period_start" gorm:"bigint;uniqueIndex:idx_alert_firing"`
+	Value       int64 `json:"value" gorm:"bigint"`
+	CreatedAt   int64 `json:"created_at" gorm:"bigint"`
+}
+
+func (rule *AlertRule) GetThresholds() []int64 {
+	var thresholds []int64
+	for _, s := range strings.Split(rule.Thresholds, ",") {
+		threshold, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err == nil && threshold > 0 {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	sort.Slice(thresholds, func(i, j int) bool {
+		return thresholds[i] > thresholds[j]
+	})
+	return thresholds
+}
+
+func (rule *AlertRule) GetChannels() []string {
+	var channels []string
+	for _, channel := range strings.Split(rule.Channels, ",") {
+		channel = strings.TrimSpace(channel)
+		if channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+func (rule *AlertRule) Validate() error {
+	switch rule.Metric {
+	case AlertMetricQuotaUsedPercent, AlertMetricSpend:
+	default:
+		return fmt.Errorf("无效的告警指标：%s", rule.Metric)
+	}
+	switch rule.Period {
+	case helper.PeriodDaily, helper.PeriodWeekly, helper.PeriodMonthly:
+	default:
+		return fmt.Errorf("无效的告警周期：%s", rule.Period)
+	}
+	if len(rule.GetThresholds()) == 0 {
+		return errors.New("请至少设置一个告警阈值")
+	}
+	channels := rule.GetChannels()
+	if len(channels) == 0 {
+		return errors.New("请至少选择一个通知方式")
+	}
+	for _, channel := range channels {
+		switch channel {
+		case message.ByEmail, message.ByMessagePusher:
+		case message.ByWebhook:
+			u, err := url.Parse(rule.WebhookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+				return errors.New("无效的 Webhook 地址")
+			}
+			if _, err = network.LookupPublicIps(context.Background(), u.Hostname()); err != nil {
+				return errors.New("Webhook 地址必须是可解析的公网地址")
+			}
+		default:
+			return fmt.Errorf("无效的通知方式：%s", channel)
+		}
+	}
+	return nil
+}
+
+func GetUserAlertRules(userId int) (rules []*AlertRule, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&rules).Error
+	return rules, err
+}
+
+func GetAlertRuleByIds(id int, userId int) (*AlertRule, error) {
+	if id == 0 || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	rule := AlertRule{}
+	err := DB.First(&rule, "id = ? and user_id = ?", id, userId).Error
+	return &rule, err
+}
+
+func (rule *AlertRule) Insert() error {
+	rule.WebhookSecret = random.GetUUID() + random.GetUUID()
+	err := DB.Create(rule).Error
+	if err != nil {
+		return err
+	}
+	rule.NewWebhookSecret = rule.WebhookSecret
+	return nil
+}
+
+func (rule *AlertRule) Update() error {
+	return DB.Model(rule).Select("name", "token_id", "metric", "thresholds", "period", "channels", "webhook_url", "status").Updates(rule).Error
+}
+
+func DeleteAlertRuleById(id int, userId int) error {
+	rule, err := GetAlertRuleByIds(id, userId)
+	if err != nil {
+		return err
+	}
+	err = DB.Delete(rule).Error
+	if err != nil {
+		return err
+	}
+	return DB.Where("rule_id = ?", id).Delete(&AlertFiring{}).Error
+}
+
+var alertCheckTime sync.Map
+
+const alertCheckInterval = 10 // seconds
+
+// CheckAlertRules evaluates the enabled rules of the user, it is throttled per user
+// because it is called after every consumption
+func CheckAlertRules(userId int) {
+	now := time.Now()
+	if last, ok := alertCheckTime.Load(userId); ok && now.Unix()-last.(int64) < alertCheckInterval {
+		return
+	}
+	alertCheckTime.Store(userId, now.Unix())
+	var rules []*AlertRule
+	err := DB.Where("user_id = ? and status = ?", userId, AlertRuleStatusEnabled).Find(&rules).Error
+	if err != nil {
+		logger.SysError("failed to fetch alert rules: " + err.Error())
+		return
+	}
+	for _, rule := range rules {
+		err = rule.check(now)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to check alert rule #%d: %s", rule.Id, err.Error()))
+		}
+	}
+}
+
+// quotaUsage returns how much of the allowance (or the total quota if there is no allowance) is used
+func quotaUsage(remain int64, used int64, allowance *QuotaAllowance) (int64, int64) {
+	if allowance.QuotaResetPeriod == "" {
+		return used, remain + used
+	}
+	base := allowance.QuotaResetAmount
+	if allowance.QuotaResetAccrue && allowance.QuotaAccrueCap > 0 {
+		base = allowance.QuotaAccrueCap
+	}
+	if remain >= base {
+		return 0, base
+	}
+	return base - remain, base
+}
+
+// value returns the current value of the rule's metric and a description of the target,
+// spend is counted from the start of the period the firings are de-duplicated on
+func (rule *AlertRule) value(periodStart time.Time) (int64, string, error) {
+	target := "账户"
+	if rule.TokenId != 0 {
+		token, err := GetTokenByIds(rule.TokenId, rule.UserId)
+		if err != nil {
+			return 0, "", err
+		}
+		target = fmt.Sprintf("令牌「%s」", token.Name)
+		if rule.Metric == AlertMetricQuotaUsedPercent {
+			if token.UnlimitedQuota {
+				return 0, target, nil
+			}
+			used, base := quotaUsage(token.RemainQuota, token.UsedQuota, &token.QuotaAllowance)
+			if base <= 0 {
+				return 0, target, nil
+			}
+			return used * 100 / base, target, nil
+		}
+	} else if rule.Metric == AlertMetricQuotaUsedPercent {
+		user, err := GetUserById(rule.UserId, false)
+		if err != nil {
+			return 0, "", err
+		}
+		used, base := quotaUsage(user.Quota, user.UsedQuota, &user.QuotaAllowance)
+		if base <= 0 {
+			return 0, target, nil
+		}
+		return used * 100 / base, target, nil
+	}
+	spent, err := GetUsageQuota(rule.UserId, rule.TokenId, periodStart.Unix())
+	return spent, target, err
+}
+
+func (rule *AlertRule) check(now time.Time) error {
+	thresholds := rule.GetThresholds()
+	if len(thresholds) == 0 {
+		return nil
+	}
+	periodStart, err := helper.GetPeriodStart(rule.Period, now)
+	if err != nil {
+		return err
+	}
+	value, target, err := rule.value(periodStart)
+	if err != nil {
+		return err
+	}
+	notified := false
+	// thresholds are sorted in descending order, only the highest newly reached one is notified,
+	// the lower ones are marked as fired so they won't be notified later in this period
+	for _, threshold := range thresholds {
+		if value < threshold {
+			continue
+		}
+		firing := AlertFiring{
+			RuleId:      rule.Id,
+			Threshold:   threshold,
+			PeriodStart: periodStart.Unix(),
+			Value:       value,
+			CreatedAt:   now.Unix(),
+		}
+		result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&firing)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || notified {
+			continue
+		}
+		notified = true
+		rule.notify(target, threshold, value, now)
+	}
+	return nil
+}
+
+func (rule *AlertRule) describe(target string, threshold int64, value int64) string {
+	if rule.Metric == AlertMetricQuotaUsedPercent {
+		return fmt.Sprintf("%s额度已使用 %d%%，达到告警阈值 %d%%", target, value, threshold)
+	}
+	return fmt.Sprintf("%s在本周期（%s）内已消费 %s，达到告警阈值 %s", target, rule.Period, common.LogQuota(value), common.LogQuota(threshold))
+}
+
+func (rule *AlertRule) notify(target string, threshold int64, value int64, now time.Time) {
+	subject := fmt.Sprintf("额度告警：%s", rule.Name)
+	content := rule.describe(target, threshold, value)
+	RecordLog(rule.UserId, LogTypeSystem, fmt.Sprintf("告警规则「%s」已触发：%s", rule.Name, content))
+	for _, channel := range rule.GetChannels() {
+		var err error
+		switch channel {
+		case message.ByEmail:
+			var email string
+			email, err = GetUserEmail(rule.UserId)
+			if err == nil {
+				err = message.SendEmail(subject, email, content)
+			}
+		case message.ByMessagePusher:
+			// the pusher is the operator's, rules of other users can't use it
+			if !IsAdmin(rule.UserId) {
+				continue
+			}
+			err = message.SendMessage(subject, content, content)
+		case message.ByWebhook:
+			err = message.SendWebhook(rule.WebhookURL, rule.WebhookSecret, map[string]interface{}{
+				"event":     "quota_alert",
+				"rule_id":   rule.Id,
+				"rule_name": rule.Name,
+				"user_id":   rule.UserId,
+				"token_id":  rule.TokenId,
+				"metric":    rule.Metric,
+				"period":    rule.Period,
+				"threshold": threshold,
+				"value":     value,
+				"message":   content,
+				"timestamp": now.Unix(),
+			})
+		}
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to send alert of rule #%d via %s: %s", rule.Id, channel, err.Error()))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/message"
+)
+
+func TestAlertRuleCheck(t *testing.T) {
+	setupTestDB(t, &User{}, &Log{}, &UsageRollup{}, &UsageRollupCursor{}, &AlertRule{}, &AlertFiring{})
+	user := User{Username: "alerted", Password: "password"}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.Local)
+	now := day.Add(12 * time.Hour)
+	consume := func(at time.Time, quota int) {
+		log := Log{UserId: user.Id, Type: LogTypeConsume, CreatedAt: at.Unix(), ModelName: "gpt-4o", Quota: quota}
+		if err := LOG_DB.Create(&log).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	rule := AlertRule{UserId: user.Id, Name: "budget", Metric: AlertMetricSpend, Thresholds: "100,200,300", Period: helper.PeriodDaily, Channels: message.ByEmail, Status: AlertRuleStatusEnabled}
+	if err := rule.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	notifications := func() int64 {
+		var count int64
+		LOG_DB.Model(&Log{}).Where("type = ? and content like ?", LogTypeSystem, "告警规则「budget」已触发%").Count(&count)
+		return count
+	}
+	fired := func() []int64 {
+		var thresholds []int64
+		DB.Model(&AlertFiring{}).Where("rule_id = ?", rule.Id).Order("threshold").Pluck("threshold", &thresholds)
+		return thresholds
+	}
+
+	Convey("rules get their own webhook secret, returned once", t, func() {
+		So(rule.WebhookSecret, ShouldHaveLength, 64)
+		So(rule.NewWebhookSecret, ShouldEqual, rule.WebhookSecret)
+		rules, err := GetUserAlertRules(user.Id)
+		So(err, ShouldBeNil)
+		So(rules[0].WebhookSecret, ShouldEqual, rule.WebhookSecret)
+		So(rules[0].NewWebhookSecret, ShouldBeEmpty)
+	})
+	Convey("spend of the previous period doesn't count", t, func() {
+		consume(day.Add(-time.Hour), 500)
+		consume(day.Add(time.Hour), 50)
+		So(rule.check(now), ShouldBeNil)
+		So(fired(), ShouldBeEmpty)
+		So(notifications(), ShouldEqual, 0)
+	})
+	Convey("crossing a threshold notifies once", t, func() {
+		consume(day.Add(2*time.Hour), 60)
+		So(rule.check(now), ShouldBeNil)
+		So(fired(), ShouldResemble, []int64{100})
+		So(notifications(), ShouldEqual, 1)
+
+		So(rule.check(now.Add(time.Hour)), ShouldBeNil)
+		So(notifications(), ShouldEqual, 1)
+	})
+	Convey("rolled up logs are counted the same", t, func() {
+		So(RollupUsage(), ShouldBeNil)
+		value, _, err := rule.value(day)
+		So(err, ShouldBeNil)
+		So(value, ShouldEqual, 110)
+		consume(day.Add(3*time.Hour), 40)
+		value, _, err = rule.value(day)
+		So(err, ShouldBeNil)
+		So(value, ShouldEqual, 150)
+	})
+	Convey("crossing several thresholds at once notifies the highest only", t, func() {
+		consume(day.Add(4*time.Hour), 200)
+		So(rule.check(now), ShouldBeNil)
+		So(fired(), ShouldResemble, []int64{100, 200, 300})
+		So(notifications(), ShouldEqual, 2)
+		var firing AlertFiring
+		So(DB.Where("rule_id = ? and threshold = ?", rule.Id, 300).First(&firing).Error, ShouldBeNil)
+		So(firing.Value, ShouldEqual, 350)
+	})
+	Convey("thresholds fire again in the next period", t, func() {
+		next := day.Add(24 * time.Hour)
+		consume(next.Add(time.Hour), 120)
+		So(rule.check(next.Add(2*time.Hour)), ShouldBeNil)
+		So(notifications(), ShouldEqual, 3)
+		var count int64
+		DB.Model(&AlertFiring{}).Where("rule_id = ? and period_start = ?", rule.Id, next.Unix()).Count(&count)
+		So(count, ShouldEqual, 1)
+	})
+}
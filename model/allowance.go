@@ -0,0 +1,216 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QuotaAllowance is embedded into Token and User, it describes a quota which is
+// granted again at the beginning of every period
+type QuotaAllowance struct {
+	QuotaResetPeriod   string `json:"quota_reset_period" gorm:"type:varchar(16);default:''"` // hourly, daily, weekly, monthly; empty means no allowance
+	QuotaResetAmount   int64  `json:"quota_reset_amount" gorm:"bigint;default:0"`
+	QuotaResetAccrue   bool   `json:"quota_reset_accrue" gorm:"default:false"`  // add the amount instead of resetting to it
+	QuotaAccrueCap     int64  `json:"quota_accrue_cap" gorm:"bigint;default:0"` // only for accrue, 0 means no cap
+	LastQuotaResetTime int64  `json:"last_quota_reset_time" gorm:"bigint;default:0"`
+}
+
+func (allowance *QuotaAllowance) Validate() error {
+	if allowance.QuotaResetPeriod == "" {
+		return nil
+	}
+	if !helper.IsValidPeriod(allowance.QuotaResetPeriod) {
+		return fmt.Errorf("无效的额度重置周期：%s", allowance.QuotaResetPeriod)
+	}
+	if allowance.QuotaResetAmount <= 0 {
+		return errors.New("周期额度必须大于 0")
+	}
+	if allowance.QuotaAccrueCap < 0 {
+		return errors.New("额度累积上限不能为负数")
+	}
+	return nil
+}
+
+// isDue reports whether the allowance has not been granted in the current period yet
+func (allowance *QuotaAllowance) isDue(now time.Time) bool {
+	if allowance.QuotaResetPeriod == "" || allowance.QuotaResetAmount <= 0 {
+		return false
+	}
+	start, err := helper.GetPeriodStart(allowance.QuotaResetPeriod, now)
+	if err != nil {
+		return false
+	}
+	return allowance.LastQuotaResetTime < start.Unix()
+}
+
+// quotaExpr builds the column update for the allowance, accruing is done in SQL so
+// concurrent consumption between read and write won't be lost
+func (allowance *QuotaAllowance) quotaExpr(column string) interface{} {
+	if !allowance.QuotaResetAccrue {
+		return allowance.QuotaResetAmount
+	}
+	if allowance.QuotaAccrueCap <= 0 {
+		return gorm.Expr(column+" + ?", allowance.QuotaResetAmount)
+	}
+	return gorm.Expr(fmt.Sprintf("CASE WHEN %s >= ? THEN %s WHEN %s + ? > ? THEN ? ELSE %s + ? END", column, column, column, column),
+		allowance.QuotaAccrueCap, allowance.QuotaResetAmount, allowance.QuotaAccrueCap, allowance.QuotaAccrueCap, allowance.QuotaResetAmount)
+}
+
+func describeAllowance(allowance *QuotaAllowance, before int64, after int64) string {
+	if allowance.QuotaResetAccrue {
+		return fmt.Sprintf("周期额度（%s）累积，额度从 %s变为 %s", allowance.QuotaResetPeriod, common.LogQuota(before), common.LogQuota(after))
+	}
+	return fmt.Sprintf("周期额度（%s）重置，额度从 %s重置为 %s", allowance.QuotaResetPeriod, common.LogQuota(before), common.LogQuota(after))
+}
+
+// ApplyTokenAllowance grants the token's periodic allowance if it is due,
+// the token passed in is updated in place
+func ApplyTokenAllowance(token *Token) (applied bool, err error) {
+	now := time.Now()
+	if !token.isDue(now) || token.UnlimitedQuota {
+		return false, nil
+	}
+	updates := map[string]interface{}{
+		"remain_quota":          token.quotaExpr("remain_quota"),
+		"last_quota_reset_time": now.Unix(),
+	}
+	if token.Status == TokenStatusExhausted {
+		updates["status"] = TokenStatusEnabled
+	}
+	// the condition on last_quota_reset_time makes sure only one node grants the allowance
+	result := DB.Model(&Token{}).Where("id = ? and last_quota_reset_time = ?", token.Id, token.LastQuotaResetTime).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	invalidateTokenCache(token)
+	before := token.RemainQuota
+	fresh, err := GetTokenById(token.Id)
+	if err != nil {
+		return false, err
+	}
+	*token = *fresh
+	if result.RowsAffected == 0 {
+		// granted by someone else already
+		return false, nil
+	}
+	if token.RemainQuota == before {
+		return true, nil
+	}
+	RecordLog(token.UserId, LogTypeSystem, fmt.Sprintf("令牌「%s」（#%d）%s", token.Name, token.Id, describeAllowance(&token.QuotaAllowance, before, token.RemainQuota)))
+	return true, nil
+}
+
+// userAllowanceNextCheck caches when a user's allowance has to be checked again, so we don't query
+// the database on every request. Redis shares the check between nodes, this map is the fallback.
+var userAllowanceNextCheck sync.Map
+
+func userAllowanceCheckKey(userId int) string {
+	return fmt.Sprintf("user_allowance_next_check:%d", userId)
+}
+
+// getUserAllowanceNextCheck returns 0 if the allowance has to be checked now
+func getUserAllowanceNextCheck(userId int) int64 {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(userAllowanceCheckKey(userId))
+		if err != nil {
+			return 0
+		}
+		next, _ := strconv.ParseInt(value, 10, 64)
+		return next
+	}
+	next, ok := userAllowanceNextCheck.Load(userId)
+	if !ok {
+		return 0
+	}
+	return next.(int64)
+}
+
+func setUserAllowanceNextCheck(userId int, next int64, now int64) {
+	if common.RedisEnabled {
+		err := common.RedisSet(userAllowanceCheckKey(userId), strconv.FormatInt(next, 10), time.Duration(next-now)*time.Second)
+		if err != nil {
+			logger.SysError("Redis set user allowance check error: " + err.Error())
+		}
+		return
+	}
+	// other nodes can't clear it, so it is trusted no longer than the other memory caches
+	if next > now+int64(config.SyncFrequency) {
+		next = now + int64(config.SyncFrequency)
+	}
+	userAllowanceNextCheck.Store(userId, next)
+}
+
+func ClearUserAllowanceCheck(userId int) {
+	if common.RedisEnabled {
+		err := common.RedisDel(userAllowanceCheckKey(userId))
+		if err != nil {
+			logger.SysError("Redis delete user allowance check error: " + err.Error())
+		}
+	}
+	userAllowanceNextCheck.Delete(userId)
+}
+
+// ApplyUserAllowance grants the user's periodic allowance if it is due
+func ApplyUserAllowance(ctx context.Context, userId int) (applied bool, err error) {
+	now := time.Now()
+	if now.Unix() < getUserAllowanceNextCheck(userId) {
+		return false, nil
+	}
+	user := User{}
+	err = DB.Select("id", "quota", "quota_reset_period", "quota_reset_amount", "quota_reset_accrue", "quota_accrue_cap", "last_quota_reset_time").First(&user, "id = ?", userId).Error
+	if err != nil {
+		return false, err
+	}
+	if user.QuotaResetPeriod == "" {
+		// check again a while later, in case the allowance gets configured
+		setUserAllowanceNextCheck(userId, now.Add(time.Minute).Unix(), now.Unix())
+		return false, nil
+	}
+	if next, err := helper.GetNextPeriodStart(user.QuotaResetPeriod, now); err == nil {
+		setUserAllowanceNextCheck(userId, next.Unix(), now.Unix())
+	}
+	if !user.isDue(now) {
+		return false, nil
+	}
+	result := DB.Model(&User{}).Where("id = ? and last_quota_reset_time = ?", user.Id, user.LastQuotaResetTime).Updates(map[string]interface{}{
+		"quota":                 user.quotaExpr("quota"),
+		"last_quota_reset_time": now.Unix(),
+	})
+	if result.Error != nil {
+		ClearUserAllowanceCheck(userId)
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	quota, err := GetUserQuota(userId)
+	if err != nil {
+		return true, err
+	}
+	if common.RedisEnabled {
+		err = common.RedisSet(fmt.Sprintf("user_quota:%d", userId), fmt.Sprintf("%d", quota), time.Duration(UserId2QuotaCacheSeconds)*time.Second)
+		if err != nil {
+			logger.Error(ctx, "Redis set user quota error: "+err.Error())
+		}
+	}
+	if quota == user.Quota {
+		return true, nil
+	}
+	if quota > user.Quota {
+		RecordTopupLog(userId, describeAllowance(&user.QuotaAllowance, user.Quota, quota), int(quota-user.Quota))
+	} else {
+		// resetting to a lower amount is no top-up
+		RecordLog(userId, LogTypeSystem, describeAllowance(&user.QuotaAllowance, user.Quota, quota))
+	}
+	logger.Infof(ctx, "user %d's %s quota allowance granted, quota is %d now", userId, user.QuotaResetPeriod, quota)
+	return true, nil
+}
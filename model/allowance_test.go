@@ -0,0 +1,54 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestApplyUserAllowance(t *testing.T) {
+	setupTestDB(t, &User{}, &Log{})
+	config.SyncFrequency = 60
+	user := User{Username: "alice", Password: "12345678", Quota: 10}
+	user.QuotaAllowance = QuotaAllowance{QuotaResetPeriod: helper.PeriodHourly, QuotaResetAmount: 100}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("hourly allowances are accepted", t, func() {
+		So(user.QuotaAllowance.Validate(), ShouldBeNil)
+		So((&QuotaAllowance{QuotaResetPeriod: "yearly", QuotaResetAmount: 100}).Validate(), ShouldNotBeNil)
+	})
+	Convey("the allowance is granted once per period", t, func() {
+		applied, err := ApplyUserAllowance(context.Background(), user.Id)
+		So(err, ShouldBeNil)
+		So(applied, ShouldBeTrue)
+		quota, _ := GetUserQuota(user.Id)
+		So(quota, ShouldEqual, 100)
+		applied, err = ApplyUserAllowance(context.Background(), user.Id)
+		So(err, ShouldBeNil)
+		So(applied, ShouldBeFalse)
+	})
+	Convey("without Redis the next check is not cached longer than the sync frequency", t, func() {
+		So(getUserAllowanceNextCheck(user.Id), ShouldBeLessThanOrEqualTo, time.Now().Unix()+int64(config.SyncFrequency))
+		ClearUserAllowanceCheck(user.Id)
+		So(getUserAllowanceNextCheck(user.Id), ShouldEqual, 0)
+	})
+	Convey("resetting to a lower quota is not logged as a top-up", t, func() {
+		rich := User{Username: "bob", Password: "12345678", AccessToken: "bob", AffCode: "bob", Quota: 500}
+		rich.QuotaAllowance = QuotaAllowance{QuotaResetPeriod: helper.PeriodHourly, QuotaResetAmount: 100}
+		So(DB.Create(&rich).Error, ShouldBeNil)
+		applied, err := ApplyUserAllowance(context.Background(), rich.Id)
+		So(err, ShouldBeNil)
+		So(applied, ShouldBeTrue)
+		var logs []*Log
+		So(LOG_DB.Where("user_id = ?", rich.Id).Find(&logs).Error, ShouldBeNil)
+		So(logs, ShouldHaveLength, 1)
+		So(logs[0].Type, ShouldEqual, LogTypeSystem)
+		So(logs[0].Quota, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+)
+
+const (
+	AuditTargetChannel    = "channel"
+	AuditTargetOption     = "option"
+	AuditTargetUser       = "user"
+	AuditTargetToken      = "token"
+	AuditTargetRedemption = "redemption"
+	AuditTargetCampaign   = "campaign"
+	AuditTargetBan        = "ban"
+)
+
+// AuditLog records who changed what through the management API.
+type AuditLog struct {
+	Id                int    `json:"id"`
+	CreatedAt         int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId           int    `json:"actor_id" gorm:"index"`
+	ActorName         string `json:"actor_name" gorm:"default:''"`
+	ActorRole         int    `json:"actor_role"`
+	ManagementTokenId int    `json:"management_token_id" gorm:"default:0"` // set if the call was made with an access token
+	Action            string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType        string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target,priority:1"`
+	TargetId          string `json:"target_id" gorm:"type:varchar(64);index:idx_audit_target,priority:2"`
+	Diff              string `json:"diff" gorm:"type:text"` // {"field": {"before": x, "after": y}}
+	Ip                string `json:"ip" gorm:"type:varchar(64);default:''"`
+	RequestId         string `json:"request_id" gorm:"type:varchar(64);default:''"`
+}
+
+type AuditFilter struct {
+	ActorId        int
+	Action         string
+	TargetType     string
+	TargetId       string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+const auditMask = "******"
+
+// values of these fields never end up in the audit log
+var auditSecretSuffixes = []string{"key", "password", "secret", "token", "codes", "config"}
+
+func isAuditSecretField(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range auditSecretSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func auditFields(v any) map[string]any {
+	fields := make(map[string]any)
+	if v == nil {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+type auditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditDiff returns the changed fields between before and after as JSON,
+// either side may be nil for creations and deletions.
+func AuditDiff(before any, after any) string {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+	names := make([]string, 0, len(beforeFields)+len(afterFields))
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	diff := make(map[string]auditChange)
+	for _, name := range names {
+		b, bok := beforeFields[name]
+		a, aok := afterFields[name]
+		bJson, _ := json.Marshal(b)
+		aJson, _ := json.Marshal(a)
+		if bok && aok && string(bJson) == string(aJson) {
+			continue
+		}
+		if isAuditSecretField(name) {
+			if bok && b != nil && b != "" {
+				b = auditMask
+			}
+			if aok && a != nil && a != "" {
+				a = auditMask
+			}
+		}
+		diff[name] = auditChange{Before: b, After: a}
+	}
+	if len(diff) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(diff)
+	return string(data)
+}
+
+func RecordAuditLog(audit *AuditLog) {
+	audit.CreatedAt = helper.GetTimestamp()
+	err := LOG_DB.Create(audit).Error
+	if err != nil {
+		logger.SysError("failed to record audit log: " + err.Error())
+	}
+}
+
+func auditQuery(filter AuditFilter) *gorm.DB {
+	tx := LOG_DB.Model(&AuditLog{})
+	if filter.ActorId != 0 {
+		tx = tx.Where("actor_id = ?", filter.ActorId)
+	}
+	if filter.Action != "" {
+		tx = tx.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		tx = tx.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetId != "" {
+		tx = tx.Where("target_id = ?", filter.TargetId)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	return tx
+}
+
+func GetAuditLogs(filter AuditFilter, startIdx int, num int) (audits []*AuditLog, err error) {
+	err = auditQuery(filter).Order("id desc").Limit(num).Offset(startIdx).Find(&audits).Error
+	return audits, err
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuditDiff(t *testing.T) {
+	parse := func(diff string) map[string]auditChange {
+		changes := make(map[string]auditChange)
+		So(json.Unmarshal([]byte(diff), &changes), ShouldBeNil)
+		return changes
+	}
+	Convey("secret fields are masked", t, func() {
+		changes := parse(AuditDiff(
+			&User{Username: "alice", Password: "old-password", AccessToken: "old-token"},
+			&User{Username: "alice", Password: "new-password", AccessToken: "new-token"},
+		))
+		So(changes["password"], ShouldResemble, auditChange{Before: auditMask, After: auditMask})
+		So(changes["access_token"], ShouldResemble, auditChange{Before: auditMask, After: auditMask})
+
+		changes = parse(AuditDiff(nil, &Channel{Name: "openai", Key: "sk-secret"}))
+		So(changes["key"], ShouldResemble, auditChange{Before: nil, After: auditMask})
+		So(changes["name"], ShouldResemble, auditChange{Before: nil, After: "openai"})
+
+		changes = parse(AuditDiff(map[string]any{"GitHubClientSecret": "a"}, map[string]any{"GitHubClientSecret": "b"}))
+		So(changes["GitHubClientSecret"], ShouldResemble, auditChange{Before: auditMask, After: auditMask})
+	})
+	Convey("unchanged fields are left out", t, func() {
+		changes := parse(AuditDiff(
+			&Channel{Name: "openai", Key: "sk-secret"},
+			&Channel{Name: "azure", Key: "sk-secret"},
+		))
+		So(changes, ShouldHaveLength, 1)
+		So(changes["name"], ShouldResemble, auditChange{Before: "openai", After: "azure"})
+		So(AuditDiff(map[string]any{"SMTPPort": "25"}, map[string]any{"SMTPPort": "25"}), ShouldBeEmpty)
+	})
+}
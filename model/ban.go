@@ -0,0 +1,137 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"net"
+	"time"
+)
+
+const (
+	BanTypeUser = "user"
+	BanTypeIp   = "ip"
+)
+
+// banChannel is the redis channel telling the other nodes to reload the ban list
+const banChannel = "one_api_ban_changed"
+
+type Ban struct {
+	Id          int    `json:"id"`
+	Type        string `json:"type" gorm:"type:varchar(16);index"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Cidr        string `json:"cidr" gorm:"type:varchar(64)"`
+	Reason      string `json:"reason"`
+	ExpiredTime int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	CreatedBy   int    `json:"created_by"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	Username    string `json:"username" gorm:"-:all"` // only for api response
+}
+
+func GetBans(startIdx int, num int) (bans []*Ban, err error) {
+	now := helper.GetTimestamp()
+	err = DB.Where("expired_time = -1 or expired_time > ?", now).Order("id desc").Limit(num).Offset(startIdx).Find(&bans).Error
+	for _, ban := range bans {
+		if ban.Type == BanTypeUser {
+			ban.Username = GetUsernameById(ban.UserId)
+		}
+	}
+	return bans, err
+}
+
+func (ban *Ban) Insert() error {
+	ban.CreatedTime = helper.GetTimestamp()
+	err := DB.Create(ban).Error
+	if err != nil {
+		return err
+	}
+	NotifyBanChanged()
+	return nil
+}
+
+func DeleteBanById(id int) error {
+	result := DB.Delete(&Ban{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("该封禁不存在")
+	}
+	NotifyBanChanged()
+	return nil
+}
+
+// LoadBans rebuilds the ban list of this node from the bans in the database. Disabled users are
+// not in it, their sessions are deleted and their tokens are checked against the user status.
+func LoadBans() error {
+	now := helper.GetTimestamp()
+	var bans []*Ban
+	err := DB.Where("expired_time = -1 or expired_time > ?", now).Find(&bans).Error
+	if err != nil {
+		return err
+	}
+	users := make(map[int]int64)
+	var ips []blacklist.IpBan
+	for _, ban := range bans {
+		switch ban.Type {
+		case BanTypeUser:
+			// the longest ban of the user wins
+			expiredTime, ok := users[ban.UserId]
+			if !ok || (expiredTime != -1 && (ban.ExpiredTime == -1 || ban.ExpiredTime > expiredTime)) {
+				users[ban.UserId] = ban.ExpiredTime
+			}
+		case BanTypeIp:
+			_, ipNet, err := net.ParseCIDR(ban.Cidr)
+			if err != nil {
+				logger.SysError(fmt.Sprintf("invalid cidr of ban #%d: %s", ban.Id, ban.Cidr))
+				continue
+			}
+			ips = append(ips, blacklist.IpBan{Net: ipNet, ExpiredTime: ban.ExpiredTime})
+		}
+	}
+	blacklist.Replace(users, ips)
+	return nil
+}
+
+// NotifyBanChanged reloads the ban list of this node and asks the other nodes to do the same
+func NotifyBanChanged() {
+	err := LoadBans()
+	if err != nil {
+		logger.SysError("failed to load bans: " + err.Error())
+	}
+	if !common.RedisEnabled {
+		return
+	}
+	err = common.RDB.Publish(context.Background(), banChannel, "reload").Err()
+	if err != nil {
+		logger.SysError("failed to publish ban change: " + err.Error())
+	}
+}
+
+// SyncBans keeps the ban list up to date, changes made on other nodes arrive through redis
+// right away, the periodic reload covers nodes without redis
+func SyncBans(frequency int) {
+	if common.RedisEnabled {
+		go func() {
+			pubsub := common.RDB.Subscribe(context.Background(), banChannel)
+			defer pubsub.Close()
+			for range pubsub.Channel() {
+				err := LoadBans()
+				if err != nil {
+					logger.SysError("failed to load bans: " + err.Error())
+				}
+			}
+		}()
+	}
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		err := LoadBans()
+		if err != nil {
+			logger.SysError("failed to load bans: " + err.Error())
+		}
+	}
+}
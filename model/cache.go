@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/random"
+	"gorm.io/gorm"
 	"math/rand"
 	"sort"
 	"strconv"
@@ -23,36 +25,58 @@ var (
 	UserId2QuotaCacheSeconds  = config.SyncFrequency
 	UserId2StatusCacheSeconds = config.SyncFrequency
 	GroupModelsCacheSeconds   = config.SyncFrequency
+	OrgCacheSeconds           = config.SyncFrequency
 )
 
+// tokenCacheEntry keeps the key hashes, which are not part of the token json
+type tokenCacheEntry struct {
+	Key         string `json:"key"`
+	PreviousKey string `json:"previous_key"`
+	Token       *Token `json:"token"`
+}
+
+// CacheGetTokenByKey looks the token up by the hash of the key, the key itself is neither stored nor cached.
+// The previous key of a rotated token is accepted until its grace period ends.
 func CacheGetTokenByKey(key string) (*Token, error) {
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
 		keyCol = `"key"`
 	}
-	var token Token
-	if !common.RedisEnabled {
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
-		return &token, err
+	keyHash := HashTokenKey(key)
+	var token *Token
+	var entry tokenCacheEntry
+	tokenObjectString, err := "", errors.New("redis disabled")
+	if common.RedisEnabled {
+		tokenObjectString, err = common.RedisGet(fmt.Sprintf("token:%s", keyHash))
 	}
-	tokenObjectString, err := common.RedisGet(fmt.Sprintf("token:%s", key))
-	if err != nil {
-		err := DB.Where(keyCol+" = ?", key).First(&token).Error
-		if err != nil {
-			return nil, err
-		}
-		jsonBytes, err := json.Marshal(token)
+	if err == nil {
+		err = json.Unmarshal([]byte(tokenObjectString), &entry)
+	}
+	if err == nil && entry.Token != nil {
+		token = entry.Token
+		token.Key = entry.Key
+		token.PreviousKey = entry.PreviousKey
+	} else {
+		token = &Token{}
+		err = DB.Where(keyCol+" = ? or previous_key = ?", keyHash, keyHash).First(token).Error
 		if err != nil {
 			return nil, err
 		}
-		err = common.RedisSet(fmt.Sprintf("token:%s", key), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
-		if err != nil {
-			logger.SysError("Redis set token error: " + err.Error())
+		if common.RedisEnabled {
+			jsonBytes, err := json.Marshal(tokenCacheEntry{Key: token.Key, PreviousKey: token.PreviousKey, Token: token})
+			if err != nil {
+				return nil, err
+			}
+			err = common.RedisSet(fmt.Sprintf("token:%s", keyHash), string(jsonBytes), time.Duration(TokenCacheSeconds)*time.Second)
+			if err != nil {
+				logger.SysError("Redis set token error: " + err.Error())
+			}
 		}
-		return &token, nil
 	}
-	err = json.Unmarshal([]byte(tokenObjectString), &token)
-	return &token, err
+	if token.Key != keyHash && token.PreviousKeyExpiredTime < helper.GetTimestamp() {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return token, nil
 }
 
 func CacheGetUserGroup(id int) (group string, err error) {
@@ -124,6 +148,14 @@ func CacheDecreaseUserQuota(id int, quota int64) error {
 	return err
 }
 
+func CacheIncreaseUserQuota(id int, quota int64) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	err := common.RedisIncrease(fmt.Sprintf("user_quota:%d", id), quota)
+	return err
+}
+
 func CacheIsUserEnabled(userId int) (bool, error) {
 	if !common.RedisEnabled {
 		return IsUserEnabled(userId)
@@ -167,6 +199,69 @@ func CacheGetGroupModels(ctx context.Context, group string) ([]string, error) {
 	return models, nil
 }
 
+func orgCacheKey(id int) string {
+	return fmt.Sprintf("org:%d", id)
+}
+
+func orgMemberCacheKey(orgId int, userId int) string {
+	return fmt.Sprintf("org_member:%d:%d", orgId, userId)
+}
+
+// cacheGetJSON reads the object from redis, or loads it with fetch and caches it
+func cacheGetJSON[T any](key string, fetch func() (*T, error)) (*T, error) {
+	if !common.RedisEnabled {
+		return fetch()
+	}
+	if cached, err := common.RedisGet(key); err == nil {
+		var object T
+		if err = json.Unmarshal([]byte(cached), &object); err == nil {
+			return &object, nil
+		}
+	}
+	object, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	err = common.RedisSet(key, string(jsonBytes), time.Duration(OrgCacheSeconds)*time.Second)
+	if err != nil {
+		logger.SysError("Redis set " + key + " error: " + err.Error())
+	}
+	return object, nil
+}
+
+// CacheGetOrganization caches the organization, its quota may be stale and is only
+// used for checks, consuming the pool is checked again in the database
+func CacheGetOrganization(id int) (*Organization, error) {
+	return cacheGetJSON(orgCacheKey(id), func() (*Organization, error) {
+		return GetOrganizationById(id)
+	})
+}
+
+func CacheGetOrgMember(orgId int, userId int) (*OrganizationMember, error) {
+	return cacheGetJSON(orgMemberCacheKey(orgId, userId), func() (*OrganizationMember, error) {
+		return GetOrgMember(orgId, userId)
+	})
+}
+
+// invalidateOrgCache removes the cached organization, and the cached member if userId is not 0
+func invalidateOrgCache(orgId int, userId int) {
+	if !common.RedisEnabled {
+		return
+	}
+	key := orgCacheKey(orgId)
+	if userId != 0 {
+		key = orgMemberCacheKey(orgId, userId)
+	}
+	err := common.RedisDel(key)
+	if err != nil {
+		logger.SysError("Redis delete " + key + " error: " + err.Error())
+	}
+}
+
 var group2model2channels map[string]map[string][]*Channel
 var channelSyncLock sync.RWMutex
 
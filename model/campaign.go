@@ -0,0 +1,65 @@
+package model
+
+import (
+	"errors"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+const (
+	CampaignStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	CampaignStatusDisabled = 2 // also don't use 0
+)
+
+// RedemptionCampaign groups redemption codes, Budget caps the total quota granted by its codes
+type RedemptionCampaign struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"uniqueIndex;type:varchar(64)"`
+	Status      int    `json:"status" gorm:"default:1"`
+	Budget      int64  `json:"budget" gorm:"bigint;default:0"` // 0 means unlimited
+	UsedBudget  int64  `json:"used_budget" gorm:"bigint;default:0"`
+	ExpiredTime int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	CodeCount   int64  `json:"code_count" gorm:"-:all"` // only for api response
+}
+
+func GetAllCampaigns(startIdx int, num int) ([]*RedemptionCampaign, error) {
+	var campaigns []*RedemptionCampaign
+	err := DB.Order("id desc").Limit(num).Offset(startIdx).Find(&campaigns).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, campaign := range campaigns {
+		DB.Model(&Redemption{}).Where("campaign_id = ?", campaign.Id).Count(&campaign.CodeCount)
+	}
+	return campaigns, nil
+}
+
+func GetCampaignById(id int) (*RedemptionCampaign, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	campaign := RedemptionCampaign{}
+	err := DB.First(&campaign, "id = ?", id).Error
+	return &campaign, err
+}
+
+func (campaign *RedemptionCampaign) Insert() error {
+	campaign.CreatedTime = helper.GetTimestamp()
+	return DB.Create(campaign).Error
+}
+
+func (campaign *RedemptionCampaign) Update() error {
+	return DB.Model(campaign).Select("name", "status", "budget", "expired_time").Updates(campaign).Error
+}
+
+func DeleteCampaignById(id int) error {
+	var count int64
+	err := DB.Model(&Redemption{}).Where("campaign_id = ?", id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该活动下仍有兑换码，无法删除")
+	}
+	return DB.Delete(&RedemptionCampaign{}, id).Error
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"fmt"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+	"strings"
+)
+
+// TokenCapability is embedded into Token, it restricts what the token's requests may do,
+// zero values mean no restriction
+type TokenCapability struct {
+	RelayModes     string `json:"relay_modes" gorm:"type:varchar(255);default:''"` // comma separated names from relaymode, e.g. chat_completions,embeddings
+	MaxTokensLimit int    `json:"max_tokens_limit" gorm:"default:0"`               // upper bound of max_tokens in the request
+	MaxN           int    `json:"max_n" gorm:"default:0"`
+	MaxBodySize    int64  `json:"max_body_size" gorm:"bigint;default:0"` // in bytes
+	ToolsDisabled  bool   `json:"tools_disabled" gorm:"default:false"`
+	VisionDisabled bool   `json:"vision_disabled" gorm:"default:false"`
+	StreamDisabled bool   `json:"stream_disabled" gorm:"default:false"`
+}
+
+func (capability *TokenCapability) Validate() error {
+	if capability.RelayModes != "" {
+		for _, name := range strings.Split(capability.RelayModes, ",") {
+			if relaymode.GetByName(strings.TrimSpace(name)) == relaymode.Unknown {
+				return fmt.Errorf("无效的接口类型：%s", name)
+			}
+		}
+	}
+	if capability.MaxTokensLimit < 0 || capability.MaxN < 0 || capability.MaxBodySize < 0 {
+		return fmt.Errorf("限制不能为负数")
+	}
+	return nil
+}
+
+// AllowsRelayMode reports whether requests of the relay mode may use the token,
+// requests that are not relayed (e.g. listing models) are always allowed
+func (capability *TokenCapability) AllowsRelayMode(mode int) bool {
+	if capability.RelayModes == "" || mode == relaymode.Unknown {
+		return true
+	}
+	for _, name := range strings.Split(capability.RelayModes, ",") {
+		if strings.TrimSpace(name) == relaymode.Name(mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// RestrictsBody reports whether the request body has to be inspected
+func (capability *TokenCapability) RestrictsBody() bool {
+	return capability.MaxTokensLimit > 0 || capability.MaxN > 0 || capability.ToolsDisabled || capability.VisionDisabled || capability.StreamDisabled
+}
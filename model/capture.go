@@ -0,0 +1,116 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// PayloadCapture keeps the redacted request and response of a relay request for debugging.
+type PayloadCapture struct {
+	Id           int    `json:"id"`
+	RequestId    string `json:"request_id" gorm:"type:varchar(64);index"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	TokenId      int    `json:"token_id" gorm:"index"`
+	ChannelId    int    `json:"channel_id" gorm:"index"`
+	Model        string `json:"model" gorm:"default:''"`
+	Path         string `json:"path" gorm:"default:''"`
+	StatusCode   int    `json:"status_code"`
+	RequestBody  string `json:"request_body" gorm:"type:text"`
+	ResponseBody string `json:"response_body" gorm:"type:text"` // streams are kept as sent to the client
+	Truncated    bool   `json:"truncated"`
+}
+
+type captureSettings struct {
+	tokens   map[int]bool
+	channels map[int]bool
+	redactor *logger.PayloadRedactor
+}
+
+var currentCaptureSettings atomic.Pointer[captureSettings]
+
+func parseIdSet(ids string) map[int]bool {
+	set := make(map[int]bool)
+	for _, id := range strings.Split(ids, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(id))
+		if err == nil {
+			set[value] = true
+		}
+	}
+	return set
+}
+
+// ReloadCaptureSettings is called whenever one of the capture options changes
+func ReloadCaptureSettings() {
+	redactor, err := logger.NewPayloadRedactor(strings.Split(config.CaptureRedactKeys, ","), strings.Split(config.CaptureRedactPatterns, "\n"))
+	if err != nil {
+		logger.SysError("invalid capture redact patterns: " + err.Error())
+		redactor, _ = logger.NewPayloadRedactor(strings.Split(config.CaptureRedactKeys, ","), nil)
+	}
+	currentCaptureSettings.Store(&captureSettings{
+		tokens:   parseIdSet(config.CaptureTokenIds),
+		channels: parseIdSet(config.CaptureChannelIds),
+		redactor: redactor,
+	})
+}
+
+func ShouldCapture(tokenId int, channelId int) bool {
+	settings := currentCaptureSettings.Load()
+	if settings == nil {
+		return false
+	}
+	return settings.tokens[tokenId] || settings.channels[channelId]
+}
+
+// RedactCapturedBody redacts the body and keeps at most CaptureMaxBodySize bytes of it
+func RedactCapturedBody(body []byte) (string, bool) {
+	s := string(body)
+	if settings := currentCaptureSettings.Load(); settings != nil {
+		s = settings.redactor.Redact(s)
+	} else {
+		s = logger.Redact(s)
+	}
+	if len(s) > config.CaptureMaxBodySize {
+		return strings.ToValidUTF8(s[:config.CaptureMaxBodySize], ""), true
+	}
+	return s, false
+}
+
+func RecordPayloadCapture(capture *PayloadCapture) {
+	capture.CreatedAt = helper.GetTimestamp()
+	err := LOG_DB.Create(capture).Error
+	if err != nil {
+		logger.SysError("failed to record payload capture: " + err.Error())
+	}
+}
+
+func GetPayloadCaptures(requestId string) (captures []*PayloadCapture, err error) {
+	err = LOG_DB.Where("request_id = ?", requestId).Order("id desc").Find(&captures).Error
+	return captures, err
+}
+
+func DeleteExpiredPayloadCaptures() (int64, error) {
+	targetTimestamp := helper.GetTimestamp() - int64(config.CaptureRetentionHours)*3600
+	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&PayloadCapture{})
+	return result.RowsAffected, result.Error
+}
+
+func CleanPayloadCaptures(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		count, err := DeleteExpiredPayloadCaptures()
+		if err != nil {
+			logger.SysError("failed to delete expired payload captures: " + err.Error())
+			continue
+		}
+		if count > 0 {
+			logger.SysLogf("deleted %d expired payload captures", count)
+		}
+	}
+}
@@ -17,25 +17,27 @@ const (
 )
 
 type Channel struct {
-	Id                 int     `json:"id"`
-	Type               int     `json:"type" gorm:"default:0"`
-	Key                string  `json:"key" gorm:"type:text"`
-	Status             int     `json:"status" gorm:"default:1"`
-	Name               string  `json:"name" gorm:"index"`
-	Weight             *uint   `json:"weight" gorm:"default:0"`
-	CreatedTime        int64   `json:"created_time" gorm:"bigint"`
-	TestTime           int64   `json:"test_time" gorm:"bigint"`
-	ResponseTime       int     `json:"response_time"` // in milliseconds
-	BaseURL            *string `json:"base_url" gorm:"column:base_url;default:''"`
-	Other              *string `json:"other"`   // DEPRECATED: please save config to field Config
-	Balance            float64 `json:"balance"` // in USD
-	BalanceUpdatedTime int64   `json:"balance_updated_time" gorm:"bigint"`
-	Models             string  `json:"models"`
-	Group              string  `json:"group" gorm:"type:varchar(32);default:'default'"`
-	UsedQuota          int64   `json:"used_quota" gorm:"bigint;default:0"`
-	ModelMapping       *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
-	Priority           *int64  `json:"priority" gorm:"bigint;default:0"`
-	Config             string  `json:"config"`
+	Id                   int     `json:"id"`
+	Type                 int     `json:"type" gorm:"default:0"`
+	Key                  string  `json:"key" gorm:"type:text"`
+	Status               int     `json:"status" gorm:"default:1"`
+	Name                 string  `json:"name" gorm:"index"`
+	Weight               *uint   `json:"weight" gorm:"default:0"`
+	CreatedTime          int64   `json:"created_time" gorm:"bigint"`
+	TestTime             int64   `json:"test_time" gorm:"bigint"`
+	ResponseTime         int     `json:"response_time"`                            // in milliseconds
+	AvgLatency           int     `json:"avg_latency" gorm:"default:0"`             // moving average of live traffic, in milliseconds
+	AvgFirstTokenLatency int     `json:"avg_first_token_latency" gorm:"default:0"` // streams only
+	BaseURL              *string `json:"base_url" gorm:"column:base_url;default:''"`
+	Other                *string `json:"other"`   // DEPRECATED: please save config to field Config
+	Balance              float64 `json:"balance"` // in USD
+	BalanceUpdatedTime   int64   `json:"balance_updated_time" gorm:"bigint"`
+	Models               string  `json:"models"`
+	Group                string  `json:"group" gorm:"type:varchar(32);default:'default'"`
+	UsedQuota            int64   `json:"used_quota" gorm:"bigint;default:0"`
+	ModelMapping         *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
+	Priority             *int64  `json:"priority" gorm:"bigint;default:0"`
+	Config               string  `json:"config"`
 }
 
 type ChannelConfig struct {
@@ -62,6 +64,12 @@ func GetAllChannels(startIdx int, num int, scope string) ([]*Channel, error) {
 	return channels, err
 }
 
+// GetChannelStatuses returns all channels with only id, name, type and status filled
+func GetChannelStatuses() (channels []*Channel, err error) {
+	err = DB.Select("id", "name", "type", "status").Find(&channels).Error
+	return channels, err
+}
+
 func SearchChannels(keyword string) (channels []*Channel, err error) {
 	err = DB.Omit("key").Where("id = ? or name LIKE ?", helper.String2Int(keyword), keyword+"%").Find(&channels).Error
 	return channels, err
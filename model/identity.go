@@ -0,0 +1,57 @@
+package model
+
+import (
+	"errors"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+const (
+	IdentityProviderOidc = "oidc"
+)
+
+// UserIdentity links a user to an account of an external identity provider
+type UserIdentity struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	Provider      string `json:"provider" gorm:"type:varchar(32);uniqueIndex:idx_provider_subject"`
+	Subject       string `json:"subject" gorm:"type:varchar(255);uniqueIndex:idx_provider_subject"`
+	Email         string `json:"email"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	LastLoginTime int64  `json:"last_login_time" gorm:"bigint"`
+}
+
+func GetUserIdentity(provider string, subject string) (*UserIdentity, error) {
+	if provider == "" || subject == "" {
+		return nil, errors.New("provider 或 subject 为空！")
+	}
+	identity := UserIdentity{}
+	err := DB.First(&identity, "provider = ? and subject = ?", provider, subject).Error
+	return &identity, err
+}
+
+func GetUserIdentities(userId int) (identities []*UserIdentity, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id").Find(&identities).Error
+	return identities, err
+}
+
+func (identity *UserIdentity) Insert() error {
+	identity.CreatedTime = helper.GetTimestamp()
+	identity.LastLoginTime = identity.CreatedTime
+	return DB.Create(identity).Error
+}
+
+func (identity *UserIdentity) UpdateLoginTime() error {
+	identity.LastLoginTime = helper.GetTimestamp()
+	return DB.Model(identity).Update("last_login_time", identity.LastLoginTime).Error
+}
+
+func DeleteUserIdentity(id int, userId int) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("该身份不存在")
+	}
+	return nil
+}
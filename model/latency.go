@@ -0,0 +1,161 @@
+package model
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// RelayStats collects the timings of a relay request, it travels in the request context
+type RelayStats struct {
+	StartTime      time.Time
+	FirstTokenTime time.Time // only set for streams
+	EndTime        time.Time // set when the response is finished, before billing
+	UpstreamStatus int
+	RetryCount     int
+	// usage rollup dimensions, known once the channel is selected
+	TokenId   int
+	Group     string
+	ModelName string
+}
+
+type relayStatsContextKey struct{}
+
+func WithRelayStats(ctx context.Context, stats *RelayStats) context.Context {
+	return context.WithValue(ctx, relayStatsContextKey{}, stats)
+}
+
+// RelayStatsFromContext returns nil if the request is not a relay request
+func RelayStatsFromContext(ctx context.Context) *RelayStats {
+	stats, _ := ctx.Value(relayStatsContextKey{}).(*RelayStats)
+	return stats
+}
+
+func (stats *RelayStats) SetUpstreamStatus(status int) {
+	if stats == nil {
+		return
+	}
+	stats.UpstreamStatus = status
+}
+
+func (stats *RelayStats) SetUsageDimensions(tokenId int, group string, modelName string) {
+	if stats == nil {
+		return
+	}
+	stats.TokenId = tokenId
+	stats.Group = group
+	stats.ModelName = modelName
+}
+
+func (stats *RelayStats) AddRetry() {
+	if stats == nil {
+		return
+	}
+	stats.RetryCount++
+}
+
+// DetachRelayStats marks the response as finished and returns a context with a copy of the stats,
+// call it in the request goroutine before handing the context to the billing goroutine
+func DetachRelayStats(ctx context.Context) context.Context {
+	stats := RelayStatsFromContext(ctx)
+	if stats == nil {
+		return ctx
+	}
+	if stats.EndTime.IsZero() {
+		stats.EndTime = time.Now()
+	}
+	detached := *stats
+	return WithRelayStats(ctx, &detached)
+}
+
+// Latency returns the milliseconds until the response was finished and until the first token was sent
+func (stats *RelayStats) Latency() (total int64, firstToken int64) {
+	if stats == nil {
+		return 0, 0
+	}
+	end := stats.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	total = end.Sub(stats.StartTime).Milliseconds()
+	if !stats.FirstTokenTime.IsZero() {
+		firstToken = stats.FirstTokenTime.Sub(stats.StartTime).Milliseconds()
+	}
+	return total, firstToken
+}
+
+// each request moves the channel averages this much towards its own latency
+const channelLatencyDecay = 0.05
+
+type channelLatencySum struct {
+	latency         int64
+	count           int
+	firstToken      int64
+	firstTokenCount int
+}
+
+var channelLatencySums = make(map[int]*channelLatencySum)
+var channelLatencyLock sync.Mutex
+
+// RecordChannelLatency remembers the latency of a successful request until the next flush
+func RecordChannelLatency(channelId int, latency int64, firstToken int64) {
+	if channelId == 0 || latency <= 0 {
+		return
+	}
+	channelLatencyLock.Lock()
+	defer channelLatencyLock.Unlock()
+	sum, ok := channelLatencySums[channelId]
+	if !ok {
+		sum = &channelLatencySum{}
+		channelLatencySums[channelId] = sum
+	}
+	sum.latency += latency
+	sum.count++
+	if firstToken > 0 {
+		sum.firstToken += firstToken
+		sum.firstTokenCount++
+	}
+}
+
+func movingAverage(current int, sum int64, count int) int {
+	if count == 0 {
+		return current
+	}
+	mean := float64(sum) / float64(count)
+	if current == 0 {
+		return int(math.Round(mean))
+	}
+	weight := 1 - math.Pow(1-channelLatencyDecay, float64(count))
+	return int(math.Round(float64(current) + (mean-float64(current))*weight))
+}
+
+func flushChannelLatencies() {
+	channelLatencyLock.Lock()
+	sums := channelLatencySums
+	channelLatencySums = make(map[int]*channelLatencySum)
+	channelLatencyLock.Unlock()
+	for channelId, sum := range sums {
+		channel := &Channel{}
+		err := DB.Select("id", "avg_latency", "avg_first_token_latency").First(channel, "id = ?", channelId).Error
+		if err != nil {
+			continue
+		}
+		err = DB.Model(channel).Select("avg_latency", "avg_first_token_latency").Updates(Channel{
+			AvgLatency:           movingAverage(channel.AvgLatency, sum.latency, sum.count),
+			AvgFirstTokenLatency: movingAverage(channel.AvgFirstTokenLatency, sum.firstToken, sum.firstTokenCount),
+		}).Error
+		if err != nil {
+			logger.SysError("failed to update channel latency: " + err.Error())
+		}
+	}
+}
+
+func SyncChannelLatencies(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		flushChannelLatencies()
+	}
+}
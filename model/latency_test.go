@@ -0,0 +1,49 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestDetachRelayStats(t *testing.T) {
+	Convey("the latency ends when the stats are detached", t, func() {
+		start := time.Now().Add(-2 * time.Second)
+		stats := &RelayStats{StartTime: start, FirstTokenTime: start.Add(500 * time.Millisecond)}
+		ctx := DetachRelayStats(WithRelayStats(context.Background(), stats))
+		detached := RelayStatsFromContext(ctx)
+		So(detached, ShouldNotPointTo, stats)
+		So(detached.EndTime.IsZero(), ShouldBeFalse)
+
+		// later changes of the request don't reach the copy
+		stats.RetryCount = 3
+		So(detached.RetryCount, ShouldEqual, 0)
+
+		latency, firstToken := detached.Latency()
+		So(firstToken, ShouldEqual, 500)
+		time.Sleep(20 * time.Millisecond)
+		later, _ := detached.Latency()
+		So(later, ShouldEqual, latency)
+	})
+	Convey("contexts without stats are kept", t, func() {
+		ctx := context.Background()
+		So(DetachRelayStats(ctx), ShouldEqual, ctx)
+	})
+}
+
+func TestRecordConsumeLogLatency(t *testing.T) {
+	setupTestDB(t, &User{}, &Log{})
+	config.LogConsumeEnabled = true
+	Convey("the logged latency doesn't include the billing", t, func() {
+		end := time.Now().Add(-time.Second)
+		stats := &RelayStats{StartTime: end.Add(-1500 * time.Millisecond), EndTime: end, UpstreamStatus: 200}
+		RecordConsumeLog(DetachRelayStats(WithRelayStats(context.Background(), stats)), 1, 0, 10, 20, "gpt-4o", "default", 30, "")
+		var log Log
+		So(LOG_DB.Where("type = ?", LogTypeConsume).First(&log).Error, ShouldBeNil)
+		So(log.Latency, ShouldEqual, 1500)
+		So(log.UpstreamStatus, ShouldEqual, 200)
+	})
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"fmt"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"time"
+)
+
+const monthWindow = 30 * 24 * time.Hour
+
+// TokenLimit is embedded into Token, all limits apply to rolling windows and 0 means unlimited
+type TokenLimit struct {
+	HourlyQuotaLimit   int64 `json:"hourly_quota_limit" gorm:"bigint;default:0"`
+	DailyQuotaLimit    int64 `json:"daily_quota_limit" gorm:"bigint;default:0"`
+	MonthlyQuotaLimit  int64 `json:"monthly_quota_limit" gorm:"bigint;default:0"`
+	MinuteRequestLimit int64 `json:"minute_request_limit" gorm:"bigint;default:0"`
+	HourlyRequestLimit int64 `json:"hourly_request_limit" gorm:"bigint;default:0"`
+	DailyRequestLimit  int64 `json:"daily_request_limit" gorm:"bigint;default:0"`
+}
+
+type TokenLimitExceededError struct {
+	Message string
+	ResetAt time.Time
+}
+
+func (e *TokenLimitExceededError) Error() string {
+	return e.Message
+}
+
+type tokenWindowLimit struct {
+	name   string
+	window time.Duration
+	limit  int64
+}
+
+func (limit *TokenLimit) quotaLimits() []tokenWindowLimit {
+	return []tokenWindowLimit{
+		{"一小时", time.Hour, limit.HourlyQuotaLimit},
+		{"一天", 24 * time.Hour, limit.DailyQuotaLimit},
+		{"一个月", monthWindow, limit.MonthlyQuotaLimit},
+	}
+}
+
+func (limit *TokenLimit) requestLimits() []tokenWindowLimit {
+	return []tokenWindowLimit{
+		{"一分钟", time.Minute, limit.MinuteRequestLimit},
+		{"一小时", time.Hour, limit.HourlyRequestLimit},
+		{"一天", 24 * time.Hour, limit.DailyRequestLimit},
+	}
+}
+
+func (limit *TokenLimit) Validate() error {
+	for _, l := range append(limit.quotaLimits(), limit.requestLimits()...) {
+		if l.limit < 0 {
+			return fmt.Errorf("限额不能为负数")
+		}
+	}
+	return nil
+}
+
+func tokenSpendKey(tokenId int, window time.Duration) string {
+	return fmt.Sprintf("token_spend:%d:%d", tokenId, int64(window.Seconds()))
+}
+
+func tokenRequestKey(tokenId int, window time.Duration) string {
+	return fmt.Sprintf("token_request:%d:%d", tokenId, int64(window.Seconds()))
+}
+
+// CheckAndCountTokenRequest checks the token's spend and request limits,
+// and counts the request if it is allowed. Counters that fail are logged and skipped,
+// so that an outage of Redis doesn't fail every request.
+func CheckAndCountTokenRequest(token *Token) error {
+	for _, l := range token.quotaLimits() {
+		if l.limit <= 0 {
+			continue
+		}
+		spent, resetAt, err := common.WindowCounterGet(tokenSpendKey(token.Id, l.window), l.window, l.limit)
+		if err != nil {
+			logger.SysError("failed to get token spend: " + err.Error())
+			continue
+		}
+		if spent >= l.limit {
+			return &TokenLimitExceededError{
+				Message: fmt.Sprintf("令牌在最近%s内的消费已达上限 %s，请于 %s 后重试", l.name, common.LogQuota(l.limit), resetAt.Format("2006-01-02 15:04:05")),
+				ResetAt: resetAt,
+			}
+		}
+	}
+	// the request is counted first and taken back if it exceeds a limit, so concurrent requests can't all pass
+	var counted []tokenWindowLimit
+	for _, l := range token.requestLimits() {
+		if l.limit <= 0 {
+			continue
+		}
+		count, resetAt, err := common.WindowCounterIncrease(tokenRequestKey(token.Id, l.window), l.window, 1, l.limit)
+		if err != nil {
+			logger.SysError("failed to count token request: " + err.Error())
+			continue
+		}
+		counted = append(counted, l)
+		if count > l.limit {
+			for _, c := range counted {
+				err = common.WindowCounterAdd(tokenRequestKey(token.Id, c.window), c.window, -1)
+				if err != nil {
+					logger.SysError("failed to take back token request: " + err.Error())
+				}
+			}
+			return &TokenLimitExceededError{
+				Message: fmt.Sprintf("令牌在最近%s内的请求次数已达上限 %d，请于 %s 后重试", l.name, l.limit, resetAt.Format("2006-01-02 15:04:05")),
+				ResetAt: resetAt,
+			}
+		}
+	}
+	return nil
+}
+
+var spendWindows = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour, monthWindow}
+
+// recordSpend tracks the consumption of the token for spend limits,
+// quota can be negative when pre-consumed quota is returned
+func recordSpend(tokenId int, quota int64) {
+	if quota == 0 {
+		return
+	}
+	for _, window := range spendWindows {
+		err := common.WindowCounterAdd(tokenSpendKey(tokenId, window), window, quota)
+		if err != nil {
+			logger.SysError("failed to record token spend: " + err.Error())
+		}
+	}
+}
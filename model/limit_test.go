@@ -0,0 +1,37 @@
+package model
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+)
+
+func TestCheckAndCountTokenRequest(t *testing.T) {
+	common.RedisEnabled = false
+	Convey("concurrent requests don't pass the request limit", t, func() {
+		token := &Token{Id: 1001, TokenLimit: TokenLimit{MinuteRequestLimit: 5, DailyRequestLimit: 100}}
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		allowed := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if CheckAndCountTokenRequest(token) == nil {
+					lock.Lock()
+					allowed++
+					lock.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		So(allowed, ShouldEqual, 5)
+		// rejected requests are taken back from the other windows
+		count, _, err := common.WindowCounterGet(tokenRequestKey(token.Id, 24*time.Hour), 24*time.Hour, 100)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 5)
+	})
+}
@@ -7,22 +7,32 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/metrics"
 	"gorm.io/gorm"
+	"strconv"
 )
 
 type Log struct {
-	Id               int    `json:"id"`
-	UserId           int    `json:"user_id" gorm:"index"`
-	CreatedAt        int64  `json:"created_at" gorm:"bigint;index:idx_created_at_type"`
-	Type             int    `json:"type" gorm:"index:idx_created_at_type"`
-	Content          string `json:"content"`
-	Username         string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
-	TokenName        string `json:"token_name" gorm:"index;default:''"`
-	ModelName        string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
-	Quota            int    `json:"quota" gorm:"default:0"`
-	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
-	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
-	ChannelId        int    `json:"channel" gorm:"index"`
+	Id                int    `json:"id"`
+	UserId            int    `json:"user_id" gorm:"index"`
+	CreatedAt         int64  `json:"created_at" gorm:"bigint;index:idx_created_at_type"`
+	Type              int    `json:"type" gorm:"index:idx_created_at_type"`
+	Content           string `json:"content"`
+	Username          string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
+	TokenName         string `json:"token_name" gorm:"index;default:''"`
+	ModelName         string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
+	Quota             int    `json:"quota" gorm:"default:0"`
+	PromptTokens      int    `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens  int    `json:"completion_tokens" gorm:"default:0"`
+	ChannelId         int    `json:"channel" gorm:"index"`
+	OrgId             int    `json:"org_id" gorm:"index;default:0"`               // the organization whose pool paid for it
+	Latency           int64  `json:"latency" gorm:"bigint;default:0"`             // in milliseconds
+	FirstTokenLatency int64  `json:"first_token_latency" gorm:"bigint;default:0"` // in milliseconds, streams only
+	UpstreamStatus    int    `json:"upstream_status" gorm:"default:0"`
+	RetryCount        int    `json:"retry_count" gorm:"default:0"`
+	TokenId           int    `json:"token_id" gorm:"default:0"`
+	GroupName         string `json:"group_name" gorm:"default:''"`
+	RedemptionId      int    `json:"redemption_id" gorm:"default:0"` // set on the top-up logs of redemptions
 }
 
 const (
@@ -65,23 +75,56 @@ func RecordTopupLog(userId int, content string, quota int) {
 	}
 }
 
+// RecordRedemptionLog records the top-up of a redemption, statements list redemptions apart from other top-ups
+func RecordRedemptionLog(userId int, redemptionId int, content string, quota int) {
+	log := &Log{
+		UserId:       userId,
+		Username:     GetUsernameById(userId),
+		CreatedAt:    helper.GetTimestamp(),
+		Type:         LogTypeTopup,
+		Content:      content,
+		Quota:        quota,
+		RedemptionId: redemptionId,
+	}
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		logger.SysError("failed to record log: " + err.Error())
+	}
+}
+
 func RecordConsumeLog(ctx context.Context, userId int, channelId int, promptTokens int, completionTokens int, modelName string, tokenName string, quota int64, content string) {
-	logger.Info(ctx, fmt.Sprintf("record consume log: userId=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, content=%s", userId, channelId, promptTokens, completionTokens, modelName, tokenName, quota, content))
+	stats := RelayStatsFromContext(ctx)
+	latency, firstTokenLatency := stats.Latency()
+	logger.Info(ctx, fmt.Sprintf("record consume log: userId=%d, channelId=%d, promptTokens=%d, completionTokens=%d, modelName=%s, tokenName=%s, quota=%d, latency=%dms, content=%s", userId, channelId, promptTokens, completionTokens, modelName, tokenName, quota, latency, content))
+	RecordChannelLatency(channelId, latency, firstTokenLatency)
+	channel := strconv.Itoa(channelId)
+	metrics.RelayTokens.WithLabelValues(modelName, channel, "prompt").Add(float64(promptTokens))
+	metrics.RelayTokens.WithLabelValues(modelName, channel, "completion").Add(float64(completionTokens))
+	metrics.QuotaConsumed.WithLabelValues(modelName, channel).Add(float64(quota))
 	if !config.LogConsumeEnabled {
 		return
 	}
 	log := &Log{
-		UserId:           userId,
-		Username:         GetUsernameById(userId),
-		CreatedAt:        helper.GetTimestamp(),
-		Type:             LogTypeConsume,
-		Content:          content,
-		PromptTokens:     promptTokens,
-		CompletionTokens: completionTokens,
-		TokenName:        tokenName,
-		ModelName:        modelName,
-		Quota:            int(quota),
-		ChannelId:        channelId,
+		UserId:            userId,
+		Username:          GetUsernameById(userId),
+		CreatedAt:         helper.GetTimestamp(),
+		Type:              LogTypeConsume,
+		Content:           content,
+		PromptTokens:      promptTokens,
+		CompletionTokens:  completionTokens,
+		TokenName:         tokenName,
+		ModelName:         modelName,
+		Quota:             int(quota),
+		ChannelId:         channelId,
+		OrgId:             orgIdFromContext(ctx),
+		Latency:           latency,
+		FirstTokenLatency: firstTokenLatency,
+	}
+	if stats != nil {
+		log.UpstreamStatus = stats.UpstreamStatus
+		log.RetryCount = stats.RetryCount
+		log.TokenId = stats.TokenId
+		log.GroupName = stats.Group
 	}
 	err := LOG_DB.Create(log).Error
 	if err != nil {
@@ -196,11 +239,6 @@ func SumUsedToken(logType int, startTimestamp int64, endTimestamp int64, modelNa
 	return token
 }
 
-func DeleteOldLog(targetTimestamp int64) (int64, error) {
-	result := LOG_DB.Where("created_at < ?", targetTimestamp).Delete(&Log{})
-	return result.RowsAffected, result.Error
-}
-
 type LogStatistic struct {
 	Day              string `gorm:"column:day"`
 	ModelName        string `gorm:"column:model_name"`
@@ -210,16 +248,18 @@ type LogStatistic struct {
 	CompletionTokens int    `gorm:"column:completion_tokens"`
 }
 
-func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatistic, err error) {
-	groupSelect := "DATE_FORMAT(FROM_UNIXTIME(created_at), '%Y-%m-%d') as day"
-
+func dayGroupSelect() string {
 	if common.UsingPostgreSQL {
-		groupSelect = "TO_CHAR(date_trunc('day', to_timestamp(created_at)), 'YYYY-MM-DD') as day"
+		return "TO_CHAR(date_trunc('day', to_timestamp(created_at)), 'YYYY-MM-DD') as day"
 	}
-
 	if common.UsingSQLite {
-		groupSelect = "strftime('%Y-%m-%d', datetime(created_at, 'unixepoch')) as day"
+		return "strftime('%Y-%m-%d', datetime(created_at, 'unixepoch')) as day"
 	}
+	return "DATE_FORMAT(FROM_UNIXTIME(created_at), '%Y-%m-%d') as day"
+}
+
+func SearchLogsByDayAndModel(userId, start, end int) (LogStatistics []*LogStatistic, err error) {
+	groupSelect := dayGroupSelect()
 
 	err = LOG_DB.Raw(`
 		SELECT `+groupSelect+`,
@@ -44,7 +44,7 @@ func CreateRootAccountIfNeed() error {
 			token := Token{
 				Id:             1,
 				UserId:         rootUser.Id,
-				Key:            config.InitialRootToken,
+				RawKey:         config.InitialRootToken,
 				Status:         TokenStatusEnabled,
 				Name:           "Initial Root Token",
 				CreatedTime:    helper.GetTimestamp(),
@@ -53,7 +53,9 @@ func CreateRootAccountIfNeed() error {
 				RemainQuota:    500000000000000,
 				UnlimitedQuota: true,
 			}
-			DB.Create(&token)
+			if err := token.Insert(); err != nil {
+				logger.SysError("failed to create initial root token: " + err.Error())
+			}
 		}
 	}
 	return nil
@@ -138,6 +140,66 @@ func InitDB(envName string) (db *gorm.DB, err error) {
 		if err != nil {
 			return nil, err
 		}
+		err = db.AutoMigrate(&AuditLog{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&PayloadCapture{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&UsageRollup{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&UsageRollupCursor{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&UserIdentity{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&Session{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&TwoFactor{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&ManagementToken{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&Ban{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&Organization{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&OrganizationMember{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&RedemptionUse{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&RedemptionCampaign{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&AlertRule{})
+		if err != nil {
+			return nil, err
+		}
+		err = db.AutoMigrate(&AlertFiring{})
+		if err != nil {
+			return nil, err
+		}
 		logger.SysLog("database migrated")
 		return db, err
 	} else {
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/songquanpeng/one-api/common"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDB points DB and LOG_DB to an in-memory sqlite database of the test
+func setupTestDB(t *testing.T, models ...any) {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(models...); err != nil {
+		t.Fatal(err)
+	}
+	DB, LOG_DB = db, db
+	common.RedisEnabled = false
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	"strings"
+)
+
+const ManagementTokenPrefix = "mt-"
+
+// Scopes of management tokens, "<resource>:write" implies "<resource>:read"
+const (
+	ScopeAll = "*"
+
+	ScopeLogRead         = "log:read"
+	ScopeLogWrite        = "log:write"
+	ScopeTokenRead       = "token:read"
+	ScopeTokenWrite      = "token:write"
+	ScopeChannelRead     = "channel:read"
+	ScopeChannelWrite    = "channel:write"
+	ScopeUserRead        = "user:read"
+	ScopeUserWrite       = "user:write"
+	ScopeRedemptionRead  = "redemption:read"
+	ScopeRedemptionWrite = "redemption:write"
+	ScopeOptionRead      = "option:read"
+	ScopeOptionWrite     = "option:write"
+	ScopeAlertRead       = "alert:read"
+	ScopeAlertWrite      = "alert:write"
+	ScopeOrgRead         = "org:read"
+	ScopeOrgWrite        = "org:write"
+)
+
+var ValidScopes = map[string]bool{
+	ScopeAll:             true,
+	ScopeLogRead:         true,
+	ScopeLogWrite:        true,
+	ScopeTokenRead:       true,
+	ScopeTokenWrite:      true,
+	ScopeChannelRead:     true,
+	ScopeChannelWrite:    true,
+	ScopeUserRead:        true,
+	ScopeUserWrite:       true,
+	ScopeRedemptionRead:  true,
+	ScopeRedemptionWrite: true,
+	ScopeOptionRead:      true,
+	ScopeOptionWrite:     true,
+	ScopeAlertRead:       true,
+	ScopeAlertWrite:      true,
+	ScopeOrgRead:         true,
+	ScopeOrgWrite:        true,
+}
+
+// ManagementToken is a named credential for the management api, unlike User.AccessToken
+// it's limited to some scopes and can be revoked on its own. Only the hash of the key is kept.
+type ManagementToken struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Name         string `json:"name" gorm:"index"`
+	KeyHash      string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	KeyPrefix    string `json:"key_prefix" gorm:"type:varchar(16)"`
+	Scopes       string `json:"scopes"`                                // comma separated
+	AllowedIps   string `json:"allowed_ips"`                           // comma separated subnets, empty means any
+	ExpiredTime  int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+}
+
+func hashManagementTokenKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func IsManagementTokenKey(key string) bool {
+	return strings.HasPrefix(key, ManagementTokenPrefix)
+}
+
+func GetUserManagementTokens(userId int) (tokens []*ManagementToken, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+func GetManagementTokenByIds(id int, userId int) (*ManagementToken, error) {
+	if id == 0 || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	token := ManagementToken{Id: id, UserId: userId}
+	err := DB.First(&token, "id = ? and user_id = ?", id, userId).Error
+	return &token, err
+}
+
+// Insert generates the key of the token, which is returned only this once
+func (token *ManagementToken) Insert() (string, error) {
+	key := ManagementTokenPrefix + random.GetUUID()
+	token.KeyHash = hashManagementTokenKey(key)
+	token.KeyPrefix = key[:len(ManagementTokenPrefix)+6]
+	token.CreatedTime = helper.GetTimestamp()
+	token.LastUsedTime = 0
+	err := DB.Create(token).Error
+	return key, err
+}
+
+func (token *ManagementToken) Update() error {
+	return DB.Model(token).Select("name", "scopes", "allowed_ips", "expired_time").Updates(token).Error
+}
+
+func DeleteManagementTokenById(id int, userId int) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&ManagementToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("该令牌不存在")
+	}
+	return nil
+}
+
+// ValidateManagementToken looks the key up, checks its expiry and records the usage
+func ValidateManagementToken(key string) (*ManagementToken, error) {
+	token := ManagementToken{}
+	err := DB.First(&token, "key_hash = ?", hashManagementTokenKey(key)).Error
+	if err != nil {
+		return nil, errors.New("access token 无效")
+	}
+	now := helper.GetTimestamp()
+	if token.ExpiredTime != -1 && token.ExpiredTime < now {
+		return nil, errors.New("access token 已过期")
+	}
+	if now-token.LastUsedTime >= 60 {
+		// at most one write per minute for a busy script
+		DB.Model(&ManagementToken{}).Where("id = ?", token.Id).Update("last_used_time", now)
+	}
+	return &token, nil
+}
+
+func (token *ManagementToken) ScopeList() []string {
+	var scopes []string
+	for _, scope := range strings.Split(token.Scopes, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// HasScope reports whether the token grants the scope, a write scope grants the read one too
+func (token *ManagementToken) HasScope(scope string) bool {
+	resource, action, _ := strings.Cut(scope, ":")
+	for _, granted := range token.ScopeList() {
+		if granted == ScopeAll || granted == scope {
+			return true
+		}
+		if action == "read" && granted == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
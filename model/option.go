@@ -29,6 +29,8 @@ func InitOptionMap() {
 	config.OptionMap["EmailVerificationEnabled"] = strconv.FormatBool(config.EmailVerificationEnabled)
 	config.OptionMap["GitHubOAuthEnabled"] = strconv.FormatBool(config.GitHubOAuthEnabled)
 	config.OptionMap["WeChatAuthEnabled"] = strconv.FormatBool(config.WeChatAuthEnabled)
+	config.OptionMap["OidcEnabled"] = strconv.FormatBool(config.OidcEnabled)
+	config.OptionMap["AdminTwoFactorEnabled"] = strconv.FormatBool(config.AdminTwoFactorEnabled)
 	config.OptionMap["TurnstileCheckEnabled"] = strconv.FormatBool(config.TurnstileCheckEnabled)
 	config.OptionMap["RegisterEnabled"] = strconv.FormatBool(config.RegisterEnabled)
 	config.OptionMap["AutomaticDisableChannelEnabled"] = strconv.FormatBool(config.AutomaticDisableChannelEnabled)
@@ -54,6 +56,16 @@ func InitOptionMap() {
 	config.OptionMap["ServerAddress"] = ""
 	config.OptionMap["GitHubClientId"] = ""
 	config.OptionMap["GitHubClientSecret"] = ""
+	config.OptionMap["OidcIssuer"] = ""
+	config.OptionMap["OidcClientId"] = ""
+	config.OptionMap["OidcClientSecret"] = ""
+	config.OptionMap["OidcScopes"] = config.OidcScopes
+	config.OptionMap["OidcUsernameClaim"] = config.OidcUsernameClaim
+	config.OptionMap["OidcEmailClaim"] = config.OidcEmailClaim
+	config.OptionMap["OidcDisplayNameClaim"] = config.OidcDisplayNameClaim
+	config.OptionMap["OidcGroupClaim"] = config.OidcGroupClaim
+	config.OptionMap["OidcGroupMapping"] = config.OidcGroupMapping
+	config.OptionMap["OidcDefaultGroup"] = config.OidcDefaultGroup
 	config.OptionMap["WeChatServerAddress"] = ""
 	config.OptionMap["WeChatServerToken"] = ""
 	config.OptionMap["WeChatAccountQRCodeImageURL"] = ""
@@ -69,12 +81,31 @@ func InitOptionMap() {
 	config.OptionMap["ModelRatio"] = billingratio.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
 	config.OptionMap["CompletionRatio"] = billingratio.CompletionRatio2JSONString()
+	config.OptionMap["ModelMaxOutputTokens"] = billingratio.ModelMaxOutputTokens2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
+	config.OptionMap["TokenRotationGracePeriod"] = strconv.FormatInt(config.TokenRotationGracePeriod, 10)
+	config.OptionMap["SessionIdleTimeout"] = strconv.FormatInt(config.SessionIdleTimeout, 10)
+	config.OptionMap["SessionAbsoluteTimeout"] = strconv.FormatInt(config.SessionAbsoluteTimeout, 10)
+	config.OptionMap["LoginLockoutThreshold"] = strconv.Itoa(config.LoginLockoutThreshold)
+	config.OptionMap["LoginLockoutDuration"] = strconv.FormatInt(config.LoginLockoutDuration, 10)
+	config.OptionMap["PasswordMinLength"] = strconv.Itoa(config.PasswordMinLength)
+	config.OptionMap["LogLevel"] = config.LogLevel
+	config.OptionMap["CaptureTokenIds"] = config.CaptureTokenIds
+	config.OptionMap["CaptureChannelIds"] = config.CaptureChannelIds
+	config.OptionMap["CaptureMaxBodySize"] = strconv.Itoa(config.CaptureMaxBodySize)
+	config.OptionMap["CaptureRetentionHours"] = strconv.Itoa(config.CaptureRetentionHours)
+	config.OptionMap["CaptureRedactKeys"] = config.CaptureRedactKeys
+	config.OptionMap["CaptureRedactPatterns"] = config.CaptureRedactPatterns
+	config.OptionMap["LogRetentionDaysTopup"] = strconv.Itoa(config.LogRetentionDaysTopup)
+	config.OptionMap["LogRetentionDaysConsume"] = strconv.Itoa(config.LogRetentionDaysConsume)
+	config.OptionMap["LogRetentionDaysManage"] = strconv.Itoa(config.LogRetentionDaysManage)
+	config.OptionMap["LogRetentionDaysSystem"] = strconv.Itoa(config.LogRetentionDaysSystem)
 	config.OptionMap["Theme"] = config.Theme
 	config.OptionMapRWMutex.Unlock()
+	ReloadCaptureSettings()
 	loadOptionsFromDatabase()
 }
 
@@ -132,6 +163,10 @@ func updateOptionMap(key string, value string) (err error) {
 			config.GitHubOAuthEnabled = boolValue
 		case "WeChatAuthEnabled":
 			config.WeChatAuthEnabled = boolValue
+		case "OidcEnabled":
+			config.OidcEnabled = boolValue
+		case "AdminTwoFactorEnabled":
+			config.AdminTwoFactorEnabled = boolValue
 		case "TurnstileCheckEnabled":
 			config.TurnstileCheckEnabled = boolValue
 		case "RegisterEnabled":
@@ -176,6 +211,26 @@ func updateOptionMap(key string, value string) (err error) {
 		config.LarkClientId = value
 	case "LarkClientSecret":
 		config.LarkClientSecret = value
+	case "OidcIssuer":
+		config.OidcIssuer = value
+	case "OidcClientId":
+		config.OidcClientId = value
+	case "OidcClientSecret":
+		config.OidcClientSecret = value
+	case "OidcScopes":
+		config.OidcScopes = value
+	case "OidcUsernameClaim":
+		config.OidcUsernameClaim = value
+	case "OidcEmailClaim":
+		config.OidcEmailClaim = value
+	case "OidcDisplayNameClaim":
+		config.OidcDisplayNameClaim = value
+	case "OidcGroupClaim":
+		config.OidcGroupClaim = value
+	case "OidcGroupMapping":
+		config.OidcGroupMapping = value
+	case "OidcDefaultGroup":
+		config.OidcDefaultGroup = value
 	case "Footer":
 		config.Footer = value
 	case "SystemName":
@@ -208,12 +263,54 @@ func updateOptionMap(key string, value string) (err error) {
 		config.PreConsumedQuota, _ = strconv.ParseInt(value, 10, 64)
 	case "RetryTimes":
 		config.RetryTimes, _ = strconv.Atoi(value)
+	case "TokenRotationGracePeriod":
+		config.TokenRotationGracePeriod, _ = strconv.ParseInt(value, 10, 64)
+	case "SessionIdleTimeout":
+		config.SessionIdleTimeout, _ = strconv.ParseInt(value, 10, 64)
+	case "SessionAbsoluteTimeout":
+		config.SessionAbsoluteTimeout, _ = strconv.ParseInt(value, 10, 64)
+	case "LoginLockoutThreshold":
+		config.LoginLockoutThreshold, _ = strconv.Atoi(value)
+	case "LoginLockoutDuration":
+		config.LoginLockoutDuration, _ = strconv.ParseInt(value, 10, 64)
+	case "PasswordMinLength":
+		config.PasswordMinLength, _ = strconv.Atoi(value)
+	case "LogLevel":
+		if err := logger.SetLevel(value); err == nil {
+			config.LogLevel = value
+		}
+	case "CaptureTokenIds":
+		config.CaptureTokenIds = value
+		ReloadCaptureSettings()
+	case "CaptureChannelIds":
+		config.CaptureChannelIds = value
+		ReloadCaptureSettings()
+	case "CaptureMaxBodySize":
+		config.CaptureMaxBodySize, _ = strconv.Atoi(value)
+	case "CaptureRetentionHours":
+		config.CaptureRetentionHours, _ = strconv.Atoi(value)
+	case "CaptureRedactKeys":
+		config.CaptureRedactKeys = value
+		ReloadCaptureSettings()
+	case "CaptureRedactPatterns":
+		config.CaptureRedactPatterns = value
+		ReloadCaptureSettings()
+	case "LogRetentionDaysTopup":
+		config.LogRetentionDaysTopup, _ = strconv.Atoi(value)
+	case "LogRetentionDaysConsume":
+		config.LogRetentionDaysConsume, _ = strconv.Atoi(value)
+	case "LogRetentionDaysManage":
+		config.LogRetentionDaysManage, _ = strconv.Atoi(value)
+	case "LogRetentionDaysSystem":
+		config.LogRetentionDaysSystem, _ = strconv.Atoi(value)
 	case "ModelRatio":
 		err = billingratio.UpdateModelRatioByJSONString(value)
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = billingratio.UpdateCompletionRatioByJSONString(value)
+	case "ModelMaxOutputTokens":
+		err = billingratio.UpdateModelMaxOutputTokensByJSONString(value)
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
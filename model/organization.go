@@ -0,0 +1,337 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"gorm.io/gorm"
+	"strings"
+)
+
+const (
+	OrgStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	OrgStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	OrgRoleMember = 1 // don't use 0, 0 is the default value!
+	OrgRoleAdmin  = 10
+	OrgRoleOwner  = 100
+)
+
+// Organization has a quota pool shared by the tokens its members create for it
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Status      int    `json:"status" gorm:"default:1"`
+	Quota       int64  `json:"quota" gorm:"bigint;default:0"`
+	UsedQuota   int64  `json:"used_quota" gorm:"bigint;default:0"`
+	Models      string `json:"models" gorm:"type:text"` // comma separated allowlist, empty means no restriction
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	Role        int    `json:"role" gorm:"-:all"` // role of the current user, only for api response
+}
+
+type OrganizationMember struct {
+	Id          int    `json:"id"`
+	OrgId       int    `json:"org_id" gorm:"uniqueIndex:idx_org_user"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_org_user;index"`
+	Role        int    `json:"role" gorm:"default:1"`
+	QuotaLimit  int64  `json:"quota_limit" gorm:"bigint;default:0"` // 0 means the member can use the whole pool
+	UsedQuota   int64  `json:"used_quota" gorm:"bigint;default:0"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	Username    string `json:"username" gorm:"-:all"` // only for api response
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, err error) {
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, err
+}
+
+func GetUserOrganizations(userId int) ([]*Organization, error) {
+	var members []*OrganizationMember
+	err := DB.Where("user_id = ?", userId).Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[int]int)
+	var orgIds []int
+	for _, member := range members {
+		roles[member.OrgId] = member.Role
+		orgIds = append(orgIds, member.OrgId)
+	}
+	var orgs []*Organization
+	if len(orgIds) == 0 {
+		return orgs, nil
+	}
+	err = DB.Where("id in ?", orgIds).Order("id").Find(&orgs).Error
+	for _, org := range orgs {
+		org.Role = roles[org.Id]
+	}
+	return orgs, err
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	org := Organization{}
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetOrgMember(orgId int, userId int) (*OrganizationMember, error) {
+	member := OrganizationMember{}
+	err := DB.First(&member, "org_id = ? and user_id = ?", orgId, userId).Error
+	if err != nil {
+		return nil, errors.New("你不是该组织的成员")
+	}
+	return &member, nil
+}
+
+func GetOrgMembers(orgId int) (members []*OrganizationMember, err error) {
+	err = DB.Where("org_id = ?", orgId).Order("role desc, id").Find(&members).Error
+	for _, member := range members {
+		member.Username = GetUsernameById(member.UserId)
+	}
+	return members, err
+}
+
+// InsertOrganization creates the organization with the user as its owner
+func InsertOrganization(org *Organization, ownerId int) error {
+	org.CreatedTime = helper.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(org).Error
+		if err != nil {
+			return errors.New("组织名称已存在")
+		}
+		return tx.Create(&OrganizationMember{
+			OrgId:       org.Id,
+			UserId:      ownerId,
+			Role:        OrgRoleOwner,
+			CreatedTime: org.CreatedTime,
+		}).Error
+	})
+}
+
+func (org *Organization) Update() error {
+	err := DB.Model(org).Select("name", "status", "models").Updates(org).Error
+	invalidateOrgCache(org.Id, 0)
+	return err
+}
+
+// DeleteOrganization gives the rest of the pool back to the owner and disables the tokens of the organization
+func DeleteOrganization(id int, ownerId int) error {
+	var remainQuota int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		org := Organization{}
+		err := tx.First(&org, "id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		remainQuota = org.Quota
+		err = tx.Model(&Token{}).Where("org_id = ?", id).Update("status", TokenStatusDisabled).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("org_id = ?", id).Delete(&OrganizationMember{}).Error
+		if err != nil {
+			return err
+		}
+		if remainQuota > 0 {
+			err = tx.Model(&User{}).Where("id = ?", ownerId).Update("quota", gorm.Expr("quota + ?", remainQuota)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&org).Error
+	})
+	invalidateOrgCache(id, 0)
+	if err == nil && remainQuota > 0 {
+		RecordLog(ownerId, LogTypeManage, fmt.Sprintf("删除组织 #%d，剩余额度 %s 退回", id, common.LogQuota(remainQuota)))
+	}
+	return err
+}
+
+func (member *OrganizationMember) Insert() error {
+	member.CreatedTime = helper.GetTimestamp()
+	err := DB.Create(member).Error
+	if err != nil {
+		return errors.New("该用户已是组织成员")
+	}
+	return nil
+}
+
+func (member *OrganizationMember) Update() error {
+	err := DB.Model(member).Select("role", "quota_limit").Updates(member).Error
+	invalidateOrgCache(member.OrgId, member.UserId)
+	return err
+}
+
+// DeleteOrgMember removes the member, the tokens the member created for the organization are disabled
+func DeleteOrgMember(orgId int, userId int) error {
+	defer invalidateOrgCache(orgId, userId)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("org_id = ? and user_id = ? and role != ?", orgId, userId, OrgRoleOwner).Delete(&OrganizationMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("该成员不存在或是组织所有者")
+		}
+		return tx.Model(&Token{}).Where("org_id = ? and user_id = ?", orgId, userId).Update("status", TokenStatusDisabled).Error
+	})
+}
+
+// IncreaseOrgQuota adds quota to the pool, it's used for top-ups by admins
+func IncreaseOrgQuota(orgId int, quota int64) error {
+	result := DB.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("组织不存在")
+	}
+	return nil
+}
+
+// FundOrganization moves quota of a member into the pool
+func FundOrganization(orgId int, userId int, quota int64) error {
+	if quota <= 0 {
+		return errors.New("额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? and quota >= ?", userId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户额度不足")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return err
+	}
+	_ = CacheUpdateUserQuota(context.Background(), userId)
+	RecordLog(userId, LogTypeManage, fmt.Sprintf("向组织 #%d 转入额度 %s", orgId, common.LogQuota(quota)))
+	return nil
+}
+
+// ValidateOrgToken checks that the organization of the token is usable by the owner of the token
+func ValidateOrgToken(token *Token) (*Organization, error) {
+	org, err := CacheGetOrganization(token.OrgId)
+	if err != nil {
+		return nil, errors.New("令牌所属组织不存在")
+	}
+	if org.Status != OrgStatusEnabled {
+		return nil, errors.New("令牌所属组织已被禁用")
+	}
+	if _, err := CacheGetOrgMember(org.Id, token.UserId); err != nil {
+		return nil, errors.New("令牌所有者已不是组织成员")
+	}
+	return org, nil
+}
+
+func (org *Organization) AllowsModel(modelName string) bool {
+	if org.Models == "" {
+		return true
+	}
+	for _, m := range strings.Split(org.Models, ",") {
+		if strings.TrimSpace(m) == modelName {
+			return true
+		}
+	}
+	return false
+}
+
+// consumeOrgQuota charges (or refunds, if quota is negative) the pool and the member,
+// when checkLimit is set the pool and the member limit must be able to cover the quota
+func consumeOrgQuota(orgId int, userId int, quota int64, checkLimit bool) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		orgQuery := tx.Model(&Organization{}).Where("id = ?", orgId)
+		memberQuery := tx.Model(&OrganizationMember{}).Where("org_id = ? and user_id = ?", orgId, userId)
+		if checkLimit {
+			orgQuery = orgQuery.Where("quota >= ?", quota)
+			memberQuery = memberQuery.Where("quota_limit = 0 or used_quota + ? <= quota_limit", quota)
+		}
+		result := orgQuery.Updates(map[string]any{
+			"quota":      gorm.Expr("quota - ?", quota),
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("组织额度不足")
+		}
+		result = memberQuery.Update("used_quota", gorm.Expr("used_quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 && checkLimit {
+			return errors.New("已达到你在组织中的额度上限")
+		}
+		return nil
+	})
+}
+
+type orgIdContextKey struct{}
+
+// WithOrgId marks the request as billed to the organization, so that its logs can be viewed by the organization
+func WithOrgId(ctx context.Context, orgId int) context.Context {
+	return context.WithValue(ctx, orgIdContextKey{}, orgId)
+}
+
+func orgIdFromContext(ctx context.Context) int {
+	orgId, _ := ctx.Value(orgIdContextKey{}).(int)
+	return orgId
+}
+
+func GetOrgLogs(orgId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, startIdx int, num int) (logs []*Log, err error) {
+	tx := LOG_DB.Where("org_id = ?", orgId)
+	if logType != LogTypeUnknown {
+		tx = tx.Where("type = ?", logType)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if username != "" {
+		tx = tx.Where("username = ?", username)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Omit("id").Find(&logs).Error
+	return logs, err
+}
+
+// CheckOrgQuota tells whether the pool and the limit of the member can cover the quota,
+// a rejection by the cached values is confirmed with the database, the pool may have been topped up
+func CheckOrgQuota(orgId int, userId int, quota int64) error {
+	org, err := CacheGetOrganization(orgId)
+	if err == nil && org.Quota < quota {
+		org, err = GetOrganizationById(orgId)
+	}
+	if err != nil {
+		return err
+	}
+	if org.Quota < quota {
+		return errors.New("组织额度不足")
+	}
+	member, err := CacheGetOrgMember(orgId, userId)
+	if err == nil && member.QuotaLimit > 0 && member.UsedQuota+quota > member.QuotaLimit {
+		member, err = GetOrgMember(orgId, userId)
+	}
+	if err != nil {
+		return err
+	}
+	if member.QuotaLimit > 0 && member.UsedQuota+quota > member.QuotaLimit {
+		return errors.New("已达到你在组织中的额度上限")
+	}
+	return nil
+}
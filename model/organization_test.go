@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestOrganizationBilling(t *testing.T) {
+	setupTestDB(t, &User{}, &Token{}, &Organization{}, &OrganizationMember{}, &Log{})
+	config.BatchUpdateEnabled = false
+	org := Organization{Name: "acme", Status: OrgStatusEnabled, Quota: 100}
+	if err := InsertOrganization(&org, 1); err != nil {
+		t.Fatal(err)
+	}
+	member := OrganizationMember{OrgId: org.Id, UserId: 2, Role: OrgRoleMember, QuotaLimit: 50}
+	if err := member.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	token := Token{Id: 1, UserId: 2, OrgId: org.Id, Key: "k", Status: TokenStatusEnabled, RemainQuota: 1000, ExpiredTime: -1}
+	if err := DB.Create(&token).Error; err != nil {
+		t.Fatal(err)
+	}
+	pool := func() (int64, int64) {
+		o, _ := GetOrganizationById(org.Id)
+		m, _ := GetOrgMember(org.Id, 2)
+		return o.Quota, m.UsedQuota
+	}
+
+	Convey("requests of a member are charged to the pool within the member limit", t, func() {
+		So(CheckOrgQuota(org.Id, 2, 40), ShouldBeNil)
+		So(PreConsumeTokenQuota(token.Id, 40), ShouldBeNil)
+		quota, used := pool()
+		So(quota, ShouldEqual, 60)
+		So(used, ShouldEqual, 40)
+
+		So(CheckOrgQuota(org.Id, 2, 20), ShouldNotBeNil)
+		So(PreConsumeTokenQuota(token.Id, 20), ShouldNotBeNil)
+		quota, used = pool()
+		So(quota, ShouldEqual, 60)
+		So(used, ShouldEqual, 40)
+
+		// the unused part of the pre-consumed quota is returned
+		So(PostConsumeTokenQuota(token.Id, -15), ShouldBeNil)
+		quota, used = pool()
+		So(quota, ShouldEqual, 75)
+		So(used, ShouldEqual, 25)
+	})
+	Convey("the pool itself is a limit", t, func() {
+		So(DB.Model(&OrganizationMember{}).Where("id = ?", member.Id).Update("quota_limit", 0).Error, ShouldBeNil)
+		So(CheckOrgQuota(org.Id, 2, 80), ShouldNotBeNil)
+		So(PreConsumeTokenQuota(token.Id, 80), ShouldNotBeNil)
+		So(IncreaseOrgQuota(org.Id, 10), ShouldBeNil)
+		So(CheckOrgQuota(org.Id, 2, 80), ShouldBeNil)
+	})
+	Convey("the pool is refunded when the token can't be charged", t, func() {
+		before, usedBefore := pool()
+		So(DB.Migrator().DropTable(&Token{}), ShouldBeNil)
+		So(preConsumeOrgTokenQuota(&token, 30), ShouldNotBeNil)
+		quota, used := pool()
+		So(quota, ShouldEqual, before)
+		So(used, ShouldEqual, usedBefore)
+	})
+	Convey("members which left can't use the tokens of the organization", t, func() {
+		So(DB.Where("org_id = ? and user_id = ?", org.Id, 2).Delete(&OrganizationMember{}).Error, ShouldBeNil)
+		_, err := ValidateOrgToken(&token)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -14,6 +14,12 @@ const (
 	RedemptionCodeStatusUsed     = 3 // also don't use 0
 )
 
+const (
+	RedemptionRewardQuota = "quota" // add Quota to the user
+	RedemptionRewardGroup = "group" // move the user to RewardGroup
+	RedemptionRewardToken = "token" // add Quota to the user and create a token limited to it
+)
+
 type Redemption struct {
 	Id           int    `json:"id"`
 	UserId       int    `json:"user_id"`
@@ -23,7 +29,25 @@ type Redemption struct {
 	Quota        int64  `json:"quota" gorm:"bigint;default:100"`
 	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
 	RedeemedTime int64  `json:"redeemed_time" gorm:"bigint"`
-	Count        int    `json:"count" gorm:"-:all"` // only for api request
+	UsedUserId   int    `json:"used_user_id" gorm:"index"`             // the last user who redeemed it
+	ExpiredTime  int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	MaxUses      int    `json:"max_uses" gorm:"default:1"`
+	UsedCount    int    `json:"used_count" gorm:"default:0"`
+	CampaignId   int    `json:"campaign_id" gorm:"index;default:0"`
+	RewardType   string `json:"reward_type" gorm:"type:varchar(16);default:'quota'"`
+	RewardGroup  string `json:"reward_group" gorm:"type:varchar(32);default:''"`
+	Count        int    `json:"count" gorm:"-:all"`      // only for api request
+	RewardKey    string `json:"reward_key" gorm:"-:all"` // the key of the token created by the redemption
+}
+
+// RedemptionUse records who redeemed a code, each user can redeem a code at most once
+type RedemptionUse struct {
+	Id           int   `json:"id"`
+	RedemptionId int   `json:"redemption_id" gorm:"uniqueIndex:idx_redemption_user"`
+	UserId       int   `json:"user_id" gorm:"uniqueIndex:idx_redemption_user;index"`
+	CampaignId   int   `json:"campaign_id" gorm:"index"`
+	Quota        int64 `json:"quota" gorm:"bigint"`
+	CreatedTime  int64 `json:"created_time" gorm:"bigint"`
 }
 
 func GetAllRedemptions(startIdx int, num int) ([]*Redemption, error) {
@@ -48,12 +72,12 @@ func GetRedemptionById(id int) (*Redemption, error) {
 	return &redemption, err
 }
 
-func Redeem(key string, userId int) (quota int64, err error) {
+func Redeem(key string, userId int) (*Redemption, error) {
 	if key == "" {
-		return 0, errors.New("未提供兑换码")
+		return nil, errors.New("未提供兑换码")
 	}
 	if userId == 0 {
-		return 0, errors.New("无效的 user id")
+		return nil, errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
 
@@ -62,7 +86,8 @@ func Redeem(key string, userId int) (quota int64, err error) {
 		keyCol = `"key"`
 	}
 
-	err = DB.Transaction(func(tx *gorm.DB) error {
+	now := helper.GetTimestamp()
+	err := DB.Transaction(func(tx *gorm.DB) error {
 		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
 		if err != nil {
 			return errors.New("无效的兑换码")
@@ -70,20 +95,114 @@ func Redeem(key string, userId int) (quota int64, err error) {
 		if redemption.Status != RedemptionCodeStatusEnabled {
 			return errors.New("该兑换码已被使用")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+		if redemption.ExpiredTime != -1 && redemption.ExpiredTime < now {
+			return errors.New("该兑换码已过期")
+		}
+		// the unique index makes sure each user redeems the code at most once
+		err = tx.Create(&RedemptionUse{
+			RedemptionId: redemption.Id,
+			UserId:       userId,
+			CampaignId:   redemption.CampaignId,
+			Quota:        redemption.Quota,
+			CreatedTime:  now,
+		}).Error
+		if err != nil {
+			return errors.New("您已经使用过该兑换码")
+		}
+		result := tx.Model(&Redemption{}).Where("id = ? and used_count < max_uses", redemption.Id).
+			Update("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("该兑换码已被使用")
+		}
+		if redemption.CampaignId != 0 {
+			err = useCampaignBudget(tx, redemption, now)
+			if err != nil {
+				return err
+			}
+		}
+		err = grantRedemptionReward(tx, redemption, userId)
 		if err != nil {
 			return err
 		}
-		redemption.RedeemedTime = helper.GetTimestamp()
-		redemption.Status = RedemptionCodeStatusUsed
-		err = tx.Save(redemption).Error
-		return err
+		redemption.UsedCount++
+		redemption.RedeemedTime = now
+		redemption.UsedUserId = userId
+		if redemption.UsedCount >= redemption.MaxUses {
+			redemption.Status = RedemptionCodeStatusUsed
+		}
+		return tx.Model(redemption).Select("redeemed_time", "used_user_id", "status").Updates(redemption).Error
 	})
 	if err != nil {
-		return 0, errors.New("兑换失败，" + err.Error())
+		return nil, errors.New("兑换失败，" + err.Error())
+	}
+	switch redemption.RewardType {
+	case RedemptionRewardGroup:
+		if common.RedisEnabled {
+			_ = common.RedisDel(fmt.Sprintf("user_group:%d", userId))
+		}
+		RecordRedemptionLog(userId, redemption.Id, fmt.Sprintf("通过兑换码升级至分组 %s", redemption.RewardGroup), 0)
+	case RedemptionRewardToken:
+		RecordRedemptionLog(userId, redemption.Id, fmt.Sprintf("通过兑换码获得令牌「%s」，额度 %s", redemption.Name, common.LogQuota(redemption.Quota)), 0)
+	default:
+		RecordRedemptionLog(userId, redemption.Id, fmt.Sprintf("通过兑换码充值 %s", common.LogQuota(redemption.Quota)), int(redemption.Quota))
+	}
+	return redemption, nil
+}
+
+func useCampaignBudget(tx *gorm.DB, redemption *Redemption, now int64) error {
+	campaign := RedemptionCampaign{}
+	err := tx.First(&campaign, "id = ?", redemption.CampaignId).Error
+	if err != nil {
+		return errors.New("兑换码所属活动不存在")
+	}
+	if campaign.Status != CampaignStatusEnabled {
+		return errors.New("兑换码所属活动已停止")
+	}
+	if campaign.ExpiredTime != -1 && campaign.ExpiredTime < now {
+		return errors.New("兑换码所属活动已结束")
+	}
+	if redemption.RewardType == RedemptionRewardGroup {
+		return nil
+	}
+	result := tx.Model(&RedemptionCampaign{}).Where("id = ? and (budget = 0 or used_budget + ? <= budget)", campaign.Id, redemption.Quota).
+		Update("used_budget", gorm.Expr("used_budget + ?", redemption.Quota))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("兑换码所属活动预算已用完")
+	}
+	return nil
+}
+
+func grantRedemptionReward(tx *gorm.DB, redemption *Redemption, userId int) error {
+	switch redemption.RewardType {
+	case RedemptionRewardGroup:
+		return tx.Model(&User{}).Where("id = ?", userId).Update("group", redemption.RewardGroup).Error
+	case RedemptionRewardToken:
+		now := helper.GetTimestamp()
+		token := Token{
+			UserId:       userId,
+			Name:         redemption.Name,
+			CreatedTime:  now,
+			AccessedTime: now,
+			ExpiredTime:  -1,
+			RemainQuota:  redemption.Quota,
+		}
+		token.generateKey()
+		redemption.RewardKey = token.RawKey
+		err := tx.Create(&token).Error
+		if err != nil {
+			return err
+		}
+		// the token spends the user's quota as well, so the reward funds the user too
+		return tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+	default:
+		return tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s", common.LogQuota(redemption.Quota)))
-	return redemption.Quota, nil
 }
 
 func (redemption *Redemption) Insert() error {
@@ -92,6 +211,10 @@ func (redemption *Redemption) Insert() error {
 	return err
 }
 
+func BatchInsertRedemptions(redemptions []*Redemption) error {
+	return DB.CreateInBatches(redemptions, 100).Error
+}
+
 func (redemption *Redemption) SelectUpdate() error {
 	// This can update zero values
 	return DB.Model(redemption).Select("redeemed_time", "status").Updates(redemption).Error
@@ -100,8 +223,22 @@ func (redemption *Redemption) SelectUpdate() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
 	var err error
-	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time").Updates(redemption).Error
-	return err
+	err = DB.Model(redemption).Select("name", "status", "quota", "redeemed_time", "expired_time", "max_uses", "campaign_id", "reward_type", "reward_group").Updates(redemption).Error
+	if err != nil {
+		return err
+	}
+	// the status follows max_uses, used_count is compared in SQL as it may have changed since it was read
+	err = DB.Model(&Redemption{}).Where("id = ? and status = ? and used_count >= max_uses", redemption.Id, RedemptionCodeStatusEnabled).
+		Update("status", RedemptionCodeStatusUsed).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Model(&Redemption{}).Where("id = ? and status = ? and used_count < max_uses", redemption.Id, RedemptionCodeStatusUsed).
+		Update("status", RedemptionCodeStatusEnabled).Error
+	if err != nil {
+		return err
+	}
+	return DB.Model(&Redemption{}).Where("id = ?", redemption.Id).Select("status").Scan(&redemption.Status).Error
 }
 
 func (redemption *Redemption) Delete() error {
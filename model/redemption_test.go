@@ -0,0 +1,79 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedemptionUpdateStatus(t *testing.T) {
+	setupTestDB(t, &Redemption{})
+	redemption := Redemption{Name: "welcome", Key: "k", Status: RedemptionCodeStatusEnabled, Quota: 100, MaxUses: 5, UsedCount: 3, ExpiredTime: -1}
+	if err := DB.Create(&redemption).Error; err != nil {
+		t.Fatal(err)
+	}
+	status := func() int {
+		fresh, err := GetRedemptionById(redemption.Id)
+		So(err, ShouldBeNil)
+		return fresh.Status
+	}
+
+	Convey("lowering max_uses to the use count marks the code as used", t, func() {
+		redemption.MaxUses = 2
+		So(redemption.Update(), ShouldBeNil)
+		So(redemption.Status, ShouldEqual, RedemptionCodeStatusUsed)
+		So(status(), ShouldEqual, RedemptionCodeStatusUsed)
+	})
+	Convey("raising max_uses above the use count enables the code again", t, func() {
+		redemption.MaxUses = 4
+		So(redemption.Update(), ShouldBeNil)
+		So(redemption.Status, ShouldEqual, RedemptionCodeStatusEnabled)
+		So(status(), ShouldEqual, RedemptionCodeStatusEnabled)
+	})
+	Convey("disabled codes stay disabled", t, func() {
+		redemption.Status = RedemptionCodeStatusDisabled
+		redemption.MaxUses = 1
+		So(redemption.Update(), ShouldBeNil)
+		So(status(), ShouldEqual, RedemptionCodeStatusDisabled)
+	})
+}
+
+func TestRedeemRewards(t *testing.T) {
+	setupTestDB(t, &User{}, &Token{}, &Log{}, &Redemption{}, &RedemptionUse{}, &AlertRule{})
+	user := User{Username: "redeemer", Password: "password", Group: "default"}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	addRedemption := func(key string, rewardType string) {
+		redemption := Redemption{Name: key, Key: key, Status: RedemptionCodeStatusEnabled, Quota: 500, MaxUses: 1, ExpiredTime: -1, RewardType: rewardType, RewardGroup: "vip"}
+		if err := DB.Create(&redemption).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Convey("token rewards fund the user so the token can be spent", t, func() {
+		addRedemption("token-code", RedemptionRewardToken)
+		redemption, err := Redeem("token-code", user.Id)
+		So(err, ShouldBeNil)
+		So(redemption.RewardKey, ShouldNotBeEmpty)
+		quota, err := GetUserQuota(user.Id)
+		So(err, ShouldBeNil)
+		So(quota, ShouldEqual, 500)
+
+		token, err := ValidateUserToken(redemption.RewardKey)
+		So(err, ShouldBeNil)
+		So(token.RemainQuota, ShouldEqual, 500)
+		So(PreConsumeTokenQuota(token.Id, 500), ShouldBeNil)
+		quota, err = GetUserQuota(user.Id)
+		So(err, ShouldBeNil)
+		So(quota, ShouldEqual, 0)
+	})
+	Convey("group rewards don't need Redis", t, func() {
+		addRedemption("group-code", RedemptionRewardGroup)
+		_, err := Redeem("group-code", user.Id)
+		So(err, ShouldBeNil)
+		group, err := GetUserGroup(user.Id)
+		So(err, ShouldBeNil)
+		So(group, ShouldEqual, "vip")
+	})
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"sync"
+	"time"
+)
+
+// reservations of crashed nodes are dropped after this, it should be longer than any request
+const reservationTTL = 30 * time.Minute
+
+var userReservations = make(map[int]int64)
+var userReservationsLock sync.Mutex
+
+func userReservationKey(userId int) string {
+	return fmt.Sprintf("user_reserved_quota:%d", userId)
+}
+
+// ReserveUserQuota holds quota of the user for an in-flight request,
+// it returns the total quota reserved by the user's in-flight requests including this one
+func ReserveUserQuota(userId int, quota int64) (int64, error) {
+	if quota <= 0 {
+		return GetUserReservedQuota(userId)
+	}
+	if common.RedisEnabled {
+		ctx := context.Background()
+		key := userReservationKey(userId)
+		pipe := common.RDB.TxPipeline()
+		incr := pipe.IncrBy(ctx, key, quota)
+		pipe.Expire(ctx, key, reservationTTL)
+		_, err := pipe.Exec(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return incr.Val(), nil
+	}
+	userReservationsLock.Lock()
+	defer userReservationsLock.Unlock()
+	userReservations[userId] += quota
+	return userReservations[userId], nil
+}
+
+// ReleaseUserQuota gives back quota held by ReserveUserQuota
+func ReleaseUserQuota(userId int, quota int64) {
+	if quota <= 0 {
+		return
+	}
+	if common.RedisEnabled {
+		ctx := context.Background()
+		key := userReservationKey(userId)
+		remain, err := common.RDB.DecrBy(ctx, key, quota).Result()
+		if err != nil {
+			logger.SysError("failed to release reserved quota: " + err.Error())
+			return
+		}
+		if remain <= 0 {
+			_ = common.RDB.Del(ctx, key).Err()
+		}
+		return
+	}
+	userReservationsLock.Lock()
+	defer userReservationsLock.Unlock()
+	userReservations[userId] -= quota
+	if userReservations[userId] <= 0 {
+		delete(userReservations, userId)
+	}
+}
+
+func GetUserReservedQuota(userId int) (int64, error) {
+	if common.RedisEnabled {
+		reserved, err := common.RDB.Get(context.Background(), userReservationKey(userId)).Int64()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		return reserved, nil
+	}
+	userReservationsLock.Lock()
+	defer userReservationsLock.Unlock()
+	return userReservations[userId], nil
+}
@@ -0,0 +1,255 @@
+package model
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	logRetentionBatchSize = 1000
+	// pause between batches so other writers get the log database in between
+	logRetentionBatchPause = 100 * time.Millisecond
+	// failed batches are skipped, this many in a row stop the deletion
+	logRetentionMaxFailures = 3
+)
+
+var logTypeNames = map[int]string{
+	LogTypeUnknown: "all",
+	LogTypeTopup:   "topup",
+	LogTypeConsume: "consume",
+	LogTypeManage:  "manage",
+	LogTypeSystem:  "system",
+}
+
+func logRetentionDays(logType int) int {
+	switch logType {
+	case LogTypeTopup:
+		return config.LogRetentionDaysTopup
+	case LogTypeConsume:
+		return config.LogRetentionDaysConsume
+	case LogTypeManage:
+		return config.LogRetentionDaysManage
+	case LogTypeSystem:
+		return config.LogRetentionDaysSystem
+	}
+	return 0
+}
+
+type logArchive struct {
+	file   *os.File
+	writer *gzip.Writer
+}
+
+func openLogArchive(logType int) (*logArchive, error) {
+	err := os.MkdirAll(config.LogArchiveDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("logs-%s-%s.jsonl.gz", logTypeNames[logType], time.Now().Format("20060102-150405"))
+	file, err := os.OpenFile(filepath.Join(config.LogArchiveDir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &logArchive{file: file, writer: gzip.NewWriter(file)}, nil
+}
+
+// write makes sure the logs are on disk before they are deleted
+func (archive *logArchive) write(logs []*Log) error {
+	encoder := json.NewEncoder(archive.writer)
+	for _, log := range logs {
+		err := encoder.Encode(log)
+		if err != nil {
+			return err
+		}
+	}
+	err := archive.writer.Flush()
+	if err != nil {
+		return err
+	}
+	return archive.file.Sync()
+}
+
+func (archive *logArchive) close() error {
+	err := archive.writer.Close()
+	if err != nil {
+		_ = archive.file.Close()
+		return err
+	}
+	return archive.file.Close()
+}
+
+// deleteLogsBefore archives and deletes the logs of the given type (all types for LogTypeUnknown) created
+// before targetTimestamp, in small batches so the log database is never locked for long. Only logs which
+// are already in the usage rollups are deleted. A batch which fails is kept and skipped, onBatch gets the
+// number of logs deleted so far after every batch.
+func deleteLogsBefore(logType int, targetTimestamp int64, onBatch func(deleted int64)) (int64, error) {
+	err := RollupUsage()
+	if err != nil && !errors.Is(err, errUsageRollupConflict) {
+		return 0, err
+	}
+	rolledUp, err := usageRollupCursor()
+	if err != nil {
+		return 0, err
+	}
+	var archive *logArchive
+	defer func() {
+		if archive != nil {
+			err := archive.close()
+			if err != nil {
+				logger.SysError("failed to close log archive: " + err.Error())
+			}
+		}
+	}()
+	var deleted int64
+	var lastId int
+	var firstErr error
+	failures := 0
+	for {
+		var logs []*Log
+		tx := LOG_DB.Where("id > ? AND id <= ? AND created_at < ?", lastId, rolledUp, targetTimestamp)
+		if logType != LogTypeUnknown {
+			tx = tx.Where("type = ?", logType)
+		}
+		err := tx.Order("id").Limit(logRetentionBatchSize).Find(&logs).Error
+		if err != nil {
+			return deleted, err
+		}
+		if len(logs) == 0 {
+			return deleted, firstErr
+		}
+		lastId = logs[len(logs)-1].Id
+		err = deleteLogBatch(&archive, logType, logs, targetTimestamp)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to delete logs %d to %d, skipped: %s", logs[0].Id, lastId, err.Error()))
+			if firstErr == nil {
+				firstErr = err
+			}
+			failures++
+			if failures >= logRetentionMaxFailures {
+				return deleted, err
+			}
+		} else {
+			failures = 0
+			deleted += int64(len(logs))
+			if onBatch != nil {
+				onBatch(deleted)
+			}
+		}
+		if len(logs) < logRetentionBatchSize {
+			return deleted, firstErr
+		}
+		time.Sleep(logRetentionBatchPause)
+	}
+}
+
+// deleteLogBatch archives the logs if an archive directory is set, and deletes them
+func deleteLogBatch(archive **logArchive, logType int, logs []*Log, targetTimestamp int64) error {
+	if config.LogArchiveDir != "" {
+		if *archive == nil {
+			var err error
+			*archive, err = openLogArchive(logType)
+			if err != nil {
+				return err
+			}
+		}
+		err := (*archive).write(logs)
+		if err != nil {
+			// the next batch starts a new archive instead of appending to a broken one
+			_ = (*archive).close()
+			*archive = nil
+			return err
+		}
+	}
+	// the batch is the range of ids just read, this keeps the statement small
+	tx := LOG_DB.Where("id BETWEEN ? AND ? AND created_at < ?", logs[0].Id, logs[len(logs)-1].Id, targetTimestamp)
+	if logType != LogTypeUnknown {
+		tx = tx.Where("type = ?", logType)
+	}
+	return tx.Delete(&Log{}).Error
+}
+
+func CleanExpiredLogs() {
+	for _, logType := range []int{LogTypeTopup, LogTypeConsume, LogTypeManage, LogTypeSystem} {
+		days := logRetentionDays(logType)
+		if days <= 0 {
+			continue
+		}
+		count, err := deleteLogsBefore(logType, helper.GetTimestamp()-int64(days)*86400, nil)
+		if err != nil {
+			logger.SysError(fmt.Sprintf("failed to clean expired %s logs: %s", logTypeNames[logType], err.Error()))
+		}
+		if count > 0 {
+			logger.SysLogf("deleted %d expired %s logs", count, logTypeNames[logType])
+		}
+	}
+}
+
+func SyncLogRetention(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		CleanExpiredLogs()
+	}
+}
+
+// LogDeletion is the status of the deletion of old logs an admin started
+type LogDeletion struct {
+	TargetTimestamp int64  `json:"target_timestamp"`
+	Running         bool   `json:"running"`
+	Deleted         int64  `json:"deleted"`
+	Error           string `json:"error"`
+	StartedAt       int64  `json:"started_at"`
+	FinishedAt      int64  `json:"finished_at"`
+}
+
+var logDeletion LogDeletion
+var logDeletionLock sync.Mutex
+
+// StartLogDeletion deletes the logs created before targetTimestamp in the background,
+// it returns false with the status of the running deletion if there is one
+func StartLogDeletion(targetTimestamp int64) (LogDeletion, bool) {
+	logDeletionLock.Lock()
+	defer logDeletionLock.Unlock()
+	if logDeletion.Running {
+		return logDeletion, false
+	}
+	logDeletion = LogDeletion{
+		TargetTimestamp: targetTimestamp,
+		Running:         true,
+		StartedAt:       helper.GetTimestamp(),
+	}
+	go func() {
+		deleted, err := deleteLogsBefore(LogTypeUnknown, targetTimestamp, func(deleted int64) {
+			logDeletionLock.Lock()
+			logDeletion.Deleted = deleted
+			logDeletionLock.Unlock()
+		})
+		if err != nil {
+			logger.SysError("failed to delete old logs: " + err.Error())
+		}
+		logDeletionLock.Lock()
+		defer logDeletionLock.Unlock()
+		logDeletion.Running = false
+		logDeletion.Deleted = deleted
+		logDeletion.FinishedAt = helper.GetTimestamp()
+		if err != nil {
+			logDeletion.Error = err.Error()
+		}
+	}()
+	return logDeletion, true
+}
+
+func GetLogDeletion() LogDeletion {
+	logDeletionLock.Lock()
+	defer logDeletionLock.Unlock()
+	return logDeletion
+}
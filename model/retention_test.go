@@ -0,0 +1,131 @@
+package model
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func readLogArchives(t *testing.T, dir string) []*Log {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []*Log
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoder := json.NewDecoder(reader)
+		for decoder.More() {
+			log := &Log{}
+			if err = decoder.Decode(log); err != nil {
+				t.Fatal(err)
+			}
+			logs = append(logs, log)
+		}
+		_ = file.Close()
+	}
+	return logs
+}
+
+func TestDeleteLogsBefore(t *testing.T) {
+	setupTestDB(t, &Log{}, &UsageRollup{}, &UsageRollupCursor{})
+	old := helper.GetTimestamp() - 10*86400
+	logs := make([]*Log, 0, 2*logRetentionBatchSize+500)
+	for i := 0; i < 2*logRetentionBatchSize+500; i++ {
+		logs = append(logs, &Log{UserId: 1, CreatedAt: old + int64(i), Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 1})
+	}
+	logs = append(logs, &Log{UserId: 1, CreatedAt: old, Type: LogTypeTopup, Quota: 100})
+	if err := LOG_DB.CreateInBatches(logs, 50).Error; err != nil {
+		t.Fatal(err)
+	}
+	countLogs := func(logType int) int64 {
+		var count int64
+		LOG_DB.Model(&Log{}).Where("type = ?", logType).Count(&count)
+		return count
+	}
+
+	Convey("logs are kept when they can't be archived", t, func() {
+		config.LogArchiveDir = filepath.Join(t.TempDir(), "file")
+		So(os.WriteFile(config.LogArchiveDir, nil, 0644), ShouldBeNil)
+		deleted, err := deleteLogsBefore(LogTypeConsume, old+86400, nil)
+		So(err, ShouldNotBeNil)
+		So(deleted, ShouldEqual, 0)
+		So(countLogs(LogTypeConsume), ShouldEqual, 2*logRetentionBatchSize+500)
+	})
+	Convey("logs are archived and deleted in batches", t, func() {
+		config.LogArchiveDir = t.TempDir()
+		var progress []int64
+		deleted, err := deleteLogsBefore(LogTypeConsume, old+86400, func(deleted int64) {
+			progress = append(progress, deleted)
+		})
+		So(err, ShouldBeNil)
+		So(deleted, ShouldEqual, 2*logRetentionBatchSize+500)
+		So(progress, ShouldResemble, []int64{logRetentionBatchSize, 2 * logRetentionBatchSize, 2*logRetentionBatchSize + 500})
+		So(countLogs(LogTypeConsume), ShouldEqual, 0)
+		So(countLogs(LogTypeTopup), ShouldEqual, 1)
+
+		archived := readLogArchives(t, config.LogArchiveDir)
+		So(archived, ShouldHaveLength, 2*logRetentionBatchSize+500)
+		So(archived[0].Id, ShouldEqual, logs[0].Id)
+		So(archived[len(archived)-1].Id, ShouldEqual, logs[len(logs)-2].Id)
+
+		statistics, err := GetUsageStatistics(UsageQuery{Type: LogTypeConsume, Granularity: "week", StartTimestamp: old - 7*86400})
+		So(err, ShouldBeNil)
+		var requests, quota int64
+		for _, statistic := range statistics {
+			requests += statistic.Requests
+			quota += statistic.Quota
+		}
+		So(requests, ShouldEqual, 2*logRetentionBatchSize+500)
+		So(quota, ShouldEqual, 2*logRetentionBatchSize+500)
+	})
+	Convey("admins delete logs in the background", t, func() {
+		config.LogArchiveDir = ""
+		deletion, started := StartLogDeletion(old + 86400)
+		So(started, ShouldBeTrue)
+		So(deletion.Running, ShouldBeTrue)
+		for i := 0; i < 100 && GetLogDeletion().Running; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		deletion = GetLogDeletion()
+		So(deletion.Running, ShouldBeFalse)
+		So(deletion.Deleted, ShouldEqual, 1)
+		So(deletion.Error, ShouldBeEmpty)
+		So(countLogs(LogTypeTopup), ShouldEqual, 0)
+	})
+	Convey("only one deletion runs at a time", t, func() {
+		logDeletion = LogDeletion{TargetTimestamp: old, Running: true}
+		deletion, started := StartLogDeletion(old + 86400)
+		So(started, ShouldBeFalse)
+		So(deletion.TargetTimestamp, ShouldEqual, old)
+		logDeletion = LogDeletion{}
+	})
+}
+
+func TestRollupUsageTruncates(t *testing.T) {
+	setupTestDB(t, &Log{}, &UsageRollup{}, &UsageRollupCursor{})
+	Convey("values longer than the rollup columns are truncated", t, func() {
+		log := Log{UserId: 1, CreatedAt: helper.GetTimestamp() - 3600, Type: LogTypeConsume, ModelName: strings.Repeat("模", 200), GroupName: strings.Repeat("g", 40)}
+		So(LOG_DB.Create(&log).Error, ShouldBeNil)
+		So(RollupUsage(), ShouldBeNil)
+		var rollup UsageRollup
+		So(LOG_DB.First(&rollup).Error, ShouldBeNil)
+		So(rollup.ModelName, ShouldEqual, strings.Repeat("模", usageModelNameLength))
+		So(rollup.GroupName, ShouldEqual, strings.Repeat("g", usageGroupNameLength))
+	})
+}
@@ -0,0 +1,157 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"gorm.io/gorm"
+)
+
+const sessionSecretOption = "SessionSecret"
+
+// Session is the server side record of a dashboard login, the cookie only carries
+// its id, so that a session can be listed and revoked
+type Session struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	KeyHash      string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	Ip           string `json:"ip" gorm:"type:varchar(64);default:''"`
+	UserAgent    string `json:"user_agent" gorm:"type:varchar(512);default:''"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastSeenTime int64  `json:"last_seen_time" gorm:"bigint"`
+	Current      bool   `json:"current" gorm:"-:all"` // api only
+}
+
+func hashSessionKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// InitSessionSecret keeps the cookie secret across restarts, SESSION_SECRET takes precedence,
+// otherwise a secret is generated once and kept in the options table
+func InitSessionSecret() error {
+	if config.SessionSecret != "" {
+		return nil
+	}
+	option := Option{Key: sessionSecretOption}
+	err := DB.Where(Option{Key: sessionSecretOption}).Attrs(Option{Value: random.GetUUID() + random.GetUUID()}).FirstOrCreate(&option).Error
+	if err != nil {
+		return err
+	}
+	config.SessionSecret = option.Value
+	return nil
+}
+
+func (session *Session) expired(now int64) bool {
+	if config.SessionIdleTimeout > 0 && now-session.LastSeenTime > config.SessionIdleTimeout {
+		return true
+	}
+	if config.SessionAbsoluteTimeout > 0 && now-session.CreatedTime > config.SessionAbsoluteTimeout {
+		return true
+	}
+	return false
+}
+
+// CreateSession returns the key to be kept in the session cookie
+func CreateSession(userId int, ip string, userAgent string) (string, error) {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	now := helper.GetTimestamp()
+	key := random.GetUUID() + random.GetUUID()
+	session := Session{
+		UserId:       userId,
+		KeyHash:      hashSessionKey(key),
+		Ip:           ip,
+		UserAgent:    userAgent,
+		CreatedTime:  now,
+		LastSeenTime: now,
+	}
+	err := DB.Create(&session).Error
+	if err != nil {
+		return "", err
+	}
+	deleteExpiredSessions(userId, now)
+	return key, nil
+}
+
+func deleteExpiredSessions(userId int, now int64) {
+	tx := DB.Where("user_id = ?", userId)
+	if config.SessionIdleTimeout > 0 && config.SessionAbsoluteTimeout > 0 {
+		tx = tx.Where("last_seen_time < ? or created_time < ?", now-config.SessionIdleTimeout, now-config.SessionAbsoluteTimeout)
+	} else if config.SessionIdleTimeout > 0 {
+		tx = tx.Where("last_seen_time < ?", now-config.SessionIdleTimeout)
+	} else if config.SessionAbsoluteTimeout > 0 {
+		tx = tx.Where("created_time < ?", now-config.SessionAbsoluteTimeout)
+	} else {
+		return
+	}
+	err := tx.Delete(&Session{}).Error
+	if err != nil {
+		logger.SysError("failed to delete expired sessions: " + err.Error())
+	}
+}
+
+func ValidateSession(key string) (*Session, error) {
+	if key == "" {
+		return nil, errors.New("会话无效")
+	}
+	session := Session{}
+	err := DB.First(&session, "key_hash = ?", hashSessionKey(key)).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("会话已失效")
+		}
+		return nil, err
+	}
+	now := helper.GetTimestamp()
+	if session.expired(now) {
+		DB.Delete(&session)
+		return nil, errors.New("会话已过期")
+	}
+	if now-session.LastSeenTime >= 60 {
+		// at most one write per minute for an active session
+		DB.Model(&Session{}).Where("id = ?", session.Id).Update("last_seen_time", now)
+		session.LastSeenTime = now
+	}
+	return &session, nil
+}
+
+func GetUserSessions(userId int) (sessions []*Session, err error) {
+	err = DB.Where("user_id = ?", userId).Order("last_seen_time desc").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	now := helper.GetTimestamp()
+	active := sessions[:0]
+	for _, session := range sessions {
+		if !session.expired(now) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+func DeleteSessionById(id int, userId int) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&Session{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("会话不存在")
+	}
+	return nil
+}
+
+func DeleteSessionByKey(key string) error {
+	return DB.Where("key_hash = ?", hashSessionKey(key)).Delete(&Session{}).Error
+}
+
+// DeleteUserSessions logs the user out everywhere
+func DeleteUserSessions(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&Session{}).Error
+}
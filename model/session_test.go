@@ -0,0 +1,60 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestSessionExpired(t *testing.T) {
+	idle, absolute := config.SessionIdleTimeout, config.SessionAbsoluteTimeout
+	defer func() {
+		config.SessionIdleTimeout, config.SessionAbsoluteTimeout = idle, absolute
+	}()
+	config.SessionIdleTimeout = 600
+	config.SessionAbsoluteTimeout = 3600
+	session := Session{CreatedTime: 1000, LastSeenTime: 1000}
+	Convey("sessions expire when idle for too long", t, func() {
+		So(session.expired(1600), ShouldBeFalse)
+		So(session.expired(1601), ShouldBeTrue)
+	})
+	Convey("active sessions expire at the absolute timeout", t, func() {
+		active := Session{CreatedTime: 1000, LastSeenTime: 4500}
+		So(active.expired(4600), ShouldBeFalse)
+		So(active.expired(4601), ShouldBeTrue)
+	})
+	Convey("a timeout of 0 is disabled", t, func() {
+		config.SessionIdleTimeout = 0
+		config.SessionAbsoluteTimeout = 0
+		So(session.expired(1000000), ShouldBeFalse)
+	})
+}
+
+func TestValidateSession(t *testing.T) {
+	setupTestDB(t, &User{}, &Session{})
+	user := User{Username: "alice", Password: "12345678", Status: UserStatusEnabled}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	Convey("revoked sessions are rejected", t, func() {
+		key, err := CreateSession(user.Id, "127.0.0.1", "test")
+		So(err, ShouldBeNil)
+		session, err := ValidateSession(key)
+		So(err, ShouldBeNil)
+		So(DeleteSessionById(session.Id, user.Id), ShouldBeNil)
+		_, err = ValidateSession(key)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("disabling the user ends all of the sessions", t, func() {
+		first, err := CreateSession(user.Id, "127.0.0.1", "test")
+		So(err, ShouldBeNil)
+		second, err := CreateSession(user.Id, "127.0.0.2", "test")
+		So(err, ShouldBeNil)
+		So((&User{Id: user.Id, Status: UserStatusDisabled}).Update(false), ShouldBeNil)
+		_, err = ValidateSession(first)
+		So(err, ShouldNotBeNil)
+		_, err = ValidateSession(second)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,207 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+type StatementLine struct {
+	Day              string  `json:"day" gorm:"column:day"`
+	ModelName        string  `json:"model_name" gorm:"column:model_name"`
+	TokenName        string  `json:"token_name" gorm:"column:token_name"`
+	RequestCount     int64   `json:"request_count" gorm:"column:request_count"`
+	PromptTokens     int64   `json:"prompt_tokens" gorm:"column:prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens" gorm:"column:completion_tokens"`
+	Quota            int64   `json:"quota" gorm:"column:quota"`
+	Amount           float64 `json:"amount" gorm:"-"`
+}
+
+const statementBucketSize = 15 * 60
+
+type statementBucket struct {
+	Bucket           int64
+	ModelName        string
+	TokenId          int
+	TokenName        string
+	RequestCount     int64
+	PromptTokens     int64
+	CompletionTokens int64
+	Quota            int64
+}
+
+type StatementRedemption struct {
+	Name         string  `json:"name"`
+	Quota        int64   `json:"quota"`
+	Amount       float64 `json:"amount"`
+	RedeemedTime int64   `json:"redeemed_time"`
+}
+
+// Statement is the usage statement of a user in a billing period, amounts are in USD
+// converted with QuotaPerUnit
+type Statement struct {
+	UserId                int                    `json:"user_id"`
+	Username              string                 `json:"username"`
+	StartTimestamp        int64                  `json:"start_timestamp"`
+	EndTimestamp          int64                  `json:"end_timestamp"`
+	QuotaPerUnit          float64                `json:"quota_per_unit"`
+	Lines                 []*StatementLine       `json:"lines"`
+	Topups                []*Log                 `json:"topups"`
+	Redemptions           []*StatementRedemption `json:"redemptions"`
+	TotalRequests         int64                  `json:"total_requests"`
+	TotalPromptTokens     int64                  `json:"total_prompt_tokens"`
+	TotalCompletionTokens int64                  `json:"total_completion_tokens"`
+	TotalQuota            int64                  `json:"total_quota"`
+	TotalAmount           float64                `json:"total_amount"`
+	TotalTopupQuota       int64                  `json:"total_topup_quota"`
+	TotalTopupAmount      float64                `json:"total_topup_amount"`
+}
+
+func quotaToAmount(quota int64) float64 {
+	if config.QuotaPerUnit == 0 {
+		return 0
+	}
+	return float64(quota) / config.QuotaPerUnit
+}
+
+// GetUserStatement aggregates the consume logs of the user by day, model and token, and lists the
+// top-ups and redemptions in the period. Top-ups are only listed while their logs are kept.
+func GetUserStatement(userId int, startTimestamp int64, endTimestamp int64) (*Statement, error) {
+	statement := &Statement{
+		UserId:         userId,
+		Username:       GetUsernameById(userId),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		QuotaPerUnit:   config.QuotaPerUnit,
+	}
+	// logs deleted by the retention are still in the rollups, so the rolled up logs are read from there by the
+	// hour and the newer ones by the quarter hour. The buckets are folded into days of the server time zone
+	// below, the time zone of the statement period, which is exact for any zone offset of whole quarter hours
+	// but for the rolled up logs only for offsets of whole hours.
+	var buckets []*statementBucket
+	err := readUsage(func(cursor int) error {
+		var rolledUp, recent []*statementBucket
+		err := LOG_DB.Model(&UsageRollup{}).
+			Select("bucket_start as bucket, model_name, token_id, sum(requests - errors) as request_count, "+
+				"sum(quota) as quota, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens").
+			Where("type = ? and user_id = ? and bucket_start BETWEEN ? AND ?", LogTypeConsume, userId, startTimestamp-startTimestamp%usageBucketSize, endTimestamp).
+			Group("bucket_start, model_name, token_id").Scan(&rolledUp).Error
+		if err != nil {
+			return err
+		}
+		err = LOG_DB.Model(&Log{}).
+			Select("created_at - created_at % ? as bucket, model_name, token_name, count(1) as request_count, "+
+				"sum(quota) as quota, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens", statementBucketSize).
+			Where("id > ? and type = ? and user_id = ? and created_at BETWEEN ? AND ?", cursor, LogTypeConsume, userId, startTimestamp, endTimestamp).
+			Group("bucket, model_name, token_name").Scan(&recent).Error
+		if err != nil {
+			return err
+		}
+		buckets = append(rolledUp, recent...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = fillStatementTokenNames(buckets)
+	if err != nil {
+		return nil, err
+	}
+	lines := make(map[StatementLine]*StatementLine)
+	for _, bucket := range buckets {
+		key := StatementLine{
+			Day:       time.Unix(bucket.Bucket, 0).Format("2006-01-02"),
+			ModelName: bucket.ModelName,
+			TokenName: bucket.TokenName,
+		}
+		line, ok := lines[key]
+		if !ok {
+			line = &StatementLine{}
+			*line = key
+			lines[key] = line
+			statement.Lines = append(statement.Lines, line)
+		}
+		line.RequestCount += bucket.RequestCount
+		line.PromptTokens += bucket.PromptTokens
+		line.CompletionTokens += bucket.CompletionTokens
+		line.Quota += bucket.Quota
+	}
+	sort.Slice(statement.Lines, func(i, j int) bool {
+		a, b := statement.Lines[i], statement.Lines[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.ModelName != b.ModelName {
+			return a.ModelName < b.ModelName
+		}
+		return a.TokenName < b.TokenName
+	})
+	for _, line := range statement.Lines {
+		line.Amount = quotaToAmount(line.Quota)
+		statement.TotalRequests += line.RequestCount
+		statement.TotalPromptTokens += line.PromptTokens
+		statement.TotalCompletionTokens += line.CompletionTokens
+		statement.TotalQuota += line.Quota
+	}
+	statement.TotalAmount = quotaToAmount(statement.TotalQuota)
+
+	// redemptions are listed on their own
+	err = LOG_DB.Where("user_id = ? and type = ? and redemption_id = 0 and created_at BETWEEN ? AND ?", userId, LogTypeTopup, startTimestamp, endTimestamp).
+		Order("id").Find(&statement.Topups).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, topup := range statement.Topups {
+		statement.TotalTopupQuota += int64(topup.Quota)
+	}
+	statement.TotalTopupAmount = quotaToAmount(statement.TotalTopupQuota)
+
+	err = DB.Table("redemption_uses").
+		Select("redemptions.name as name, redemption_uses.quota as quota, redemption_uses.created_time as redeemed_time").
+		Joins("LEFT JOIN redemptions ON redemptions.id = redemption_uses.redemption_id").
+		Where("redemption_uses.user_id = ? and redemption_uses.created_time BETWEEN ? AND ?", userId, startTimestamp, endTimestamp).
+		Order("redemption_uses.created_time").Scan(&statement.Redemptions).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, redemption := range statement.Redemptions {
+		redemption.Amount = quotaToAmount(redemption.Quota)
+	}
+	return statement, nil
+}
+
+// fillStatementTokenNames names the tokens of the rolled up buckets, which only have their ids
+func fillStatementTokenNames(buckets []*statementBucket) error {
+	var ids []int
+	for _, bucket := range buckets {
+		if bucket.TokenId != 0 {
+			ids = append(ids, bucket.TokenId)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var tokens []*Token
+	err := DB.Select("id", "name").Where("id IN ?", ids).Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string)
+	for _, token := range tokens {
+		names[token.Id] = token.Name
+	}
+	for _, bucket := range buckets {
+		if bucket.TokenId == 0 {
+			continue
+		}
+		name, ok := names[bucket.TokenId]
+		if !ok {
+			// the token was deleted
+			name = fmt.Sprintf("#%d", bucket.TokenId)
+		}
+		bucket.TokenName = name
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetUserStatement(t *testing.T) {
+	setupTestDB(t, &User{}, &Token{}, &Log{}, &Redemption{}, &RedemptionUse{}, &UsageRollup{}, &UsageRollupCursor{})
+	local := time.Local
+	time.Local = time.FixedZone("UTC+8", 8*3600)
+	defer func() {
+		time.Local = local
+	}()
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local).Unix()
+	end := time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local).Unix() - 1
+	if err := DB.Create(&Token{Id: 1, UserId: 1, Key: "k", Name: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	redemption := Redemption{Name: "welcome", Key: "k", Quota: 500, MaxUses: 2, UsedCount: 2, UsedUserId: 2}
+	if err := DB.Create(&redemption).Error; err != nil {
+		t.Fatal(err)
+	}
+	logs := []*Log{
+		// 23:50 and 00:10 local time are on different days, though the same UTC day
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: time.Date(2024, 5, 10, 23, 50, 0, 0, time.Local).Unix(), ModelName: "gpt-4o", TokenId: 1, TokenName: "a", Quota: 10},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: time.Date(2024, 5, 11, 0, 10, 0, 0, time.Local).Unix(), ModelName: "gpt-4o", TokenId: 1, TokenName: "a", Quota: 20},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: time.Date(2024, 5, 11, 23, 0, 0, 0, time.Local).Unix(), ModelName: "gpt-4o", TokenId: 1, TokenName: "a", Quota: 30},
+		// 00:30 on the first day of the period, still April in UTC
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: time.Date(2024, 5, 1, 0, 30, 0, 0, time.Local).Unix(), ModelName: "gpt-4o", TokenId: 1, TokenName: "a", Quota: 5},
+		{UserId: 1, Type: LogTypeTopup, CreatedAt: time.Date(2024, 5, 12, 10, 0, 0, 0, time.Local).Unix(), Content: "管理员充值", Quota: 1000},
+		{UserId: 1, Type: LogTypeTopup, CreatedAt: time.Date(2024, 5, 13, 10, 0, 0, 0, time.Local).Unix(), Content: "通过兑换码充值 $1", Quota: 500, RedemptionId: redemption.Id},
+	}
+	if err := LOG_DB.Create(logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Create(&RedemptionUse{RedemptionId: redemption.Id, UserId: 1, Quota: 500, CreatedTime: logs[5].CreatedAt}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("days are the days of the server time zone, like the period", t, func() {
+		statement, err := GetUserStatement(1, start, end)
+		So(err, ShouldBeNil)
+		So(statement.Lines, ShouldHaveLength, 3)
+		So(statement.Lines[0].Day, ShouldEqual, "2024-05-01")
+		So(statement.Lines[0].Quota, ShouldEqual, 5)
+		So(statement.Lines[1].Day, ShouldEqual, "2024-05-10")
+		So(statement.Lines[1].Quota, ShouldEqual, 10)
+		So(statement.Lines[2].Day, ShouldEqual, "2024-05-11")
+		So(statement.Lines[2].Quota, ShouldEqual, 50)
+		So(statement.Lines[2].RequestCount, ShouldEqual, 2)
+		So(statement.TotalQuota, ShouldEqual, 65)
+	})
+	Convey("redemptions are not counted as top-ups", t, func() {
+		statement, err := GetUserStatement(1, start, end)
+		So(err, ShouldBeNil)
+		So(statement.Topups, ShouldHaveLength, 1)
+		So(statement.TotalTopupQuota, ShouldEqual, 1000)
+		// the code was redeemed by another user last
+		So(statement.Redemptions, ShouldHaveLength, 1)
+		So(statement.Redemptions[0].Name, ShouldEqual, "welcome")
+		So(statement.Redemptions[0].Quota, ShouldEqual, 500)
+	})
+	Convey("logs deleted by the retention are read from the rollups", t, func() {
+		So(RollupUsage(), ShouldBeNil)
+		So(LOG_DB.Where("type = ?", LogTypeConsume).Delete(&Log{}).Error, ShouldBeNil)
+		statement, err := GetUserStatement(1, start, end)
+		So(err, ShouldBeNil)
+		So(statement.Lines, ShouldHaveLength, 3)
+		So(statement.Lines[0].Day, ShouldEqual, "2024-05-01")
+		So(statement.Lines[0].TokenName, ShouldEqual, "a")
+		So(statement.Lines[2].Day, ShouldEqual, "2024-05-11")
+		So(statement.Lines[2].Quota, ShouldEqual, 50)
+		So(statement.Lines[2].RequestCount, ShouldEqual, 2)
+		So(statement.TotalQuota, ShouldEqual, 65)
+	})
+}
@@ -21,7 +21,9 @@ const (
 type Token struct {
 	Id             int     `json:"id"`
 	UserId         int     `json:"user_id"`
-	Key            string  `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key            string  `json:"-" gorm:"type:char(48);uniqueIndex"` // keyed hash of the key, see HashTokenKey
+	KeyPrefix      string  `json:"key_prefix" gorm:"type:varchar(16);default:''"`
+	RawKey         string  `json:"key,omitempty" gorm:"-:all"` // only set when the token is created
 	Status         int     `json:"status" gorm:"default:1"`
 	Name           string  `json:"name" gorm:"index" `
 	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
@@ -32,6 +34,15 @@ type Token struct {
 	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
 	Models         *string `json:"models" gorm:"default:''"`           // allowed models
 	Subnet         *string `json:"subnet" gorm:"default:''"`           // allowed subnet
+	OrgId          int     `json:"org_id" gorm:"index;default:0"`      // bill the organization pool instead of the user
+
+	// the key before the last rotation, valid until PreviousKeyExpiredTime
+	PreviousKey            string `json:"-" gorm:"type:char(48);index;default:''"`
+	PreviousKeyExpiredTime int64  `json:"previous_key_expired_time" gorm:"bigint;default:0"`
+
+	QuotaAllowance
+	TokenLimit
+	TokenCapability
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int, order string) ([]*Token, error) {
@@ -69,6 +80,10 @@ func ValidateUserToken(key string) (token *Token, err error) {
 		}
 		return nil, errors.New("令牌验证失败")
 	}
+	_, err = ApplyTokenAllowance(token)
+	if err != nil {
+		logger.SysError("failed to apply token quota allowance: " + err.Error())
+	}
 	if token.Status == TokenStatusExhausted {
 		return nil, fmt.Errorf("令牌 %s（#%d）额度已用尽", token.Name, token.Id)
 	} else if token.Status == TokenStatusExpired {
@@ -123,6 +138,7 @@ func GetTokenById(id int) (*Token, error) {
 
 func (token *Token) Insert() error {
 	var err error
+	token.generateKey()
 	err = DB.Create(token).Error
 	return err
 }
@@ -130,7 +146,11 @@ func (token *Token) Insert() error {
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (token *Token) Update() error {
 	var err error
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(token).Error
+	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet", "org_id",
+		"quota_reset_period", "quota_reset_amount", "quota_reset_accrue", "quota_accrue_cap", "last_quota_reset_time",
+		"hourly_quota_limit", "daily_quota_limit", "monthly_quota_limit",
+		"minute_request_limit", "hourly_request_limit", "daily_request_limit",
+		"relay_modes", "max_tokens_limit", "max_n", "max_body_size", "tools_disabled", "vision_disabled", "stream_disabled").Updates(token).Error
 	return err
 }
 
@@ -213,6 +233,9 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return errors.New("令牌额度不足")
 	}
+	if token.OrgId != 0 {
+		return preConsumeOrgTokenQuota(token, quota)
+	}
 	userQuota, err := GetUserQuota(token.UserId)
 	if err != nil {
 		return err
@@ -249,12 +272,24 @@ func PreConsumeTokenQuota(tokenId int, quota int64) (err error) {
 		}
 	}
 	err = DecreaseUserQuota(token.UserId, quota)
-	return err
+	if err != nil {
+		return err
+	}
+	recordSpend(tokenId, quota)
+	if quota > 0 {
+		go CheckAlertRules(token.UserId)
+	}
+	return nil
 }
 
 func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
 	token, err := GetTokenById(tokenId)
-	if quota > 0 {
+	if err != nil {
+		return err
+	}
+	if token.OrgId != 0 {
+		err = consumeOrgQuota(token.OrgId, token.UserId, quota, false)
+	} else if quota > 0 {
 		err = DecreaseUserQuota(token.UserId, quota)
 	} else {
 		err = IncreaseUserQuota(token.UserId, -quota)
@@ -272,5 +307,32 @@ func PostConsumeTokenQuota(tokenId int, quota int64) (err error) {
 			return err
 		}
 	}
+	recordSpend(tokenId, quota)
+	if quota > 0 {
+		go CheckAlertRules(token.UserId)
+	}
+	return nil
+}
+
+// preConsumeOrgTokenQuota is PreConsumeTokenQuota for tokens drawing from an organization pool
+func preConsumeOrgTokenQuota(token *Token, quota int64) error {
+	err := consumeOrgQuota(token.OrgId, token.UserId, quota, true)
+	if err != nil {
+		return err
+	}
+	if !token.UnlimitedQuota {
+		err = DecreaseTokenQuota(token.Id, quota)
+		if err != nil {
+			// the pool has been charged already, give it back
+			if refundErr := consumeOrgQuota(token.OrgId, token.UserId, -quota, false); refundErr != nil {
+				logger.SysError(fmt.Sprintf("failed to refund quota %d to organization #%d: %s", quota, token.OrgId, refundErr.Error()))
+			}
+			return err
+		}
+	}
+	recordSpend(token.Id, quota)
+	if quota > 0 {
+		go CheckAlertRules(token.UserId)
+	}
 	return nil
 }
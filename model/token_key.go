@@ -0,0 +1,152 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	tokenKeySecretOption = "TokenKeySecret"
+	tokenKeyPrefixLength = 8
+)
+
+// HashTokenKey returns the keyed hash stored in place of the token key,
+// it's 43 characters so it fits the old char(48) column
+func HashTokenKey(key string) string {
+	mac := hmac.New(sha256.New, []byte(config.TokenKeySecret))
+	mac.Write([]byte(key))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// generateKey creates a new key for the token, only its hash and prefix are saved
+func (token *Token) generateKey() {
+	if token.RawKey == "" {
+		token.RawKey = random.GenerateKey()
+	}
+	token.Key = HashTokenKey(token.RawKey)
+	token.KeyPrefix = token.RawKey
+	if len(token.KeyPrefix) > tokenKeyPrefixLength {
+		token.KeyPrefix = token.KeyPrefix[:tokenKeyPrefixLength]
+	}
+}
+
+// InitTokenKeys loads the secret used for hashing token keys and hashes the keys
+// of tokens created before keys were hashed. TOKEN_KEY_SECRET takes precedence,
+// otherwise a secret is generated once and kept in the options table.
+func InitTokenKeys() error {
+	if config.TokenKeySecret == "" {
+		option := Option{Key: tokenKeySecretOption}
+		// FirstOrCreate keeps the secret another node has already saved
+		err := DB.Where(Option{Key: tokenKeySecretOption}).Attrs(Option{Value: random.GetUUID() + random.GetUUID()}).FirstOrCreate(&option).Error
+		if err != nil {
+			return err
+		}
+		config.TokenKeySecret = option.Value
+	}
+	if !config.IsMasterNode {
+		return nil
+	}
+	return migrateTokenKeys()
+}
+
+func migrateTokenKeys() error {
+	var tokens []*Token
+	migrated := 0
+	err := DB.Where("key_prefix = ? or key_prefix is null", "").FindInBatches(&tokens, 100, func(tx *gorm.DB, batch int) error {
+		for _, token := range tokens {
+			// keys of any length are hashed, some were set by INITIAL_ROOT_TOKEN or imported
+			key := strings.TrimSpace(token.Key)
+			if key == "" {
+				continue
+			}
+			prefix := key
+			if len(prefix) > tokenKeyPrefixLength {
+				prefix = prefix[:tokenKeyPrefixLength]
+			}
+			err := tx.Model(&Token{}).Where("id = ?", token.Id).Updates(map[string]any{
+				"key":        HashTokenKey(key),
+				"key_prefix": prefix,
+			}).Error
+			if err != nil {
+				return err
+			}
+			migrated++
+		}
+		return nil
+	}).Error
+	if migrated > 0 {
+		logger.SysLog(fmt.Sprintf("hashed the keys of %d existing tokens", migrated))
+	}
+	return err
+}
+
+// invalidateTokenCache removes the cached token, under both of its keys
+func invalidateTokenCache(token *Token) {
+	if !common.RedisEnabled {
+		return
+	}
+	for _, keyHash := range []string{token.Key, token.PreviousKey} {
+		if keyHash == "" {
+			continue
+		}
+		err := common.RedisDel(fmt.Sprintf("token:%s", keyHash))
+		if err != nil {
+			logger.SysError("Redis delete token error: " + err.Error())
+		}
+	}
+}
+
+// RotateTokenKey gives the token a new key, the current one keeps working for gracePeriod seconds.
+// The new key is returned in RawKey of the token.
+func RotateTokenKey(id int, userId int, gracePeriod int64) (*Token, error) {
+	token, err := GetTokenByIds(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	oldToken := *token
+	token.RawKey = ""
+	token.generateKey()
+	token.PreviousKey = ""
+	token.PreviousKeyExpiredTime = 0
+	if gracePeriod > 0 {
+		token.PreviousKey = oldToken.Key
+		token.PreviousKeyExpiredTime = helper.GetTimestamp() + gracePeriod
+	}
+	// the condition on the old key makes concurrent rotations fail instead of losing a key
+	keyCol := "`key`"
+	if common.UsingPostgreSQL {
+		keyCol = `"key"`
+	}
+	result := DB.Model(&Token{}).Where("id = ? and "+keyCol+" = ?", token.Id, oldToken.Key).Updates(map[string]any{
+		"key":                       token.Key,
+		"key_prefix":                token.KeyPrefix,
+		"previous_key":              token.PreviousKey,
+		"previous_key_expired_time": token.PreviousKeyExpiredTime,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("令牌已被轮换，请刷新后重试")
+	}
+	invalidateTokenCache(&oldToken)
+	content := fmt.Sprintf("令牌「%s」（#%d）已轮换密钥，新密钥前缀 %s", token.Name, token.Id, token.KeyPrefix)
+	if gracePeriod > 0 {
+		content += fmt.Sprintf("，旧密钥（前缀 %s）在 %s 前仍可使用", oldToken.KeyPrefix, time.Unix(token.PreviousKeyExpiredTime, 0).Format("2006-01-02 15:04:05"))
+	} else {
+		content += "，旧密钥已立即失效"
+	}
+	RecordLog(userId, LogTypeManage, content)
+	return token, nil
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"gorm.io/gorm"
+)
+
+func TestMigrateTokenKeys(t *testing.T) {
+	setupTestDB(t, &Token{})
+	config.TokenKeySecret = "secret"
+	keys := []string{
+		"abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKL", // generated, 48 characters
+		"my-initial-root-token",
+		"short",
+	}
+	for i, key := range keys {
+		if err := DB.Create(&Token{Id: i + 1, Key: key, Name: key}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	Convey("keys of any length are hashed", t, func() {
+		So(migrateTokenKeys(), ShouldBeNil)
+		for i, key := range keys {
+			var token Token
+			So(DB.First(&token, i+1).Error, ShouldBeNil)
+			So(token.Key, ShouldEqual, HashTokenKey(key))
+			So(key, ShouldStartWith, token.KeyPrefix)
+			So(token.KeyPrefix, ShouldNotBeEmpty)
+		}
+		// hashed keys are not hashed again
+		So(migrateTokenKeys(), ShouldBeNil)
+		var token Token
+		DB.First(&token, 2)
+		So(token.Key, ShouldEqual, HashTokenKey(keys[1]))
+	})
+}
+
+func TestRotateTokenKey(t *testing.T) {
+	setupTestDB(t, &User{}, &Token{}, &Log{})
+	config.TokenKeySecret = "secret"
+	token := Token{UserId: 1, Name: "rotated"}
+	if err := token.Insert(); err != nil {
+		t.Fatal(err)
+	}
+	oldKey := token.RawKey
+
+	Convey("the old key works during the grace period", t, func() {
+		rotated, err := RotateTokenKey(token.Id, 1, 3600)
+		So(err, ShouldBeNil)
+		So(rotated.RawKey, ShouldNotEqual, oldKey)
+		found, err := CacheGetTokenByKey(oldKey)
+		So(err, ShouldBeNil)
+		So(found.Id, ShouldEqual, token.Id)
+		found, err = CacheGetTokenByKey(rotated.RawKey)
+		So(err, ShouldBeNil)
+		So(found.Id, ShouldEqual, token.Id)
+
+		Convey("and is rejected after it", func() {
+			So(DB.Model(&Token{}).Where("id = ?", token.Id).Update("previous_key_expired_time", helper.GetTimestamp()-1).Error, ShouldBeNil)
+			_, err = CacheGetTokenByKey(oldKey)
+			So(err, ShouldEqual, gorm.ErrRecordNotFound)
+			_, err = CacheGetTokenByKey(rotated.RawKey)
+			So(err, ShouldBeNil)
+		})
+	})
+	Convey("without a grace period the old key is rejected at once", t, func() {
+		current, err := GetTokenById(token.Id)
+		So(err, ShouldBeNil)
+		rotated, err := RotateTokenKey(token.Id, 1, 0)
+		So(err, ShouldBeNil)
+		So(rotated.PreviousKey, ShouldBeEmpty)
+		var found Token
+		So(DB.Where("previous_key = ?", current.Key).First(&found).Error, ShouldEqual, gorm.ErrRecordNotFound)
+	})
+	Convey("a rotation racing with another one fails", t, func() {
+		var inner *Token
+		// the other rotation lands between reading the token and writing the new key
+		err := DB.Callback().Update().Before("gorm:update").Register("test:rotate", func(*gorm.DB) {
+			if inner == nil {
+				inner = &Token{}
+				rotated, err := RotateTokenKey(token.Id, 1, 3600)
+				So(err, ShouldBeNil)
+				*inner = *rotated
+			}
+		})
+		So(err, ShouldBeNil)
+		defer func() {
+			_ = DB.Callback().Update().Remove("test:rotate")
+		}()
+		_, err = RotateTokenKey(token.Id, 1, 3600)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "令牌已被轮换")
+		current, err := CacheGetTokenByKey(inner.RawKey)
+		So(err, ShouldBeNil)
+		So(current.Key, ShouldEqual, HashTokenKey(inner.RawKey))
+	})
+}
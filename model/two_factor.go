@@ -0,0 +1,264 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/totp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const recoveryCodeCount = 10
+
+// TwoFactorMaxPendingFailures is the number of wrong codes after which a pending login is dropped
+const TwoFactorMaxPendingFailures = 5
+
+// TwoFactor keeps the TOTP secret of a user apart from the users table,
+// so that it never ends up in the user json returned by the api
+type TwoFactor struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"uniqueIndex"`
+	Secret        string `json:"-" gorm:"type:varchar(64)"`
+	RecoveryCodes string `json:"-" gorm:"type:text"` // comma separated sha256 of the unused recovery codes
+	Enabled       bool   `json:"enabled"`
+	LastUsedStep  int64  `json:"-" gorm:"bigint"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+}
+
+func GetTwoFactor(userId int) (*TwoFactor, error) {
+	twoFactor := TwoFactor{}
+	err := DB.First(&twoFactor, "user_id = ?", userId).Error
+	return &twoFactor, err
+}
+
+func IsTwoFactorEnabled(userId int) bool {
+	twoFactor, err := GetTwoFactor(userId)
+	return err == nil && twoFactor.Enabled
+}
+
+// SetupTwoFactor generates a new secret for the user, it's not in effect until EnableTwoFactor
+func SetupTwoFactor(userId int) (*TwoFactor, error) {
+	twoFactor, err := GetTwoFactor(userId)
+	if err == nil && twoFactor.Enabled {
+		return nil, errors.New("两步验证已启用")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	twoFactor.UserId = userId
+	twoFactor.Secret = secret
+	twoFactor.Enabled = false
+	twoFactor.RecoveryCodes = ""
+	twoFactor.LastUsedStep = 0
+	twoFactor.CreatedTime = helper.GetTimestamp()
+	err = DB.Save(twoFactor).Error
+	return twoFactor, err
+}
+
+// EnableTwoFactor confirms the pending secret with a code and returns the recovery codes
+func EnableTwoFactor(userId int, code string) ([]string, error) {
+	twoFactor, err := GetTwoFactor(userId)
+	if err != nil {
+		return nil, errors.New("请先生成两步验证密钥")
+	}
+	if twoFactor.Enabled {
+		return nil, errors.New("两步验证已启用")
+	}
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return nil, errors.New("验证码错误")
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Model(twoFactor).Updates(map[string]any{
+		"enabled":        true,
+		"last_used_step": step,
+		"recovery_codes": hashes,
+	}).Error
+	return codes, err
+}
+
+// VerifyTwoFactor accepts either a TOTP code or an unused recovery code
+func VerifyTwoFactor(userId int, code string) error {
+	twoFactor, err := GetTwoFactor(userId)
+	if err != nil || !twoFactor.Enabled {
+		return errors.New("未启用两步验证")
+	}
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(twoFactor.Secret, code, time.Now()); ok {
+		// the conditional update makes each code usable only once, even across nodes
+		result := DB.Model(&TwoFactor{}).Where("id = ? and last_used_step < ?", twoFactor.Id, step).Update("last_used_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("验证码已被使用")
+		}
+		return nil
+	}
+	hash := hashRecoveryCode(code)
+	var remaining []string
+	found := false
+	for _, h := range strings.Split(twoFactor.RecoveryCodes, ",") {
+		if h == "" {
+			continue
+		}
+		if h == hash && !found {
+			found = true
+			continue
+		}
+		remaining = append(remaining, h)
+	}
+	if !found {
+		return errors.New("验证码错误")
+	}
+	result := DB.Model(&TwoFactor{}).Where("id = ? and recovery_codes = ?", twoFactor.Id, twoFactor.RecoveryCodes).Update("recovery_codes", strings.Join(remaining, ","))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("验证码已被使用")
+	}
+	return nil
+}
+
+// VerifyTwoFactorLogin checks the code of a pending login, wrong codes count toward the account lockout
+func VerifyTwoFactorLogin(userId int, code string) error {
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return err
+	}
+	now := helper.GetTimestamp()
+	err = user.checkLoginThrottle(now)
+	if err != nil {
+		return err
+	}
+	err = VerifyTwoFactor(userId, code)
+	if err != nil {
+		if lockedUntil := user.recordLoginFailure(now); lockedUntil != 0 {
+			return &LoginThrottledError{
+				Message: fmt.Sprintf("登录失败次数过多，账户已被临时锁定，请于 %s 后重试", time.Unix(lockedUntil, 0).Format("2006-01-02 15:04:05")),
+				Locked:  true,
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Pending logins are identified by a nonce kept in the session. Their failures are counted
+// on the server, because a cookie session can be replayed with an older count.
+var pendingTwoFactorFailures = make(map[string]*pendingTwoFactorFailure)
+var pendingTwoFactorFailuresLock sync.Mutex
+
+type pendingTwoFactorFailure struct {
+	count    int64
+	expireAt time.Time
+}
+
+func pendingTwoFactorKey(nonce string) string {
+	return "two_factor_pending_failures:" + nonce
+}
+
+// AddPendingTwoFactorFailure counts a wrong code of the pending login and returns the count so far
+func AddPendingTwoFactorFailure(nonce string, ttl time.Duration) (int64, error) {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		pipe := common.RDB.TxPipeline()
+		incr := pipe.Incr(ctx, pendingTwoFactorKey(nonce))
+		pipe.Expire(ctx, pendingTwoFactorKey(nonce), ttl)
+		_, err := pipe.Exec(ctx)
+		return incr.Val(), err
+	}
+	pendingTwoFactorFailuresLock.Lock()
+	defer pendingTwoFactorFailuresLock.Unlock()
+	now := time.Now()
+	for key, failure := range pendingTwoFactorFailures {
+		if now.After(failure.expireAt) {
+			delete(pendingTwoFactorFailures, key)
+		}
+	}
+	failure, ok := pendingTwoFactorFailures[nonce]
+	if !ok {
+		failure = &pendingTwoFactorFailure{expireAt: now.Add(ttl)}
+		pendingTwoFactorFailures[nonce] = failure
+	}
+	failure.count++
+	return failure.count, nil
+}
+
+func GetPendingTwoFactorFailures(nonce string) (int64, error) {
+	if common.RedisEnabled {
+		count, err := common.RDB.Get(context.Background(), pendingTwoFactorKey(nonce)).Int64()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		return count, nil
+	}
+	pendingTwoFactorFailuresLock.Lock()
+	defer pendingTwoFactorFailuresLock.Unlock()
+	failure, ok := pendingTwoFactorFailures[nonce]
+	if !ok || time.Now().After(failure.expireAt) {
+		return 0, nil
+	}
+	return failure.count, nil
+}
+
+func RegenerateRecoveryCodes(userId int) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	result := DB.Model(&TwoFactor{}).Where("user_id = ? and enabled = ?", userId, true).Update("recovery_codes", hashes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("未启用两步验证")
+	}
+	return codes, nil
+}
+
+func (twoFactor *TwoFactor) RemainingRecoveryCodes() int {
+	if twoFactor.RecoveryCodes == "" {
+		return 0
+	}
+	return len(strings.Split(twoFactor.RecoveryCodes, ","))
+}
+
+// DeleteTwoFactor turns two-factor authentication off, used by the user and for resets by admins
+func DeleteTwoFactor(userId int) error {
+	return DB.Where("user_id = ?", userId).Delete(&TwoFactor{}).Error
+}
+
+func generateRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, "", err
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, strings.Join(hashes, ","), nil
+}
+
+func hashRecoveryCode(code string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(code)))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,435 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageRollup is the hourly pre-aggregation of the logs the analytics API reads from. Logs are added
+// by a periodic job and stay in the rollups after retention deleted them. Failed relay requests write
+// no log, they are counted in memory and flushed with the same period.
+type UsageRollup struct {
+	Id               int    `json:"id"`
+	BucketStart      int64  `json:"bucket_start" gorm:"bigint;uniqueIndex:idx_usage_rollup,priority:1"`
+	Type             int    `json:"type" gorm:"uniqueIndex:idx_usage_rollup,priority:2"`
+	UserId           int    `json:"user_id" gorm:"uniqueIndex:idx_usage_rollup,priority:3"`
+	TokenId          int    `json:"token_id" gorm:"uniqueIndex:idx_usage_rollup,priority:4"`
+	ChannelId        int    `json:"channel_id" gorm:"uniqueIndex:idx_usage_rollup,priority:5"`
+	ModelName        string `json:"model_name" gorm:"type:varchar(128);uniqueIndex:idx_usage_rollup,priority:6"`
+	GroupName        string `json:"group_name" gorm:"type:varchar(32);uniqueIndex:idx_usage_rollup,priority:7"`
+	Requests         int64  `json:"requests" gorm:"bigint;default:0"`
+	Errors           int64  `json:"errors" gorm:"bigint;default:0"`
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"bigint;default:0"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"bigint;default:0"`
+	Quota            int64  `json:"quota" gorm:"bigint;default:0"`
+}
+
+// UsageRollupCursor has a single row, the id of the last log added to the rollups
+type UsageRollupCursor struct {
+	Id    int `json:"id"`
+	LogId int `json:"log_id"`
+}
+
+const (
+	// sizes of the text columns of UsageRollup, longer values are truncated
+	usageModelNameLength = 128
+	usageGroupNameLength = 32
+
+	usageBucketSize      = 3600
+	usageRollupBatchSize = 1000
+	// logs younger than this are left to the next run, so that inserts still in flight are not skipped
+	usageRollupDelay = 60
+)
+
+type usageKey struct {
+	bucketStart int64
+	logType     int
+	userId      int
+	tokenId     int
+	channelId   int
+	modelName   string
+	groupName   string
+}
+
+type usageDelta struct {
+	requests         int64
+	errors           int64
+	promptTokens     int64
+	completionTokens int64
+	quota            int64
+}
+
+var usageErrors = make(map[usageKey]*usageDelta)
+var usageErrorsLock sync.Mutex
+
+// RecordUsageError counts a failed relay request, successful ones are rolled up from their consume logs
+func RecordUsageError(stats *RelayStats, userId int, channelId int) {
+	if stats == nil || userId == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	key := usageKey{
+		bucketStart: now - now%usageBucketSize,
+		logType:     LogTypeConsume,
+		userId:      userId,
+		tokenId:     stats.TokenId,
+		channelId:   channelId,
+		modelName:   stats.ModelName,
+		groupName:   stats.Group,
+	}
+	usageErrorsLock.Lock()
+	defer usageErrorsLock.Unlock()
+	delta, ok := usageErrors[key]
+	if !ok {
+		delta = &usageDelta{}
+		usageErrors[key] = delta
+	}
+	delta.requests++
+	delta.errors++
+}
+
+func truncateRunes(s string, length int) string {
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	return string([]rune(s)[:length])
+}
+
+func addUsageRollup(tx *gorm.DB, key usageKey, delta *usageDelta) error {
+	rollup := UsageRollup{
+		BucketStart:      key.bucketStart,
+		Type:             key.logType,
+		UserId:           key.userId,
+		TokenId:          key.tokenId,
+		ChannelId:        key.channelId,
+		ModelName:        truncateRunes(key.modelName, usageModelNameLength),
+		GroupName:        truncateRunes(key.groupName, usageGroupNameLength),
+		Requests:         delta.requests,
+		Errors:           delta.errors,
+		PromptTokens:     delta.promptTokens,
+		CompletionTokens: delta.completionTokens,
+		Quota:            delta.quota,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "bucket_start"}, {Name: "type"}, {Name: "user_id"}, {Name: "token_id"}, {Name: "channel_id"}, {Name: "model_name"}, {Name: "group_name"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"requests":          gorm.Expr("usage_rollups.requests + ?", delta.requests),
+			"errors":            gorm.Expr("usage_rollups.errors + ?", delta.errors),
+			"prompt_tokens":     gorm.Expr("usage_rollups.prompt_tokens + ?", delta.promptTokens),
+			"completion_tokens": gorm.Expr("usage_rollups.completion_tokens + ?", delta.completionTokens),
+			"quota":             gorm.Expr("usage_rollups.quota + ?", delta.quota),
+		}),
+	}).Create(&rollup).Error
+}
+
+func flushUsageErrors() {
+	usageErrorsLock.Lock()
+	deltas := usageErrors
+	usageErrors = make(map[usageKey]*usageDelta)
+	usageErrorsLock.Unlock()
+	for key, delta := range deltas {
+		err := addUsageRollup(LOG_DB, key, delta)
+		if err != nil {
+			logger.SysError("failed to update usage rollup: " + err.Error())
+		}
+	}
+}
+
+var errUsageRollupConflict = errors.New("usage rollup cursor moved by another run")
+
+// rollupLogBatch adds the next batch of logs to the rollups and moves the cursor past them in one transaction,
+// with skip set it only moves the cursor
+func rollupLogBatch(limit int, skip bool) (int, error) {
+	var count int
+	err := LOG_DB.Transaction(func(tx *gorm.DB) error {
+		cursor := UsageRollupCursor{Id: 1}
+		err := tx.FirstOrCreate(&cursor, UsageRollupCursor{Id: 1}).Error
+		if err != nil {
+			return err
+		}
+		var logs []*Log
+		err = tx.Where("id > ?", cursor.LogId).Order("id").Limit(limit).Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		// the cursor must not pass a log which is too recent
+		recent := helper.GetTimestamp() - usageRollupDelay
+		for i, log := range logs {
+			if log.CreatedAt >= recent {
+				logs = logs[:i]
+				break
+			}
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		// moving the cursor first makes a concurrent run of the same batch wait and then roll back
+		result := tx.Model(&UsageRollupCursor{}).Where("id = ? AND log_id = ?", cursor.Id, cursor.LogId).
+			Update("log_id", logs[len(logs)-1].Id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errUsageRollupConflict
+		}
+		count = len(logs)
+		if skip {
+			return nil
+		}
+		deltas := make(map[usageKey]*usageDelta)
+		for _, log := range logs {
+			key := usageKey{
+				bucketStart: log.CreatedAt - log.CreatedAt%usageBucketSize,
+				logType:     log.Type,
+				userId:      log.UserId,
+				tokenId:     log.TokenId,
+				channelId:   log.ChannelId,
+				modelName:   log.ModelName,
+				groupName:   log.GroupName,
+			}
+			delta, ok := deltas[key]
+			if !ok {
+				delta = &usageDelta{}
+				deltas[key] = delta
+			}
+			delta.requests++
+			delta.promptTokens += int64(log.PromptTokens)
+			delta.completionTokens += int64(log.CompletionTokens)
+			delta.quota += int64(log.Quota)
+		}
+		for key, delta := range deltas {
+			err = addUsageRollup(tx, key, delta)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		count = 0
+	}
+	return count, err
+}
+
+var usageRollupLock sync.Mutex
+
+// RollupUsage adds all logs written since the last run to the rollups, the first run backfills the whole table
+func RollupUsage() error {
+	usageRollupLock.Lock()
+	defer usageRollupLock.Unlock()
+	for {
+		count, err := rollupLogBatch(usageRollupBatchSize, false)
+		if err != nil && !errors.Is(err, errUsageRollupConflict) {
+			// retries the first log of the batch alone and skips it if it fails again, so one bad log can't stop the rollups
+			count, err = rollupLogBatch(1, false)
+			if err != nil && !errors.Is(err, errUsageRollupConflict) {
+				logger.SysError("failed to roll up a log, skipped: " + err.Error())
+				count, err = rollupLogBatch(1, true)
+			}
+			if err == nil && count > 0 {
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if count < usageRollupBatchSize {
+			return nil
+		}
+	}
+}
+
+// usageRollupCursor returns the id of the last log in the rollups
+func usageRollupCursor() (int, error) {
+	var cursor UsageRollupCursor
+	err := LOG_DB.Where("id = ?", 1).Limit(1).Find(&cursor).Error
+	return cursor.LogId, err
+}
+
+// readUsage runs read with the cursor of the rollups, read takes the logs up to the cursor from the
+// rollups and the newer ones from the logs. It is retried if a rollup run moves the cursor meanwhile,
+// the logs read then may have been added to the rollups already.
+func readUsage(read func(cursor int) error) error {
+	for i := 0; i < 3; i++ {
+		cursor, err := usageRollupCursor()
+		if err != nil {
+			return err
+		}
+		err = read(cursor)
+		if err != nil {
+			return err
+		}
+		after, err := usageRollupCursor()
+		if err != nil {
+			return err
+		}
+		if after == cursor {
+			return nil
+		}
+	}
+	return errUsageRollupConflict
+}
+
+// GetUsageQuota returns the quota consumed by the user, or by the token if tokenId is set, since start.
+// Logs deleted by the retention are still counted from the rollups, start is rounded down to the hour
+// of its bucket for them.
+func GetUsageQuota(userId int, tokenId int, start int64) (quota int64, err error) {
+	err = readUsage(func(cursor int) error {
+		var rolledUp, recent int64
+		tx := LOG_DB.Model(&UsageRollup{}).Where("bucket_start >= ? and type = ? and user_id = ?", start-start%usageBucketSize, LogTypeConsume, userId)
+		if tokenId != 0 {
+			tx = tx.Where("token_id = ?", tokenId)
+		}
+		err := tx.Select("COALESCE(SUM(quota), 0)").Scan(&rolledUp).Error
+		if err != nil {
+			return err
+		}
+		tx = LOG_DB.Model(&Log{}).Where("id > ? and created_at >= ? and type = ? and user_id = ?", cursor, start, LogTypeConsume, userId)
+		if tokenId != 0 {
+			tx = tx.Where("token_id = ?", tokenId)
+		}
+		err = tx.Select("COALESCE(SUM(quota), 0)").Scan(&recent).Error
+		if err != nil {
+			return err
+		}
+		quota = rolledUp + recent
+		return nil
+	})
+	return quota, err
+}
+
+func SyncUsageRollups(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		flushUsageErrors()
+		if !config.IsMasterNode {
+			continue
+		}
+		err := RollupUsage()
+		if err != nil && !errors.Is(err, errUsageRollupConflict) {
+			logger.SysError("failed to roll up usage: " + err.Error())
+		}
+	}
+}
+
+// UsageDimensions maps the dimensions accepted by the analytics API to rollup columns
+var UsageDimensions = map[string]string{
+	"model":   "model_name",
+	"channel": "channel_id",
+	"user":    "user_id",
+	"token":   "token_id",
+	"group":   "group_name",
+}
+
+var UsageGranularities = map[string]int64{
+	"hour": 3600,
+	"day":  86400,
+	"week": 7 * 86400,
+}
+
+type UsageQuery struct {
+	Type           int // a log type, all types for LogTypeUnknown
+	Granularity    string
+	GroupBy        []string // keys of UsageDimensions
+	StartTimestamp int64
+	EndTimestamp   int64
+	UserId         int
+	TokenId        int
+	ChannelId      int
+	ModelName      string
+	GroupName      string
+}
+
+type UsageStatistic struct {
+	Bucket           int64  `json:"bucket"`
+	ModelName        string `json:"model_name,omitempty"`
+	ChannelId        int    `json:"channel_id,omitempty"`
+	UserId           int    `json:"user_id,omitempty"`
+	TokenId          int    `json:"token_id,omitempty"`
+	GroupName        string `json:"group_name,omitempty"`
+	Requests         int64  `json:"requests"`
+	Errors           int64  `json:"errors"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	Quota            int64  `json:"quota"`
+}
+
+// usageBucketExpr folds hourly buckets into buckets of the given size starting at local midnight (and Monday for weeks).
+// The offset of the server time zone is taken now and applied to the whole range, so across a DST change the days are
+// shifted by the DST difference. The rollups are hourly and aligned to UTC, so in zones whose offset is not a whole
+// hour (e.g. +05:30) the hour around midnight is counted in the day it started in. Exact local days need the hourly
+// granularity.
+func usageBucketExpr(size int64) string {
+	if size == usageBucketSize {
+		return "bucket_start"
+	}
+	_, offset := time.Now().Zone()
+	shift := int64(offset)
+	if size == UsageGranularities["week"] {
+		shift += 3 * 86400 // the epoch was a Thursday
+	}
+	return fmt.Sprintf("bucket_start - ((bucket_start + %d) %% %d)", shift, size)
+}
+
+func GetUsageStatistics(query UsageQuery) (statistics []*UsageStatistic, err error) {
+	size, ok := UsageGranularities[query.Granularity]
+	if !ok {
+		return nil, fmt.Errorf("unknown granularity: %s", query.Granularity)
+	}
+	bucket := usageBucketExpr(size)
+	selects := []string{bucket + " AS bucket"}
+	groups := []string{"bucket"}
+	for _, dimension := range query.GroupBy {
+		column, ok := UsageDimensions[dimension]
+		if !ok {
+			return nil, fmt.Errorf("unknown dimension: %s", dimension)
+		}
+		selects = append(selects, column)
+		groups = append(groups, column)
+	}
+	selects = append(selects,
+		"SUM(requests) AS requests",
+		"SUM(errors) AS errors",
+		"SUM(prompt_tokens) AS prompt_tokens",
+		"SUM(completion_tokens) AS completion_tokens",
+		"SUM(quota) AS quota",
+	)
+	tx := LOG_DB.Model(&UsageRollup{}).Select(strings.Join(selects, ", "))
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("bucket_start >= ?", query.StartTimestamp-query.StartTimestamp%usageBucketSize)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("bucket_start <= ?", query.EndTimestamp)
+	}
+	if query.Type != LogTypeUnknown {
+		tx = tx.Where("type = ?", query.Type)
+	}
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.TokenId != 0 {
+		tx = tx.Where("token_id = ?", query.TokenId)
+	}
+	if query.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", query.ChannelId)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name = ?", query.ModelName)
+	}
+	if query.GroupName != "" {
+		tx = tx.Where("group_name = ?", query.GroupName)
+	}
+	groupBy := strings.Join(groups, ", ")
+	err = tx.Group(groupBy).Order(groupBy).Scan(&statistics).Error
+	return statistics, err
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func TestRollupUsage(t *testing.T) {
+	setupTestDB(t, &Log{}, &UsageRollup{}, &UsageRollupCursor{})
+	now := helper.GetTimestamp()
+	hour := now - now%usageBucketSize - 2*usageBucketSize
+	addLog := func(log Log) {
+		if err := LOG_DB.Create(&log).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	consume := func(query UsageQuery) []*UsageStatistic {
+		query.Type = LogTypeConsume
+		query.Granularity = "hour"
+		statistics, err := GetUsageStatistics(query)
+		So(err, ShouldBeNil)
+		return statistics
+	}
+
+	Convey("the first run backfills the existing logs", t, func() {
+		addLog(Log{UserId: 1, CreatedAt: hour + 10, Type: LogTypeConsume, ModelName: "gpt-4o", ChannelId: 1, TokenId: 7, GroupName: "default", PromptTokens: 10, CompletionTokens: 20, Quota: 30})
+		addLog(Log{UserId: 1, CreatedAt: hour + 20, Type: LogTypeConsume, ModelName: "gpt-4o", ChannelId: 1, TokenId: 7, GroupName: "default", PromptTokens: 1, CompletionTokens: 2, Quota: 3})
+		addLog(Log{UserId: 1, CreatedAt: hour + 30, Type: LogTypeTopup, Quota: 1000})
+		// too recent, left to the next run
+		addLog(Log{UserId: 1, CreatedAt: now, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 5})
+		So(RollupUsage(), ShouldBeNil)
+
+		statistics := consume(UsageQuery{GroupBy: []string{"model", "token", "group"}})
+		So(statistics, ShouldHaveLength, 1)
+		So(statistics[0].Bucket, ShouldEqual, hour)
+		So(statistics[0].ModelName, ShouldEqual, "gpt-4o")
+		So(statistics[0].TokenId, ShouldEqual, 7)
+		So(statistics[0].GroupName, ShouldEqual, "default")
+		So(statistics[0].Requests, ShouldEqual, 2)
+		So(statistics[0].PromptTokens, ShouldEqual, 11)
+		So(statistics[0].CompletionTokens, ShouldEqual, 22)
+		So(statistics[0].Quota, ShouldEqual, 33)
+
+		topups, err := GetUsageStatistics(UsageQuery{Type: LogTypeTopup, Granularity: "hour"})
+		So(err, ShouldBeNil)
+		So(topups, ShouldHaveLength, 1)
+		So(topups[0].Quota, ShouldEqual, 1000)
+	})
+	Convey("later runs only add the new logs", t, func() {
+		So(RollupUsage(), ShouldBeNil)
+		// the recent log got old enough
+		So(LOG_DB.Model(&Log{}).Where("created_at = ?", now).Updates(map[string]any{"created_at": hour + 40, "channel_id": 1, "token_id": 7, "group_name": "default"}).Error, ShouldBeNil)
+		addLog(Log{UserId: 1, CreatedAt: hour + 50, Type: LogTypeConsume, ModelName: "gpt-4o", ChannelId: 1, TokenId: 7, GroupName: "default", Quota: 7})
+		So(RollupUsage(), ShouldBeNil)
+		statistics := consume(UsageQuery{})
+		So(statistics, ShouldHaveLength, 1)
+		So(statistics[0].Requests, ShouldEqual, 4)
+		So(statistics[0].Quota, ShouldEqual, 45)
+	})
+	Convey("failed requests are added to the same rollups", t, func() {
+		stats := &RelayStats{TokenId: 7, Group: "default", ModelName: "gpt-4o"}
+		RecordUsageError(stats, 1, 1)
+		RecordUsageError(stats, 1, 1)
+		flushUsageErrors()
+		statistics := consume(UsageQuery{StartTimestamp: now - now%usageBucketSize, GroupBy: []string{"model"}})
+		So(statistics, ShouldHaveLength, 1)
+		So(statistics[0].Requests, ShouldEqual, 2)
+		So(statistics[0].Errors, ShouldEqual, 2)
+	})
+	Convey("deleted logs stay in the rollups and logs not rolled up yet are kept", t, func() {
+		before := consume(UsageQuery{EndTimestamp: hour + usageBucketSize - 1})
+		addLog(Log{UserId: 1, CreatedAt: now, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 5})
+		deleted, err := deleteLogsBefore(LogTypeUnknown, now+1, nil)
+		So(err, ShouldBeNil)
+		So(deleted, ShouldEqual, 5)
+		var remaining int64
+		LOG_DB.Model(&Log{}).Count(&remaining)
+		So(remaining, ShouldEqual, 1)
+		So(consume(UsageQuery{EndTimestamp: hour + usageBucketSize - 1}), ShouldResemble, before)
+	})
+}
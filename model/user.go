@@ -1,16 +1,20 @@
 package model
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"github.com/songquanpeng/one-api/common"
-	"github.com/songquanpeng/one-api/common/blacklist"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/message"
 	"github.com/songquanpeng/one-api/common/random"
 	"gorm.io/gorm"
+	"os"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -47,6 +51,11 @@ type User struct {
 	Group            string `json:"group" gorm:"type:varchar(32);default:'default'"`
 	AffCode          string `json:"aff_code" gorm:"type:varchar(32);column:aff_code;uniqueIndex"`
 	InviterId        int    `json:"inviter_id" gorm:"type:int;column:inviter_id;index"`
+	// the login failure fields are maintained by the system only
+	FailedLoginCount    int   `json:"failed_login_count" gorm:"type:int;default:0"`
+	LastFailedLoginTime int64 `json:"last_failed_login_time" gorm:"bigint;default:0"`
+	LockedUntil         int64 `json:"locked_until" gorm:"bigint;default:0"`
+	QuotaAllowance
 }
 
 func GetMaxUserId() int {
@@ -145,7 +154,6 @@ func (user *User) Insert(inviterId int) error {
 	cleanToken := Token{
 		UserId:         user.Id,
 		Name:           "default",
-		Key:            random.GenerateKey(),
 		CreatedTime:    helper.GetTimestamp(),
 		AccessedTime:   helper.GetTimestamp(),
 		ExpiredTime:    -1,
@@ -168,12 +176,41 @@ func (user *User) Update(updatePassword bool) error {
 			return err
 		}
 	}
-	if user.Status == UserStatusDisabled {
-		blacklist.BanUser(user.Id)
-	} else if user.Status == UserStatusEnabled {
-		blacklist.UnbanUser(user.Id)
+	statusChanged := false
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if user.Status != 0 {
+			// the status is written on its own to tell whether it changed
+			result := tx.Model(&User{}).Where("id = ? and status != ?", user.Id, user.Status).Update("status", user.Status)
+			if result.Error != nil {
+				return result.Error
+			}
+			statusChanged = result.RowsAffected > 0
+		}
+		return tx.Model(user).Updates(user).Error
+	})
+	if err == nil && statusChanged {
+		onUserStatusChanged(user.Id, user.Status)
+	}
+	return err
+}
+
+// onUserStatusChanged makes a status change of the user effective on all nodes at once
+func onUserStatusChanged(id int, status int) {
+	if common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_enabled:%d", id))
 	}
-	err = DB.Model(user).Updates(user).Error
+	if status != UserStatusEnabled {
+		err := DeleteUserSessions(id)
+		if err != nil {
+			logger.SysError("failed to delete user sessions: " + err.Error())
+		}
+	}
+}
+
+// UpdateQuotaAllowance This can update zero values, so the allowance can be turned off
+func (user *User) UpdateQuotaAllowance() error {
+	err := DB.Model(user).Select("quota_reset_period", "quota_reset_amount", "quota_reset_accrue", "quota_accrue_cap").Updates(user).Error
+	ClearUserAllowanceCheck(user.Id)
 	return err
 }
 
@@ -181,10 +218,12 @@ func (user *User) Delete() error {
 	if user.Id == 0 {
 		return errors.New("id 为空！")
 	}
-	blacklist.BanUser(user.Id)
 	user.Username = fmt.Sprintf("deleted_%s", random.GetUUID())
 	user.Status = UserStatusDeleted
 	err := DB.Model(user).Updates(user).Error
+	if err == nil {
+		onUserStatusChanged(user.Id, user.Status)
+	}
 	return err
 }
 
@@ -203,12 +242,178 @@ func (user *User) ValidateAndFill() (err error) {
 		// consider this case: a malicious user set his username as other's email
 		err := DB.Where("email = ?", user.Username).First(user).Error
 		if err != nil {
-			return errors.New("用户名或密码错误，或用户已被封禁")
+			return errors.New(InvalidLoginMessage)
 		}
 	}
+	now := helper.GetTimestamp()
+	err = user.checkLoginThrottle(now)
+	if err != nil {
+		return err
+	}
 	okay := common.ValidatePasswordAndHash(password, user.Password)
-	if !okay || user.Status != UserStatusEnabled {
-		return errors.New("用户名或密码错误，或用户已被封禁")
+	if !okay {
+		if lockedUntil := user.recordLoginFailure(now); lockedUntil != 0 {
+			return &LoginThrottledError{
+				Message: fmt.Sprintf("登录失败次数过多，账户已被临时锁定，请于 %s 后重试", time.Unix(lockedUntil, 0).Format("2006-01-02 15:04:05")),
+				Locked:  true,
+			}
+		}
+		return errors.New(InvalidLoginMessage)
+	}
+	if user.Status != UserStatusEnabled {
+		return errors.New(InvalidLoginMessage)
+	}
+	// with two-factor authentication the failures are cleared once the code is verified,
+	// otherwise logging in with the password would reset the count of wrong codes
+	if (user.FailedLoginCount != 0 || user.LockedUntil != 0) && !IsTwoFactorEnabled(user.Id) {
+		ClearLoginFailures(user.Id)
+	}
+	return nil
+}
+
+const InvalidLoginMessage = "用户名或密码错误，或用户已被封禁"
+
+const (
+	loginDelayFreeAttempts = 3  // failed logins before further attempts are slowed down
+	maxLoginDelay          = 60 // unit is second
+)
+
+// LoginThrottledError is returned when the account is locked or has to wait before the next attempt
+type LoginThrottledError struct {
+	Message string
+	Locked  bool // the account got locked by this attempt
+}
+
+func (e *LoginThrottledError) Error() string {
+	return e.Message
+}
+
+// failed logins only count within the lockout duration
+func (user *User) recentLoginFailures(now int64) int {
+	if now-user.LastFailedLoginTime > config.LoginLockoutDuration {
+		return 0
+	}
+	return user.FailedLoginCount
+}
+
+func (user *User) checkLoginThrottle(now int64) error {
+	if user.LockedUntil > now {
+		return &LoginThrottledError{
+			Message: fmt.Sprintf("登录失败次数过多，账户已被临时锁定，请于 %s 后重试", time.Unix(user.LockedUntil, 0).Format("2006-01-02 15:04:05")),
+		}
+	}
+	failures := user.recentLoginFailures(now)
+	if failures < loginDelayFreeAttempts {
+		return nil
+	}
+	// the delay doubles with every failure
+	delay := int64(maxLoginDelay)
+	if shift := failures - loginDelayFreeAttempts; shift < 6 {
+		delay = int64(1) << shift
+	}
+	if wait := user.LastFailedLoginTime + delay - now; wait > 0 {
+		return &LoginThrottledError{
+			Message: fmt.Sprintf("登录尝试过于频繁，请 %d 秒后重试", wait),
+		}
+	}
+	return nil
+}
+
+// recordLoginFailure returns the time until which the account is locked, 0 if it isn't.
+// The failure is counted in sql, so parallel attempts can't overwrite each other's count.
+func (user *User) recordLoginFailure(now int64) int64 {
+	// gorm sorts the columns, so failed_login_count is computed with the old last_failed_login_time,
+	// a failure outside of the lockout duration starts the count again
+	err := DB.Model(&User{}).Where("id = ?", user.Id).Updates(map[string]any{
+		"failed_login_count":     gorm.Expr("CASE WHEN last_failed_login_time < ? THEN 1 ELSE failed_login_count + 1 END", now-config.LoginLockoutDuration),
+		"last_failed_login_time": now,
+	}).Error
+	if err != nil {
+		logger.SysError("failed to record login failure: " + err.Error())
+		return 0
+	}
+	var failures int
+	err = DB.Model(&User{}).Where("id = ?", user.Id).Select("failed_login_count").Scan(&failures).Error
+	if err != nil {
+		logger.SysError("failed to get login failures: " + err.Error())
+		return 0
+	}
+	if config.LoginLockoutThreshold <= 0 || failures < config.LoginLockoutThreshold {
+		return 0
+	}
+	lockedUntil := now + config.LoginLockoutDuration
+	// only one of the parallel attempts reaching the threshold locks the account and notifies
+	result := DB.Model(&User{}).Where("id = ? and locked_until < ?", user.Id, now).Updates(map[string]any{
+		"failed_login_count": 0,
+		"locked_until":       lockedUntil,
+	})
+	if result.Error != nil {
+		logger.SysError("failed to lock user: " + result.Error.Error())
+		return 0
+	}
+	if result.RowsAffected == 0 {
+		return 0
+	}
+	notifyAccountLocked(user.Id, user.Email, lockedUntil)
+	return lockedUntil
+}
+
+func notifyAccountLocked(userId int, email string, lockedUntil int64) {
+	content := fmt.Sprintf("由于多次登录失败，您的账户已被临时锁定至 %s，如非本人操作，请及时修改密码", time.Unix(lockedUntil, 0).Format("2006-01-02 15:04:05"))
+	RecordLog(userId, LogTypeSystem, content)
+	if email == "" {
+		return
+	}
+	go func() {
+		err := message.SendEmail(fmt.Sprintf("%s账户已被临时锁定", config.SystemName), email, content)
+		if err != nil {
+			logger.SysError("failed to send email: " + err.Error())
+		}
+	}()
+}
+
+func ClearLoginFailures(id int) {
+	err := DB.Model(&User{}).Where("id = ?", id).Updates(map[string]any{
+		"failed_login_count":     0,
+		"last_failed_login_time": 0,
+		"locked_until":           0,
+	}).Error
+	if err != nil {
+		logger.SysError("failed to clear login failures: " + err.Error())
+	}
+}
+
+var breachedPasswords = make(map[string]struct{})
+
+// LoadBreachedPasswords reads a list of leaked passwords, one per line, which can't be used as passwords
+func LoadBreachedPasswords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	passwords := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		password := strings.TrimSpace(scanner.Text())
+		if password != "" {
+			passwords[password] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	breachedPasswords = passwords
+	logger.SysLogf("loaded %d breached passwords", len(passwords))
+	return nil
+}
+
+func ValidatePasswordPolicy(password string) error {
+	if utf8.RuneCountInString(password) < config.PasswordMinLength {
+		return fmt.Errorf("密码长度不能少于 %d 位", config.PasswordMinLength)
+	}
+	if _, ok := breachedPasswords[password]; ok {
+		return errors.New("该密码已出现在泄露密码库中，请更换密码")
 	}
 	return nil
 }
@@ -355,6 +560,18 @@ func GetUserGroup(id int) (group string, err error) {
 	return group, err
 }
 
+// UpdateUserGroup only writes the group, so quotas changed meanwhile by billing are kept
+func UpdateUserGroup(id int, group string) error {
+	err := DB.Model(&User{}).Where("id = ?", id).Update("group", group).Error
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_group:%d", id))
+	}
+	return nil
+}
+
 func IncreaseUserQuota(id int, quota int64) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
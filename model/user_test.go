@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestRecordLoginFailure(t *testing.T) {
+	setupTestDB(t, &User{}, &Log{})
+	config.LoginLockoutThreshold = 3
+	config.LoginLockoutDuration = 900
+	user := User{Username: "alice", Password: "12345678"}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	reload := func() User {
+		var u User
+		DB.First(&u, user.Id)
+		return u
+	}
+	Convey("failures are counted in the database and lock the account at the threshold", t, func() {
+		now := int64(100000)
+		// the loaded struct is stale, as it is for parallel attempts
+		So(user.recordLoginFailure(now), ShouldEqual, 0)
+		So(user.recordLoginFailure(now), ShouldEqual, 0)
+		So(reload().FailedLoginCount, ShouldEqual, 2)
+		So(user.recordLoginFailure(now+1), ShouldEqual, now+1+900)
+		So(reload().LockedUntil, ShouldEqual, now+1+900)
+		So(reload().FailedLoginCount, ShouldEqual, 0)
+	})
+	Convey("a failure after the lockout duration starts the count again", t, func() {
+		now := int64(200000)
+		So(user.recordLoginFailure(now), ShouldEqual, 0)
+		So(user.recordLoginFailure(now+1), ShouldEqual, 0)
+		So(user.recordLoginFailure(now+2000), ShouldEqual, 0)
+		So(reload().FailedLoginCount, ShouldEqual, 1)
+	})
+}
+
+func TestUserUpdateStatus(t *testing.T) {
+	setupTestDB(t, &User{}, &Session{}, &Ban{})
+	user := User{Username: "alice", Password: "12345678", Status: UserStatusEnabled}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	countSessions := func() int64 {
+		var count int64
+		DB.Model(&Session{}).Where("user_id = ?", user.Id).Count(&count)
+		return count
+	}
+	Convey("an update keeping the status leaves the sessions alone", t, func() {
+		_, err := CreateSession(user.Id, "127.0.0.1", "test")
+		So(err, ShouldBeNil)
+		So((&User{Id: user.Id, DisplayName: "Alice", Status: UserStatusEnabled}).Update(false), ShouldBeNil)
+		So(countSessions(), ShouldEqual, 1)
+	})
+	Convey("disabling the user deletes the sessions, without listing the user as banned", t, func() {
+		So((&User{Id: user.Id, Status: UserStatusDisabled}).Update(false), ShouldBeNil)
+		So(countSessions(), ShouldEqual, 0)
+		So(LoadBans(), ShouldBeNil)
+		So(blacklist.IsUserBanned(user.Id), ShouldBeFalse)
+	})
+}
@@ -2,13 +2,17 @@ package monitor
 
 import (
 	"github.com/songquanpeng/one-api/common/config"
+	"sync"
 )
 
 var store = make(map[int][]bool)
+var storeMutex sync.Mutex
 var metricSuccessChan = make(chan int, config.MetricSuccessChanSize)
 var metricFailChan = make(chan int, config.MetricFailChanSize)
 
 func consumeSuccess(channelId int) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
 	if len(store[channelId]) > config.MetricQueueSize {
 		store[channelId] = store[channelId][1:]
 	}
@@ -16,6 +20,8 @@ func consumeSuccess(channelId int) {
 }
 
 func consumeFail(channelId int) (bool, float64) {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
 	if len(store[channelId]) > config.MetricQueueSize {
 		store[channelId] = store[channelId][1:]
 	}
@@ -65,6 +71,26 @@ func init() {
 	}
 }
 
+// SuccessRates returns the recent success rate of the channels having metrics
+func SuccessRates() map[int]float64 {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	rates := make(map[int]float64, len(store))
+	for channelId, results := range store {
+		if len(results) == 0 {
+			continue
+		}
+		successCount := 0
+		for _, success := range results {
+			if success {
+				successCount++
+			}
+		}
+		rates[channelId] = float64(successCount) / float64(len(results))
+	}
+	return rates
+}
+
 func Emit(channelId int, success bool) {
 	if !config.EnableMetric {
 		return
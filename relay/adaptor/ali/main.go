@@ -199,7 +199,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 	}()
 	common.SetEventStreamHeaders(c)
 	//lastResponseText := ""
-	c.Stream(func(w io.Writer) bool {
+	clientGone := c.Stream(func(w io.Writer) bool {
 		select {
 		case data := <-dataChan:
 			var aliResponse ChatResponse
@@ -231,6 +231,9 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			return false
 		}
 	})
+	if clientGone {
+		common.DrainStream(dataChan, stopChan)
+	}
 	err := resp.Body.Close()
 	if err != nil {
 		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
@@ -179,10 +179,10 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 			c.Render(-1, common.CustomEvent{Data: "data: " + string(jsonStr)})
 			return true
 		case *types.UnknownUnionMember:
-			fmt.Println("unknown tag:", v.Tag)
+			logger.SysError("unknown tag: " + v.Tag)
 			return false
 		default:
-			fmt.Println("union is nil or unknown type")
+			logger.SysError("union is nil or unknown type")
 			return false
 		}
 	})
@@ -93,7 +93,7 @@ func StreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelN
 	id := helper.GetResponseID(c)
 	responseModel := c.GetString("original_model")
 	var responseText string
-	c.Stream(func(w io.Writer) bool {
+	clientGone := c.Stream(func(w io.Writer) bool {
 		select {
 		case data := <-dataChan:
 			// some implementations may add \r at the end of data
@@ -123,6 +123,9 @@ func StreamHandler(c *gin.Context, resp *http.Response, promptTokens int, modelN
 			return false
 		}
 	})
+	if clientGone {
+		common.DrainStream(dataChan, stopChan)
+	}
 	_ = resp.Body.Close()
 	usage := openai.ResponseText2Usage(responseText, responseModel, promptTokens)
 	return nil, usage
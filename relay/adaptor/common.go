@@ -14,7 +14,9 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/relay/meta"
 )
@@ -91,7 +93,8 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
     }
 
  
-	req, err := http.NewRequest(c.Request.Method, fullRequestURL, newRequestBody)
+	// bind the upstream request to the client request, so it is cancelled once the client disconnects
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, fullRequestURL, newRequestBody)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
@@ -109,14 +112,14 @@ func DoRequestHelper(a Adaptor, c *gin.Context, meta *meta.Meta, requestBody io.
 
     if isStream {
         // ss调用109行的DoRequestStream
-        fmt.Printf("未修改请求的isStream的值为%v，代表原始请求要求流响应\n", isStream)
+        logger.Debugf(c.Request.Context(), "client requested a stream response")
         // fmt.Printf("common.go67 DoRequestStream调用开始\n")
         resp, err = DoRequestStream(meta.ActualModelName, c, req)
         if err != nil {
             return nil, fmt.Errorf("do request failed: %w", err)
         }
     }else{
-        fmt.Printf("未修改请求的isStream的值为%v，代表原始请求不要求流响应\n", isStream)
+        logger.Debugf(c.Request.Context(), "client requested a blocking response")
         // fmt.Printf("common.go67 DoRequestBlock调用开始\n")
         resp, err = DoRequestBlock(meta.ActualModelName, c, req)
         if err != nil {
@@ -166,12 +169,6 @@ func DoRequestStream(modelnameN string, c *gin.Context, req *http.Request) (*htt
         return nil, err
     }
 
-    responseData, err := io.ReadAll(resp.Body)
-    if err != nil {
-        return nil, err
-    }
-    resp.Body = io.NopCloser(bytes.NewReader(responseData))
-
     c.Writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
     c.Writer.Header().Set("Cache-Control", "no-cache")
     c.Writer.Header().Set("Connection", "keep-alive")
@@ -188,10 +185,14 @@ func DoRequestStream(modelnameN string, c *gin.Context, req *http.Request) (*htt
     systemFingerprint := "fp_06737a9306"
 
     isFirstChunk := true
+    // 已推送给客户端的内容, 客户端中途断开时按此计费
+    var deliveredText strings.Builder
 
     for {
         var event, data string
+        scanned := false
         for scanner.Scan() {
+            scanned = true
             line := scanner.Text()
             if line == "" {
                 break // 一个事件块结束
@@ -203,6 +204,12 @@ func DoRequestStream(modelnameN string, c *gin.Context, req *http.Request) (*htt
             }
         }
 
+        if !scanned {
+            break // 上游已结束或请求已被取消
+        }
+        if common.IsClientGone(c) {
+            break // 客户端已断开, 停止转发
+        }
         if event == "" && data == "" {
             continue
         }
@@ -289,13 +296,21 @@ func DoRequestStream(modelnameN string, c *gin.Context, req *http.Request) (*htt
 
         sendChunk(c.Writer, chunk)
         flusher.Flush()
+        if chunk.Choices[0].Delta.Content != nil {
+            deliveredText.WriteString(*chunk.Choices[0].Delta.Content)
+        }
     }
 
-    // 发送[DONE]
-    fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
-    flusher.Flush()
+    if !common.IsClientGone(c) {
+        // 发送[DONE]
+        fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
+        flusher.Flush()
+    }
+    c.Set(ctxkey.ResponseText, deliveredText.String())
 
     resp.Body.Close()
+    // 上游内容已经全部转发, 后续的 DoResponse 只需处理空的响应体
+    resp.Body = io.NopCloser(bytes.NewReader(nil))
     return resp, nil
 }
 
@@ -384,7 +399,7 @@ func DoRequestBlock(modelnameN string, c *gin.Context, req *http.Request) (*http
 		data: "stop"
 		// */
 		responseBody, err := io.ReadAll(resp.Body)
-        fmt.Printf("DoRequestBlock的正常lobe的responseBody: \n%s\n", responseBody)
+        logger.Debugf(c.Request.Context(), "upstream response body: %d bytes", len(responseBody))
         if err != nil {
             return nil, fmt.Errorf("read_response_body_failed: %v", err)
         }
@@ -417,7 +432,7 @@ func DoRequestBlock(modelnameN string, c *gin.Context, req *http.Request) (*http
                 // 使用json.Unmarshal安全地处理JSON转义字符，得到真正含换行符的数据
                 err := json.Unmarshal([]byte(content), &extractedData)
                 if err != nil {
-                    fmt.Println("JSON解码错误:", err)
+                    logger.Warnf(c.Request.Context(), "failed to decode upstream data line: %s", err.Error())
                     continue 
                 }
 
@@ -507,9 +522,9 @@ func DoRequestBlock(modelnameN string, c *gin.Context, req *http.Request) (*http
         finalJSON, err := json.Marshal(res)
         if err != nil {
             // 若 marshal 失败，可作相应处理
-            fmt.Printf("marshal result failed: %v\n", err)
+            logger.Errorf(c.Request.Context(), "marshal result failed: %s", err.Error())
         } else {
-			fmt.Printf("机器人的回答extractedDataextractedDataextractedData: %s\n", extractedData)
+			logger.Debugf(c.Request.Context(), "extracted answer: %d bytes", len(extractedData))
 
 
             // fmt.Printf("构造完choice后的Final JSON: %s\n", finalJSON)
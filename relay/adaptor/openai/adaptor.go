@@ -1,7 +1,9 @@
 package openai
 
 import (
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/env"
+	"github.com/songquanpeng/one-api/common/logger"
 	"errors"
 	"fmt"
 	"log"
@@ -84,7 +86,7 @@ func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *me
 	// lobeAccessCode校验jwt
 
 	req.Header.Set("X-lobe-chat-auth", Xlobechatauth)
-	fmt.Printf("X-lobe-chat-auth: %v\n", Xlobechatauth)
+	logger.Debugf(c.Request.Context(), "X-lobe-chat-auth: %s", Xlobechatauth)
 
 	// fmt.Printf("req.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Headerreq.Header,\n")
 	// fmt.Printf("req.Header: %v\n", req.Header)
@@ -123,6 +125,10 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *meta.Met
 		// fmt.Printf("contentType为？%s判断为流式判断为流式判断为流式判断为流式判断为流式\n", contentType)
 		var responseText string
 		err, responseText, usage = StreamHandler(c, resp, meta.Mode)
+		if responseText == "" {
+			// the content may have been forwarded to the client while doing the request
+			responseText = c.GetString(ctxkey.ResponseText)
+		}
 
 
 		if usage == nil || usage.TotalTokens == 0 {
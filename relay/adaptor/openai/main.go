@@ -88,7 +88,7 @@ func StreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*model.E
 		stopChan <- true
 	}()
 	common.SetEventStreamHeaders(c)
-	c.Stream(func(w io.Writer) bool {
+	clientGone := c.Stream(func(w io.Writer) bool {
 		select {
 		case data := <-dataChan:
 			if strings.HasPrefix(data, "data: [DONE]") {
@@ -102,6 +102,9 @@ func StreamHandler(c *gin.Context, resp *http.Response, relayMode int) (*model.E
 			return false
 		}
 	})
+	if clientGone {
+		common.DrainStream(dataChan, stopChan)
+	}
 	err := resp.Body.Close()
 	if err != nil {
 		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), "", nil
@@ -0,0 +1,64 @@
+package billing
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	completionStatsAlpha      = 0.1 // weight of the newest sample
+	completionStatsMinSamples = 5   // don't trust the history before this many samples
+)
+
+// completionStats keeps exponential moving averages of the completion tokens of a model
+type completionStats struct {
+	samples   int
+	mean      float64
+	deviation float64
+}
+
+func (s *completionStats) add(tokens int) {
+	s.samples++
+	if s.samples == 1 {
+		s.mean = float64(tokens)
+		return
+	}
+	diff := float64(tokens) - s.mean
+	s.mean += completionStatsAlpha * diff
+	s.deviation += completionStatsAlpha * (math.Abs(diff) - s.deviation)
+}
+
+// estimate returns a pessimistic estimate which covers most of the completions, 0 means no enough history
+func (s *completionStats) estimate() int64 {
+	if s.samples < completionStatsMinSamples {
+		return 0
+	}
+	return int64(math.Ceil(s.mean + 2*s.deviation))
+}
+
+var completionStatsMap = make(map[string]*completionStats)
+var completionStatsLock sync.Mutex
+
+// RecordCompletionTokens feeds the completion tokens of a finished request into the history of the model
+func RecordCompletionTokens(modelName string, tokens int) {
+	completionStatsLock.Lock()
+	defer completionStatsLock.Unlock()
+	stats, ok := completionStatsMap[modelName]
+	if !ok {
+		stats = &completionStats{}
+		completionStatsMap[modelName] = stats
+	}
+	stats.add(tokens)
+}
+
+// EstimateCompletionTokens estimates the completion tokens of the next request of the model
+// from the history of this node, 0 means there is no enough history
+func EstimateCompletionTokens(modelName string) int64 {
+	completionStatsLock.Lock()
+	defer completionStatsLock.Unlock()
+	stats, ok := completionStatsMap[modelName]
+	if !ok {
+		return 0
+	}
+	return stats.estimate()
+}
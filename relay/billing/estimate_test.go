@@ -0,0 +1,32 @@
+package billing
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCompletionStats(t *testing.T) {
+	Convey("completion stats", t, func() {
+		Convey("no estimate before enough samples", func() {
+			stats := &completionStats{}
+			for i := 0; i < completionStatsMinSamples-1; i++ {
+				stats.add(100)
+			}
+			So(stats.estimate(), ShouldEqual, 0)
+			stats.add(100)
+			So(stats.estimate(), ShouldEqual, 100)
+		})
+		Convey("estimate covers the variance", func() {
+			stats := &completionStats{}
+			for i := 0; i < 50; i++ {
+				if i%2 == 0 {
+					stats.add(100)
+				} else {
+					stats.add(300)
+				}
+			}
+			So(stats.estimate(), ShouldBeGreaterThan, 250)
+			So(stats.estimate(), ShouldBeLessThan, 500)
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package ratio
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// ModelMaxOutputTokens is the max output tokens of each model, it's used to bound the
+// pre-consumption estimate when the request has no max_tokens, keys are matched by prefix
+var ModelMaxOutputTokens = map[string]int{
+	"gpt-3.5-turbo":     4096,
+	"gpt-4":             8192,
+	"gpt-4-32k":         32768,
+	"gpt-4-turbo":       4096,
+	"gpt-4-1106":        4096,
+	"gpt-4-0125":        4096,
+	"gpt-4-vision":      4096,
+	"gpt-4o":            4096,
+	"claude-2":          4096,
+	"claude-3":          4096,
+	"claude-3-5-sonnet": 8192,
+	"gemini-pro":        8192,
+	"gemini-1.5":        8192,
+	"deepseek-chat":     8192,
+	"deepseek-coder":    8192,
+	"moonshot-v1-8k":    8192,
+	"moonshot-v1-32k":   32768,
+	"moonshot-v1-128k":  131072,
+	"qwen-turbo":        1500,
+	"qwen-plus":         2000,
+	"qwen-max":          2000,
+	"glm-4":             4096,
+}
+
+func ModelMaxOutputTokens2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelMaxOutputTokens)
+	if err != nil {
+		logger.SysError("error marshalling model max output tokens: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelMaxOutputTokensByJSONString(jsonStr string) error {
+	ModelMaxOutputTokens = make(map[string]int)
+	return json.Unmarshal([]byte(jsonStr), &ModelMaxOutputTokens)
+}
+
+// GetMaxOutputTokens returns the max output tokens of the longest matching prefix, 0 means unknown
+func GetMaxOutputTokens(name string) int {
+	if maxTokens, ok := ModelMaxOutputTokens[name]; ok {
+		return maxTokens
+	}
+	matched := ""
+	maxTokens := 0
+	for prefix, tokens := range ModelMaxOutputTokens {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+			maxTokens = tokens
+		}
+	}
+	return maxTokens
+}
@@ -65,23 +65,25 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	default:
 		preConsumedQuota = int64(float64(config.PreConsumedQuota) * ratio)
 	}
-	userQuota, err := model.CacheGetUserQuota(ctx, userId)
-	if err != nil {
-		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
-	}
-
 	// Check if user quota is enough
-	if userQuota-preConsumedQuota < 0 {
-		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
-	}
-	err = model.CacheDecreaseUserQuota(userId, preConsumedQuota)
-	if err != nil {
-		return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+	orgId := c.GetInt(ctxkey.OrgId)
+	userQuota, reservedQuota, bizErr := reserveUserQuota(ctx, userId, orgId, preConsumedQuota)
+	if bizErr != nil {
+		return bizErr
 	}
-	if userQuota > 100*preConsumedQuota {
+	if reservedQuota > 0 && userQuota > 100*preConsumedQuota {
 		// in this case, we do not pre-consume quota
-		// because the user has enough quota
+		// because the user has enough quota, the reservation is kept instead
 		preConsumedQuota = 0
+	} else {
+		model.ReleaseUserQuota(userId, reservedQuota)
+		reservedQuota = 0
+		if orgId == 0 {
+			err := model.CacheDecreaseUserQuota(userId, preConsumedQuota)
+			if err != nil {
+				return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+			}
+		}
 	}
 	if preConsumedQuota > 0 {
 		err := model.PreConsumeTokenQuota(tokenId, preConsumedQuota)
@@ -94,6 +96,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if succeed {
 			return
 		}
+		model.ReleaseUserQuota(userId, reservedQuota)
 		if preConsumedQuota > 0 {
 			// we need to roll back the pre-consumed quota
 			defer func(ctx context.Context) {
@@ -140,7 +143,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 
 	requestBody := &bytes.Buffer{}
-	_, err = io.Copy(requestBody, c.Request.Body)
+	_, err := io.Copy(requestBody, c.Request.Body)
 	if err != nil {
 		return openai.ErrorWrapper(err, "new_request_body_failed", http.StatusInternalServerError)
 	}
@@ -168,6 +171,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	if err != nil {
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
+	model.RelayStatsFromContext(ctx).SetUpstreamStatus(resp.StatusCode)
 
 	err = req.Body.Close()
 	if err != nil {
@@ -222,7 +226,11 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	succeed = true
 	quotaDelta := quota - preConsumedQuota
 	defer func(ctx context.Context) {
-		go billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
+		ctx = model.DetachRelayStats(ctx)
+		go func() {
+			billing.PostConsumeQuota(ctx, tokenId, quotaDelta, quota, userId, channelId, modelRatio, groupRatio, audioModel, tokenName)
+			model.ReleaseUserQuota(userId, reservedQuota)
+		}()
 	}(c.Request.Context())
 
 	for k, v := range resp.Header {
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common/conv"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"strings"
+)
+
+// deliveredRecorder parses the event stream written to the client as it goes and keeps the delivered
+// text, so that a stream aborted by the client is billed by what was delivered, whichever adaptor produced it
+type deliveredRecorder struct {
+	gin.ResponseWriter
+	pending []byte // the start of a line whose end has not been written yet
+	text    strings.Builder
+}
+
+func (w *deliveredRecorder) record(data []byte) {
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		return
+	}
+	w.pending = append(w.pending, data...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.recordLine(w.pending[:i])
+		w.pending = w.pending[i+1:]
+	}
+}
+
+// recordLine adds the text of a data line of the stream
+func (w *deliveredRecorder) recordLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if string(data) == "[DONE]" {
+		return
+	}
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content any `json:"content"`
+			} `json:"delta"`
+			Text string `json:"text"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(data, &chunk) != nil {
+		return
+	}
+	for _, choice := range chunk.Choices {
+		w.text.WriteString(conv.AsString(choice.Delta.Content))
+		w.text.WriteString(choice.Text)
+	}
+}
+
+func (w *deliveredRecorder) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *deliveredRecorder) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// deliveredText returns the text of the chunks written so far
+func (w *deliveredRecorder) deliveredText() string {
+	return w.text.String()
+}
+
+// deliveredUsage makes sure an aborted stream is billed at least for the delivered text,
+// the usage of most upstreams only arrives with the last event, which the client never got
+func deliveredUsage(usage *model.Usage, deliveredText string, meta *meta.Meta) *model.Usage {
+	if usage == nil {
+		usage = &model.Usage{}
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = meta.PromptTokens
+	}
+	if delivered := openai.CountTokenText(deliveredText, meta.ActualModelName); usage.CompletionTokens < delivered {
+		usage.CompletionTokens = delivered
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestDeliveredUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	Convey("the text of the delivered chunks is recorded", t, func() {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		recorder := &deliveredRecorder{ResponseWriter: c.Writer}
+		_, _ = recorder.WriteString(`{"ignored":"not a stream"}`)
+		common.SetEventStreamHeaders(c)
+		_, _ = recorder.WriteString("data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"Hello\"}}]}\n\n")
+		// a chunk can be split over several writes
+		_, _ = recorder.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\", wor"))
+		_, _ = recorder.Write([]byte("ld\"}}]}\n\ndata: {\"choices\":[{\"text\":\"!\"}]}\n\ndata: [DONE]\n\n"))
+		So(recorder.deliveredText(), ShouldEqual, "Hello, world!")
+		// only the unfinished line is kept
+		_, _ = recorder.WriteString("data: {\"choices\":[{\"delta\":")
+		So(string(recorder.pending), ShouldEqual, "data: {\"choices\":[{\"delta\":")
+	})
+	Convey("an aborted stream is billed at least for the delivered text", t, func() {
+		// counts without the tiktoken encoders, which are not loaded in tests
+		config.ApproximateTokenEnabled = true
+		m := &meta.Meta{PromptTokens: 10, ActualModelName: "gpt-3.5-turbo"}
+		usage := deliveredUsage(nil, "Hello, world!", m)
+		So(usage.PromptTokens, ShouldEqual, 10)
+		So(usage.CompletionTokens, ShouldBeGreaterThan, 0)
+		So(usage.TotalTokens, ShouldEqual, usage.PromptTokens+usage.CompletionTokens)
+		// the upstream only reported the usage of the start of the stream
+		usage = deliveredUsage(&model.Usage{PromptTokens: 12, CompletionTokens: 1}, "Hello, world!", m)
+		So(usage.PromptTokens, ShouldEqual, 12)
+		So(usage.CompletionTokens, ShouldBeGreaterThan, 1)
+		// a complete usage is kept
+		usage = deliveredUsage(&model.Usage{PromptTokens: 12, CompletionTokens: 100}, "Hello", m)
+		So(usage.CompletionTokens, ShouldEqual, 100)
+	})
+}
@@ -8,8 +8,10 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/controller/validator"
@@ -125,45 +127,103 @@ func getPromptTokens(textRequest *relaymodel.GeneralOpenAIRequest, relayMode int
 }
 
 func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64) int64 {
-	preConsumedTokens := config.PreConsumedQuota + int64(promptTokens)
-	if textRequest.MaxTokens != 0 {
-		preConsumedTokens += int64(textRequest.MaxTokens)
+	// expect the completion to be like the recent ones of the model
+	completionTokens := billing.EstimateCompletionTokens(textRequest.Model)
+	if completionTokens == 0 {
+		completionTokens = config.PreConsumedQuota
 	}
-	return int64(float64(preConsumedTokens) * ratio)
+	// but never more than the request or the model allows
+	maxTokens := int64(textRequest.MaxTokens)
+	if maxTokens == 0 {
+		maxTokens = int64(billingratio.GetMaxOutputTokens(textRequest.Model))
+	}
+	if maxTokens > 0 && completionTokens > maxTokens {
+		completionTokens = maxTokens
+	}
+	completionRatio := billingratio.GetCompletionRatio(textRequest.Model)
+	return int64(math.Ceil((float64(promptTokens) + float64(completionTokens)*completionRatio) * ratio))
 }
 
-func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
-	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
-
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+// reserveUserQuota checks the quota of the user against the estimated quota of the request,
+// taking the other in-flight requests of the user into account, and holds it for this request.
+// The caller must release the returned reserved quota with model.ReleaseUserQuota.
+// Organization pools are not reserved, requests billed to them are always pre-consumed.
+func reserveUserQuota(ctx context.Context, userId int, orgId int, quota int64) (int64, int64, *relaymodel.ErrorWithStatusCode) {
+	if orgId != 0 {
+		err := model.CheckOrgQuota(orgId, userId, quota)
+		if err != nil {
+			return 0, 0, openai.ErrorWrapper(err, "insufficient_org_quota", http.StatusForbidden)
+		}
+		return 0, 0, nil
+	}
+	_, err := model.ApplyUserAllowance(ctx, userId)
 	if err != nil {
-		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
+		logger.Error(ctx, "apply user quota allowance failed: "+err.Error())
 	}
-	if userQuota-preConsumedQuota < 0 {
-		return preConsumedQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	userQuota, err := model.CacheGetUserQuota(ctx, userId)
+	if err != nil {
+		return 0, 0, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
-	err = model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
+	reservedQuota, err := model.ReserveUserQuota(userId, quota)
 	if err != nil {
-		return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+		return 0, 0, openai.ErrorWrapper(err, "reserve_user_quota_failed", http.StatusInternalServerError)
+	}
+	if userQuota-reservedQuota < 0 {
+		model.ReleaseUserQuota(userId, quota)
+		return 0, 0, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
-	if userQuota > 100*preConsumedQuota {
+	return userQuota, quota, nil
+}
+
+func preConsumeQuota(ctx context.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
+	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
+	userQuota, reservedQuota, bizErr := reserveUserQuota(ctx, meta.UserId, meta.OrgId, preConsumedQuota)
+	if bizErr != nil {
+		return preConsumedQuota, bizErr
+	}
+	if reservedQuota > 0 && userQuota > 100*preConsumedQuota {
 		// in this case, we do not pre-consume quota
-		// because the user has enough quota
-		preConsumedQuota = 0
+		// because the user has enough quota, the reservation is kept until post-consumption
+		// so that concurrent requests can't jointly overdraw the user
+		meta.ReservedQuota = reservedQuota
 		logger.Info(ctx, fmt.Sprintf("user %d has enough quota %d, trusted and no need to pre-consume", meta.UserId, userQuota))
+		return 0, nil
+	}
+	// the quota is deducted below, so the reservation is no longer needed
+	defer model.ReleaseUserQuota(meta.UserId, reservedQuota)
+	if meta.OrgId == 0 {
+		err := model.CacheDecreaseUserQuota(meta.UserId, preConsumedQuota)
+		if err != nil {
+			return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
+		}
 	}
 	if preConsumedQuota > 0 {
 		err := model.PreConsumeTokenQuota(meta.TokenId, preConsumedQuota)
 		if err != nil {
+			// the caller only refunds once this returns, give the cached quota back here
+			if meta.OrgId == 0 {
+				if cacheErr := model.CacheIncreaseUserQuota(meta.UserId, preConsumedQuota); cacheErr != nil {
+					logger.Error(ctx, "restore user quota cache failed: "+cacheErr.Error())
+				}
+			}
 			return preConsumedQuota, openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
 		}
 	}
 	return preConsumedQuota, nil
 }
 
-func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64) {
+// returnPreConsumedQuota gives back everything held by preConsumeQuota
+func returnPreConsumedQuota(ctx context.Context, preConsumedQuota int64, meta *meta.Meta) {
+	billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+	model.ReleaseUserQuota(meta.UserId, meta.ReservedQuota)
+}
+
+func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.Meta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, clientCancelled bool) {
+	_, span := tracing.Start(ctx, "post_consume_quota")
+	defer span.End()
 	if usage == nil {
 		logger.Error(ctx, "usage is nil, which is unexpected")
+		returnPreConsumedQuota(ctx, preConsumedQuota, meta)
 		return
 	}
 	var quota int64
@@ -180,6 +240,7 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 		// we cannot just return, because we may have to return the pre-consumed quota
 		quota = 0
 	}
+	span.SetAttributes(tracing.Int("quota.consumed", int(quota)))
 	quotaDelta := quota - preConsumedQuota
 	err := model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
 	if err != nil {
@@ -189,7 +250,14 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *meta.M
 	if err != nil {
 		logger.Error(ctx, "error update user quota cache: "+err.Error())
 	}
+	model.ReleaseUserQuota(meta.UserId, meta.ReservedQuota)
+	if totalTokens != 0 && !clientCancelled {
+		billing.RecordCompletionTokens(textRequest.Model, completionTokens)
+	}
 	logContent := fmt.Sprintf("模型倍率 %.2f，分组倍率 %.2f，补全倍率 %.2f", modelRatio, groupRatio, completionRatio)
+	if clientCancelled {
+		logContent += "，客户端中途断开（client_cancelled），仅按已输出内容计费"
+	}
 	model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, promptTokens, completionTokens, textRequest.Model, meta.TokenName, quota, logContent)
 	model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 	model.UpdateChannelUsedQuota(meta.ChannelId, quota)
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/songquanpeng/one-api/common/ctxkey"
@@ -12,6 +11,7 @@ import (
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
@@ -97,13 +97,28 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	modelRatio := billingratio.GetModelRatio(imageModel)
 	groupRatio := billingratio.GetGroupRatio(meta.Group)
 	ratio := modelRatio * groupRatio
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
-
 	quota := int64(ratio*imageCostRatio*1000) * int64(imageRequest.N)
 
-	if userQuota-quota < 0 {
-		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
+	_, reservedQuota, bizErr := reserveUserQuota(ctx, meta.UserId, meta.OrgId, quota)
+	if bizErr != nil {
+		return bizErr
 	}
+	defer model.ReleaseUserQuota(meta.UserId, reservedQuota)
+	// organization pools are charged up front, so concurrent requests can't overdraw the pool or the member limit
+	var preConsumedQuota int64
+	if meta.OrgId != 0 && quota > 0 {
+		err = model.PreConsumeTokenQuota(meta.TokenId, quota)
+		if err != nil {
+			return openai.ErrorWrapper(err, "pre_consume_token_quota_failed", http.StatusForbidden)
+		}
+		preConsumedQuota = quota
+	}
+	succeed := false
+	defer func() {
+		if !succeed {
+			billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		}
+	}()
 
 	// do request
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
@@ -111,13 +126,17 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
+	model.RelayStatsFromContext(ctx).SetUpstreamStatus(resp.StatusCode)
+	succeed = resp.StatusCode == http.StatusOK
 
 	defer func(ctx context.Context) {
 		if resp != nil && resp.StatusCode != http.StatusOK {
 			return
 		}
+		ctx = model.DetachRelayStats(ctx)
 
-		err := model.PostConsumeTokenQuota(meta.TokenId, quota)
+		// the quota of an image is known beforehand, so the pre-consumed quota is the whole charge
+		err := model.PostConsumeTokenQuota(meta.TokenId, quota-preConsumedQuota)
 		if err != nil {
 			logger.SysError("error consuming token remain quota: " + err.Error())
 		}
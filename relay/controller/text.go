@@ -5,15 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/tracing"
+	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/apitype"
-	"github.com/songquanpeng/one-api/relay/billing"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"go.opentelemetry.io/otel/codes"
 	"io"
 	"net/http"
 )
@@ -42,11 +45,25 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	// pre-consume quota
 	promptTokens := getPromptTokens(textRequest, meta.Mode)
 	meta.PromptTokens = promptTokens
+	_, preConsumeSpan := tracing.Start(ctx, "pre_consume_quota", tracing.Int("usage.prompt_tokens", promptTokens))
 	preConsumedQuota, bizErr := preConsumeQuota(ctx, textRequest, promptTokens, ratio, meta)
+	preConsumeSpan.SetAttributes(tracing.Int("quota.pre_consumed", int(preConsumedQuota)))
+	if bizErr != nil {
+		preConsumeSpan.SetStatus(codes.Error, bizErr.Message)
+	}
+	preConsumeSpan.End()
 	if bizErr != nil {
 		logger.Warnf(ctx, "preConsumeQuota failed: %+v", *bizErr)
 		return bizErr
 	}
+	succeed := false
+	defer func() {
+		if succeed {
+			return
+		}
+		// make sure nothing is held on any error path
+		returnPreConsumedQuota(ctx, preConsumedQuota, meta)
+	}()
 
 	adaptor := relay.GetAdaptor(meta.APIType)
 	if adaptor == nil {
@@ -83,7 +100,21 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 
 	// do request
 	// 开始第一次做请求
+	// records the delivered stream to bill it if the client goes away
+	recorder := &deliveredRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	defer func() {
+		c.Writer = recorder.ResponseWriter
+	}()
+	requestCtx, requestSpan := tracing.Start(ctx, "upstream_request", tracing.String("model.actual", meta.ActualModelName))
+	c.Request = c.Request.WithContext(requestCtx)
 	resp, err := adaptor.DoRequest(c, meta, requestBody)
+	c.Request = c.Request.WithContext(ctx)
+	if err != nil {
+		requestSpan.RecordError(err)
+		requestSpan.SetStatus(codes.Error, err.Error())
+	}
+	requestSpan.End()
 	// fmt.Printf("最终修改完的返回包-“relay/controller/text.go”\n： %v\n", resp.Body)
 	// fmt.Printf("此时只是把lobe的返回包修改为法定格式，但还没有做数据包返回（main.go/147-响应给客户端_, err = io.Copy(c.Writer, resp.Body)）。\n")
 
@@ -91,8 +122,8 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
 		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
 	}
+	dbmodel.RelayStatsFromContext(ctx).SetUpstreamStatus(resp.StatusCode)
 	if isErrorHappened(meta, resp) {
-		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
 		return RelayErrorHandler(resp)
 	} 
 
@@ -101,13 +132,30 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 
 	// do response  // 对返回的内容进行处理
 	// fmt.Printf("对修改后的返回包进行处理-计算usage-“relay/controller/text.go”\n")
+	_, responseSpan := tracing.Start(ctx, "upstream_response", tracing.Bool("stream", meta.IsStream))
 	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	if usage != nil {
+		responseSpan.SetAttributes(tracing.Int("usage.prompt_tokens", usage.PromptTokens), tracing.Int("usage.completion_tokens", usage.CompletionTokens))
+	}
+	if respErr != nil {
+		responseSpan.SetStatus(codes.Error, respErr.Message)
+	}
+	responseSpan.End()
+	// if the client disconnected, only bill what has been delivered
+	clientCancelled := common.IsClientGone(c)
+	if clientCancelled {
+		logger.Warnf(ctx, "client cancelled the request, billing delivered usage only")
+		usage = deliveredUsage(usage, recorder.deliveredText(), meta)
+	}
 	if respErr != nil {
 		logger.Errorf(ctx, "respErr is not nil: %+v", respErr)
-		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
-		return respErr
+		// the delivered part is still billed when the client has gone
+		if !clientCancelled {
+			return respErr
+		}
 	}
 	// post-consume quota
-	go postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio)
+	succeed = true
+	go postConsumeQuota(dbmodel.DetachRelayStats(ctx), usage, meta, textRequest, ratio, preConsumedQuota, modelRatio, groupRatio, clientCancelled)
 	return nil
 }
@@ -16,6 +16,7 @@ type Meta struct {
 	TokenId         int
 	TokenName       string
 	UserId          int
+	OrgId           int // set when the token draws from an organization pool
 	Group           string
 	ModelMapping    map[string]string
 	BaseURL         string
@@ -26,7 +27,8 @@ type Meta struct {
 	OriginModelName string
 	ActualModelName string
 	RequestURLPath  string
-	PromptTokens    int // only for DoResponse
+	PromptTokens    int   // only for DoResponse
+	ReservedQuota   int64 // quota held for the in-flight request, see preConsumeQuota
 }
 
 func GetByContext(c *gin.Context) *Meta {
@@ -37,6 +39,7 @@ func GetByContext(c *gin.Context) *Meta {
 		TokenId:         c.GetInt(ctxkey.TokenId),
 		TokenName:       c.GetString(ctxkey.TokenName),
 		UserId:          c.GetInt(ctxkey.Id),
+		OrgId:           c.GetInt(ctxkey.OrgId),
 		Group:           c.GetString(ctxkey.Group),
 		ModelMapping:    c.GetStringMapString(ctxkey.ModelMapping),
 		OriginModelName: c.GetString(ctxkey.RequestModel),
@@ -0,0 +1,31 @@
+package relaymode
+
+var names = map[int]string{
+	ChatCompletions:    "chat_completions",
+	Completions:        "completions",
+	Embeddings:         "embeddings",
+	Moderations:        "moderations",
+	ImagesGenerations:  "images_generations",
+	Edits:              "edits",
+	AudioSpeech:        "audio_speech",
+	AudioTranscription: "audio_transcription",
+	AudioTranslation:   "audio_translation",
+}
+
+// Name returns the name used to refer to the relay mode in settings, e.g. token restrictions
+func Name(mode int) string {
+	if name, ok := names[mode]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// GetByName returns Unknown if there is no relay mode with that name
+func GetByName(name string) int {
+	for mode, n := range names {
+		if n == name {
+			return mode
+		}
+	}
+	return Unknown
+}
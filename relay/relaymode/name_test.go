@@ -0,0 +1,16 @@
+package relaymode
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	Convey("relay mode names", t, func() {
+		So(len(names), ShouldEqual, AudioTranslation)
+		for mode := ChatCompletions; mode <= AudioTranslation; mode++ {
+			So(GetByName(Name(mode)), ShouldEqual, mode)
+		}
+		So(GetByName("unknown"), ShouldEqual, Unknown)
+	})
+}
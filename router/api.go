@@ -21,19 +21,24 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/home_page_content", controller.GetHomePageContent)
 		apiRouter.GET("/verification", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.SendEmailVerification)
 		apiRouter.GET("/reset_password", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.SendPasswordResetEmail)
-		apiRouter.POST("/user/reset", middleware.CriticalRateLimit(), controller.ResetPassword)
-		apiRouter.GET("/oauth/github", middleware.CriticalRateLimit(), auth.GitHubOAuth)
-		apiRouter.GET("/oauth/lark", middleware.CriticalRateLimit(), auth.LarkOAuth)
-		apiRouter.GET("/oauth/state", middleware.CriticalRateLimit(), auth.GenerateOAuthCode)
-		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), auth.WeChatAuth)
-		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), auth.WeChatBind)
-		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
+		apiRouter.POST("/user/reset", middleware.CriticalRateLimit(), middleware.IpBanCheck(), controller.ResetPassword)
+		apiRouter.GET("/oauth/github", middleware.CriticalRateLimit(), middleware.IpBanCheck(), auth.GitHubOAuth)
+		apiRouter.GET("/oauth/lark", middleware.CriticalRateLimit(), middleware.IpBanCheck(), auth.LarkOAuth)
+		apiRouter.GET("/oauth/oidc", middleware.CriticalRateLimit(), middleware.IpBanCheck(), auth.OidcOAuth)
+		apiRouter.GET("/oauth/oidc/authorize", middleware.CriticalRateLimit(), middleware.IpBanCheck(), auth.OidcAuthorize)
+		apiRouter.GET("/oauth/state", middleware.CriticalRateLimit(), middleware.IpBanCheck(), auth.GenerateOAuthCode)
+		apiRouter.GET("/oauth/wechat", middleware.CriticalRateLimit(), middleware.IpBanCheck(), auth.WeChatAuth)
+		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.IpBanCheck(), middleware.UserAuth(), auth.WeChatBind)
+		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.IpBanCheck(), middleware.UserAuth(), controller.EmailBind)
 		apiRouter.POST("/topup", middleware.AdminAuth(), controller.AdminTopUp)
 
 		userRoute := apiRouter.Group("/user")
 		{
-			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.TurnstileCheck(), controller.Register)
-			userRoute.POST("/login", middleware.CriticalRateLimit(), controller.Login)
+			userRoute.POST("/register", middleware.CriticalRateLimit(), middleware.IpBanCheck(), middleware.TurnstileCheck(), controller.Register)
+			userRoute.POST("/login", middleware.CriticalRateLimit(), middleware.IpBanCheck(), controller.Login)
+			userRoute.POST("/login/2fa", middleware.CriticalRateLimit(), middleware.IpBanCheck(), controller.LoginTwoFactor)
+			userRoute.POST("/2fa/setup", middleware.CriticalRateLimit(), middleware.IpBanCheck(), controller.SetupTwoFactor)
+			userRoute.POST("/2fa/enable", middleware.CriticalRateLimit(), middleware.IpBanCheck(), controller.EnableTwoFactor)
 			userRoute.GET("/logout", controller.Logout)
 
 			selfRoute := userRoute.Group("/")
@@ -47,6 +52,18 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
 				selfRoute.GET("/available_models", controller.GetUserAvailableModels)
+				selfRoute.GET("/self/identity", controller.GetSelfIdentities)
+				selfRoute.GET("/self/access_token", controller.GetSelfManagementTokens)
+				selfRoute.POST("/self/access_token", controller.AddManagementToken)
+				selfRoute.PUT("/self/access_token", controller.UpdateManagementToken)
+				selfRoute.DELETE("/self/access_token/:id", controller.DeleteManagementToken)
+				selfRoute.GET("/self/2fa", controller.GetSelfTwoFactor)
+				selfRoute.POST("/self/2fa/disable", middleware.CriticalRateLimit(), controller.DisableTwoFactor)
+				selfRoute.POST("/self/2fa/recovery_codes", middleware.CriticalRateLimit(), controller.RegenerateRecoveryCodes)
+				selfRoute.DELETE("/self/identity/:id", controller.DeleteSelfIdentity)
+				selfRoute.GET("/self/session", controller.GetSelfSessions)
+				selfRoute.DELETE("/self/session", controller.DeleteSelfSessions)
+				selfRoute.DELETE("/self/session/:id", controller.DeleteSelfSession)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -91,11 +108,58 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.GET("/:id", controller.GetToken)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
+			tokenRoute.POST("/:id/rotate", controller.RotateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
 		}
+		alertRoute := apiRouter.Group("/alert")
+		alertRoute.Use(middleware.UserAuth())
+		{
+			alertRoute.GET("/", controller.GetAlertRules)
+			alertRoute.POST("/", controller.AddAlertRule)
+			alertRoute.PUT("/", controller.UpdateAlertRule)
+			alertRoute.DELETE("/:id", controller.DeleteAlertRule)
+		}
+		banRoute := apiRouter.Group("/ban")
+		banRoute.Use(middleware.AdminAuth())
+		{
+			banRoute.GET("/", controller.GetBans)
+			banRoute.POST("/", controller.AddBan)
+			banRoute.DELETE("/:id", controller.DeleteBan)
+		}
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.Use(middleware.RootAuth())
+		{
+			auditRoute.GET("/", controller.GetAuditLogs)
+			auditRoute.GET("/export", controller.ExportAuditLogs)
+		}
+		captureRoute := apiRouter.Group("/capture")
+		captureRoute.Use(middleware.RootAuth())
+		{
+			captureRoute.GET("/:request_id", controller.GetPayloadCaptures)
+		}
+		orgRoute := apiRouter.Group("/org")
+		orgRoute.Use(middleware.UserAuth())
+		{
+			orgRoute.GET("/all", middleware.AdminAuth(), controller.GetAllOrganizations)
+			orgRoute.POST("/topup", middleware.AdminAuth(), controller.AdminTopUpOrganization)
+			orgRoute.GET("/", controller.GetSelfOrganizations)
+			orgRoute.POST("/", controller.AddOrganization)
+			orgRoute.PUT("/:id", controller.UpdateOrganization)
+			orgRoute.DELETE("/:id", controller.DeleteOrganization)
+			orgRoute.GET("/:id/member", controller.GetOrgMembers)
+			orgRoute.POST("/:id/member", controller.AddOrgMember)
+			orgRoute.PUT("/:id/member", controller.UpdateOrgMember)
+			orgRoute.DELETE("/:id/member/:user_id", controller.DeleteOrgMember)
+			orgRoute.POST("/:id/fund", controller.FundOrganization)
+			orgRoute.GET("/:id/log", controller.GetOrgLogs)
+		}
 		redemptionRoute := apiRouter.Group("/redemption")
 		redemptionRoute.Use(middleware.AdminAuth())
 		{
+			redemptionRoute.GET("/campaign", controller.GetAllCampaigns)
+			redemptionRoute.POST("/campaign", controller.AddCampaign)
+			redemptionRoute.PUT("/campaign", controller.UpdateCampaign)
+			redemptionRoute.DELETE("/campaign/:id", controller.DeleteCampaign)
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
 			redemptionRoute.GET("/:id", controller.GetRedemption)
@@ -106,11 +170,16 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
+		logRoute.GET("/deletion", middleware.AdminAuth(), controller.GetLogDeletion)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/statement", middleware.AdminAuth(), controller.GetUserStatement)
+		logRoute.GET("/self/statement", middleware.UserAuth(), controller.GetSelfStatement)
+		logRoute.GET("/analytics", middleware.AdminAuth(), controller.GetUsageAnalytics)
+		logRoute.GET("/self/analytics", middleware.UserAuth(), controller.GetSelfUsageAnalytics)
 		groupRoute := apiRouter.Group("/group")
 		groupRoute.Use(middleware.AdminAuth())
 		{
@@ -0,0 +1,11 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/songquanpeng/one-api/controller"
+	"github.com/songquanpeng/one-api/middleware"
+)
+
+func SetMetricsRouter(router *gin.Engine) {
+	router.GET("/metrics", middleware.MetricsAuth(), controller.Metrics)
+}
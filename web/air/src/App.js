@@ -11,6 +11,7 @@ import EditUser from './pages/User/EditUser';
 import { getLogo, getSystemName } from './helpers';
 import PasswordResetForm from './components/PasswordResetForm';
 import GitHubOAuth from './components/GitHubOAuth';
+import OidcOAuth from './components/OidcOAuth';
 import PasswordResetConfirm from './components/PasswordResetConfirm';
 import { UserContext } from './context/User';
 import Channel from './pages/Channel';
@@ -170,6 +171,14 @@ function App() {
               </Suspense>
             }
           />
+          <Route
+            path="/oauth/oidc"
+            element={
+              <Suspense fallback={<Loading></Loading>}>
+                <OidcOAuth />
+              </Suspense>
+            }
+          />
           <Route
             path="/setting"
             element={
@@ -149,7 +149,7 @@ const OperationSetting = () => {
     const res = await API.delete(`/api/log/?target_timestamp=${Date.parse(historyTimestamp) / 1000}`);
     const { success, message, data } = res.data;
     if (success) {
-      showSuccess(`${data} 条日志已清理！`);
+      showSuccess('日志清理任务已在后台开始');
       return;
     }
     showError('日志清理失败：' + message);
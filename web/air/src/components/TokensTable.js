@@ -1,24 +1,11 @@
 import React, { useEffect, useState } from 'react';
-import { API, copy, showError, showSuccess, timestamp2string } from '../helpers';
+import { API, showError, showSuccess, timestamp2string } from '../helpers';
 
 import { ITEMS_PER_PAGE } from '../constants';
 import { renderQuota } from '../helpers/render';
-import { Button, Dropdown, Form, Modal, Popconfirm, Popover, SplitButtonGroup, Table, Tag } from '@douyinfe/semi-ui';
-
-import { IconTreeTriangleDown } from '@douyinfe/semi-icons';
+import { Button, Dropdown, Form, Popconfirm, Table, Tag } from '@douyinfe/semi-ui';
 import EditToken from '../pages/Token/EditToken';
 
-const COPY_OPTIONS = [
-  { key: 'next', text: 'ChatGPT Next Web', value: 'next' },
-  { key: 'ama', text: 'ChatGPT Web & Midjourney', value: 'ama' },
-  { key: 'opencat', text: 'OpenCat', value: 'opencat' }
-];
-
-const OPEN_LINK_OPTIONS = [
-  { key: 'ama', text: 'ChatGPT Web & Midjourney', value: 'ama' },
-  { key: 'opencat', text: 'OpenCat', value: 'opencat' }
-];
-
 function renderTimestamp(timestamp) {
   return (
     <>
@@ -48,26 +35,22 @@ function renderStatus(status, model_limits_enabled = false) {
 
 const TokensTable = () => {
 
-  const link_menu = [
-    {
-      node: 'item', key: 'next', name: 'ChatGPT Next Web', onClick: () => {
-        onOpenLink('next');
-      }
-    },
-    { node: 'item', key: 'ama', name: 'AMA 问天', value: 'ama' },
-    {
-      node: 'item', key: 'next-mj', name: 'ChatGPT Web & Midjourney', value: 'next-mj', onClick: () => {
-        onOpenLink('next-mj');
-      }
-    },
-    { node: 'item', key: 'opencat', name: 'OpenCat', value: 'opencat' }
-  ];
-
   const columns = [
     {
       title: '名称',
       dataIndex: 'name'
     },
+    {
+      title: '密钥',
+      dataIndex: 'key_prefix',
+      render: (text, record, index) => {
+        return (
+          <div>
+            {`sk-${text}...`}
+          </div>
+        );
+      }
+    },
     {
       title: '状态',
       dataIndex: 'status',
@@ -130,61 +113,6 @@ const TokensTable = () => {
       dataIndex: 'operate',
       render: (text, record, index) => (
         <div>
-          <Popover
-            content={
-              'sk-' + record.key
-            }
-            style={{ padding: 20 }}
-            position="top"
-          >
-            <Button theme="light" type="tertiary" style={{ marginRight: 1 }}>查看</Button>
-          </Popover>
-          <Button theme="light" type="secondary" style={{ marginRight: 1 }}
-                  onClick={async (text) => {
-                    await copyText('sk-' + record.key);
-                  }}
-          >复制</Button>
-          <SplitButtonGroup style={{ marginRight: 1 }} aria-label="项目操作按钮组">
-            <Button theme="light" style={{ color: 'rgba(var(--semi-teal-7), 1)' }} onClick={() => {
-              onOpenLink('next', record.key);
-            }}>聊天</Button>
-            <Dropdown trigger="click" position="bottomRight" menu={
-              [
-                {
-                  node: 'item',
-                  key: 'next',
-                  disabled: !localStorage.getItem('chat_link'),
-                  name: 'ChatGPT Next Web',
-                  onClick: () => {
-                    onOpenLink('next', record.key);
-                  }
-                },
-                {
-                  node: 'item',
-                  key: 'next-mj',
-                  disabled: !localStorage.getItem('chat_link2'),
-                  name: 'ChatGPT Web & Midjourney',
-                  onClick: () => {
-                    onOpenLink('next-mj', record.key);
-                  }
-                },
-                {
-                  node: 'item', key: 'ama', name: 'AMA 问天（BotGem）', onClick: () => {
-                    onOpenLink('ama', record.key);
-                  }
-                },
-                {
-                  node: 'item', key: 'opencat', name: 'OpenCat', onClick: () => {
-                    onOpenLink('opencat', record.key);
-                  }
-                }
-              ]
-            }
-            >
-              <Button style={{ padding: '8px 4px', color: 'rgba(var(--semi-teal-7), 1)' }} type="primary"
-                      icon={<IconTreeTriangleDown />}></Button>
-            </Dropdown>
-          </SplitButtonGroup>
           <Popconfirm
             title="确定是否要删除此令牌？"
             content="此修改将不可逆"
@@ -193,7 +121,7 @@ const TokensTable = () => {
             onConfirm={() => {
               manageToken(record.id, 'delete', record).then(
                 () => {
-                  removeRecord(record.key);
+                  removeRecord(record.id);
                 }
               );
             }}
@@ -301,98 +229,6 @@ const TokensTable = () => {
     await loadTokens(activePage - 1);
   };
 
-  const onCopy = async (type, key) => {
-    let status = localStorage.getItem('status');
-    let serverAddress = '';
-    if (status) {
-      status = JSON.parse(status);
-      serverAddress = status.server_address;
-    }
-    if (serverAddress === '') {
-      serverAddress = window.location.origin;
-    }
-    let encodedServerAddress = encodeURIComponent(serverAddress);
-    const nextLink = localStorage.getItem('chat_link');
-    const mjLink = localStorage.getItem('chat_link2');
-    let nextUrl;
-
-    if (nextLink) {
-      nextUrl = nextLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-    } else {
-      nextUrl = `https://app.nextchat.dev/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-    }
-
-    let url;
-    switch (type) {
-      case 'ama':
-        url = mjLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-        break;
-      case 'opencat':
-        url = `opencat://team/join?domain=${encodedServerAddress}&token=sk-${key}`;
-        break;
-      case 'next':
-        url = nextUrl;
-        break;
-      default:
-        url = `sk-${key}`;
-    }
-    // if (await copy(url)) {
-    //     showSuccess('已复制到剪贴板！');
-    // } else {
-    //     showWarning('无法复制到剪贴板，请手动复制，已将令牌填入搜索框。');
-    //     setSearchKeyword(url);
-    // }
-  };
-
-  const copyText = async (text) => {
-    if (await copy(text)) {
-      showSuccess('已复制到剪贴板！');
-    } else {
-      // setSearchKeyword(text);
-      Modal.error({ title: '无法复制到剪贴板，请手动复制', content: text });
-    }
-  };
-
-  const onOpenLink = async (type, key) => {
-    let status = localStorage.getItem('status');
-    let serverAddress = '';
-    if (status) {
-      status = JSON.parse(status);
-      serverAddress = status.server_address;
-    }
-    if (serverAddress === '') {
-      serverAddress = window.location.origin;
-    }
-    let encodedServerAddress = encodeURIComponent(serverAddress);
-    const chatLink = localStorage.getItem('chat_link');
-    const mjLink = localStorage.getItem('chat_link2');
-    let defaultUrl;
-
-    if (chatLink) {
-      defaultUrl = chatLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-    }
-    let url;
-    switch (type) {
-      case 'ama':
-        url = `ama://set-api-key?server=${encodedServerAddress}&key=sk-${key}`;
-        break;
-      case 'opencat':
-        url = `opencat://team/join?domain=${encodedServerAddress}&token=sk-${key}`;
-        break;
-      case 'next-mj':
-        url = mjLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
-        break;
-      default:
-        if (!chatLink) {
-          showError('管理员未设置聊天链接');
-          return;
-        }
-        url = defaultUrl;
-    }
-
-    window.open(url, '_blank');
-  };
-
   useEffect(() => {
     loadTokens(0, orderBy)
       .then()
@@ -401,10 +237,10 @@ const TokensTable = () => {
       });
   }, [pageSize, orderBy]);
 
-  const removeRecord = key => {
+  const removeRecord = id => {
     let newDataSource = [...tokens];
-    if (key != null) {
-      let idx = newDataSource.findIndex(data => data.key === key);
+    if (id != null) {
+      let idx = newDataSource.findIndex(data => data.id === id);
 
       if (idx > -1) {
         newDataSource.splice(idx, 1);
@@ -586,19 +422,6 @@ const TokensTable = () => {
           setShowEdit(true);
         }
       }>添加令牌</Button>
-      <Button label="复制所选令牌" type="warning" onClick={
-        async () => {
-          if (selectedKeys.length === 0) {
-            showError('请至少选择一个令牌！');
-            return;
-          }
-          let keys = '';
-          for (let i = 0; i < selectedKeys.length; i++) {
-            keys += selectedKeys[i].name + '    sk-' + selectedKeys[i].key + '\n';
-          }
-          await copyText(keys);
-        }
-      }>复制所选令牌到剪贴板</Button>
       <Dropdown
         trigger="click"
         position="bottomLeft"
@@ -184,7 +184,7 @@ const OperationSetting = () => {
     );
     const { success, message, data } = res.data;
     if (success) {
-      showSuccess(`${data} 条日志已清理！`);
+      showSuccess("日志清理任务已在后台开始");
       return;
     }
     showError("日志清理失败：" + message);
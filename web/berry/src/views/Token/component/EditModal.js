@@ -70,16 +70,16 @@ const EditModal = ({ open, tokenId, onCancel, onOk }) => {
     } else {
       res = await API.post(`/api/token/`, { ...values, models: models });
     }
-    const { success, message } = res.data;
+    const { success, message, data } = res.data;
     if (success) {
       if (values.is_edit) {
         showSuccess('令牌更新成功！');
       } else {
-        showSuccess('令牌创建成功，请在列表页面点击复制获取令牌！');
+        showSuccess('令牌创建成功！');
       }
       setSubmitting(false);
       setStatus({ success: true });
-      onOk(true);
+      onOk(true, values.is_edit ? '' : data.key);
     } else {
       showError(message);
       setErrors({ submit: message });
@@ -0,0 +1,36 @@
+import PropTypes from 'prop-types';
+import { useSelector } from 'react-redux';
+
+import { Alert, Button, Dialog, DialogActions, DialogContent, DialogTitle, Typography } from '@mui/material';
+import { copy } from 'utils/common';
+
+// KeyDialog shows the key of a new token, it's only returned once when the token is created
+export default function KeyDialog({ tokenKey, onClose }) {
+  const siteInfo = useSelector((state) => state.siteInfo);
+
+  const handleChat = () => {
+    let serverAddress = siteInfo?.server_address ? siteInfo.server_address : window.location.host;
+    let chatLink = siteInfo?.chat_link ? siteInfo.chat_link : 'https://app.nextchat.dev';
+    window.open(chatLink + `/#/?settings={"key":"sk-${tokenKey}","url":"${serverAddress}"}`);
+  };
+
+  return (
+    <Dialog open={!!tokenKey} onClose={onClose} fullWidth maxWidth={'sm'}>
+      <DialogTitle>令牌已创建</DialogTitle>
+      <DialogContent>
+        <Alert severity="warning">密钥只显示这一次，请立即复制保存</Alert>
+        <Typography sx={{ mt: 2, wordBreak: 'break-all' }}>{`sk-${tokenKey}`}</Typography>
+      </DialogContent>
+      <DialogActions>
+        <Button onClick={() => copy(`sk-${tokenKey}`, '密钥')}>复制</Button>
+        <Button onClick={handleChat}>聊天</Button>
+        <Button onClick={onClose}>关闭</Button>
+      </DialogActions>
+    </Dialog>
+  );
+}
+
+KeyDialog.propTypes = {
+  tokenKey: PropTypes.string,
+  onClose: PropTypes.func
+};
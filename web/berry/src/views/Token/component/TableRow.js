@@ -1,6 +1,5 @@
 import PropTypes from 'prop-types';
 import { useState } from 'react';
-import { useSelector } from 'react-redux';
 
 import {
   Popover,
@@ -15,29 +14,13 @@ import {
   DialogTitle,
   Button,
   Tooltip,
-  Stack,
-  ButtonGroup
+  Stack
 } from '@mui/material';
 
 import TableSwitch from 'ui-component/Switch';
-import { renderQuota, timestamp2string, copy } from 'utils/common';
+import { renderQuota, timestamp2string } from 'utils/common';
 
-import { IconDotsVertical, IconEdit, IconTrash, IconCaretDownFilled } from '@tabler/icons-react';
-
-const COPY_OPTIONS = [
-  {
-    key: 'next',
-    text: 'ChatGPT Next',
-    url: 'https://app.nextchat.dev/#/?settings={"key":"sk-{key}","url":"{serverAddress}"}',
-    encode: false
-  },
-  { key: 'ama', text: 'BotGem', url: 'ama://set-api-key?server={serverAddress}&key=sk-{key}', encode: true },
-  { key: 'opencat', text: 'OpenCat', url: 'opencat://team/join?domain={serverAddress}&token=sk-{key}', encode: true }
-];
-
-function replacePlaceholders(text, key, serverAddress) {
-  return text.replace('{key}', key).replace('{serverAddress}', serverAddress);
-}
+import { IconDotsVertical, IconEdit, IconTrash } from '@tabler/icons-react';
 
 function createMenu(menuItems) {
   return (
@@ -57,7 +40,6 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
   const [menuItems, setMenuItems] = useState(null);
   const [openDelete, setOpenDelete] = useState(false);
   const [statusSwitch, setStatusSwitch] = useState(item.status);
-  const siteInfo = useSelector((state) => state.siteInfo);
 
   const handleDeleteOpen = () => {
     handleCloseMenu();
@@ -68,17 +50,8 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
     setOpenDelete(false);
   };
 
-  const handleOpenMenu = (event, type) => {
-    switch (type) {
-      case 'copy':
-        setMenuItems(copyItems);
-        break;
-      case 'link':
-        setMenuItems(linkItems);
-        break;
-      default:
-        setMenuItems(actionItems);
-    }
+  const handleOpenMenu = (event) => {
+    setMenuItems(actionItems);
     setOpen(event.currentTarget);
   };
 
@@ -118,57 +91,13 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
     }
   ]);
 
-  const handleCopy = (option, type) => {
-    let serverAddress = '';
-    if (siteInfo?.server_address) {
-      serverAddress = siteInfo.server_address;
-    } else {
-      serverAddress = window.location.host;
-    }
-
-    if (option.encode) {
-      serverAddress = encodeURIComponent(serverAddress);
-    }
-
-    let url = option.url;
-
-    if (option.key === 'next' && siteInfo?.chat_link) {
-      url = siteInfo.chat_link + `/#/?settings={"key":"sk-{key}","url":"{serverAddress}"}`;
-    }
-
-    const key = item.key;
-    const text = replacePlaceholders(url, key, serverAddress);
-    if (type === 'link') {
-      window.open(text);
-    } else {
-      copy(text);
-    }
-    handleCloseMenu();
-  };
-
-  const copyItems = createMenu(
-    COPY_OPTIONS.map((option) => ({
-      text: option.text,
-      icon: undefined,
-      onClick: () => handleCopy(option, 'copy'),
-      color: undefined
-    }))
-  );
-
-  const linkItems = createMenu(
-    COPY_OPTIONS.map((option) => ({
-      text: option.text,
-      icon: undefined,
-      onClick: () => handleCopy(option, 'link'),
-      color: undefined
-    }))
-  );
-
   return (
     <>
       <TableRow tabIndex={item.id}>
         <TableCell>{item.name}</TableCell>
 
+        <TableCell>{`sk-${item.key_prefix}...`}</TableCell>
+
         <TableCell>
           <Tooltip
             title={(() => {
@@ -206,28 +135,7 @@ export default function TokensTableRow({ item, manageToken, handleOpenModal, set
 
         <TableCell>
           <Stack direction="row" spacing={1}>
-            <ButtonGroup size="small" aria-label="split button">
-              <Button
-                color="primary"
-                onClick={() => {
-                  copy(`sk-${item.key}`);
-                }}
-              >
-                复制
-              </Button>
-              <Button size="small" onClick={(e) => handleOpenMenu(e, 'copy')}>
-                <IconCaretDownFilled size={'16px'} />
-              </Button>
-            </ButtonGroup>
-            <ButtonGroup size="small" aria-label="split button">
-              <Button color="primary" onClick={(e) => handleCopy(COPY_OPTIONS[0], 'link')}>
-                聊天
-              </Button>
-              <Button size="small" onClick={(e) => handleOpenMenu(e, 'link')}>
-                <IconCaretDownFilled size={'16px'} />
-              </Button>
-            </ButtonGroup>
-            <IconButton onClick={(e) => handleOpenMenu(e, 'action')} sx={{ color: 'rgb(99, 115, 129)' }}>
+            <IconButton onClick={handleOpenMenu} sx={{ color: 'rgb(99, 115, 129)' }}>
               <IconDotsVertical />
             </IconButton>
           </Stack>
@@ -25,6 +25,7 @@ import TopUp from './pages/TopUp';
 import Log from './pages/Log';
 import Chat from './pages/Chat';
 import LarkOAuth from './components/LarkOAuth';
+import OidcOAuth from './components/OidcOAuth';
 
 const Home = lazy(() => import('./pages/Home'));
 const About = lazy(() => import('./pages/About'));
@@ -248,6 +249,14 @@ function App() {
           </Suspense>
         }
       />
+      <Route
+        path='/oauth/oidc'
+        element={
+          <Suspense fallback={<Loading></Loading>}>
+            <OidcOAuth />
+          </Suspense>
+        }
+      />
       <Route
         path='/setting'
         element={
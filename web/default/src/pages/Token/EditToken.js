@@ -1,9 +1,51 @@
 import React, { useEffect, useState } from 'react';
-import { Button, Form, Header, Message, Segment } from 'semantic-ui-react';
+import { Button, Dropdown, Form, Header, Message, Segment } from 'semantic-ui-react';
 import { useNavigate, useParams } from 'react-router-dom';
-import { API, copy, showError, showSuccess, timestamp2string } from '../../helpers';
+import { API, copy, showError, showSuccess, showWarning, timestamp2string } from '../../helpers';
 import { renderQuotaWithPrompt } from '../../helpers/render';
 
+const COPY_OPTIONS = [
+  { key: 'next', text: 'ChatGPT Next Web', value: 'next' },
+  { key: 'ama', text: 'BotGem', value: 'ama' },
+  { key: 'opencat', text: 'OpenCat', value: 'opencat' },
+];
+
+const OPEN_LINK_OPTIONS = [
+  { key: 'next', text: 'ChatGPT Next Web', value: 'next' },
+  { key: 'ama', text: 'BotGem', value: 'ama' },
+  { key: 'opencat', text: 'OpenCat', value: 'opencat' },
+];
+
+const getKeyUrl = (type, key) => {
+  let status = localStorage.getItem('status');
+  let serverAddress = '';
+  if (status) {
+    status = JSON.parse(status);
+    serverAddress = status.server_address;
+  }
+  if (serverAddress === '') {
+    serverAddress = window.location.origin;
+  }
+  let encodedServerAddress = encodeURIComponent(serverAddress);
+  const chatLink = localStorage.getItem('chat_link');
+  let nextUrl;
+  if (chatLink) {
+    nextUrl = chatLink + `/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
+  } else {
+    nextUrl = `https://app.nextchat.dev/#/?settings={"key":"sk-${key}","url":"${serverAddress}"}`;
+  }
+  switch (type) {
+    case 'ama':
+      return `ama://set-api-key?server=${encodedServerAddress}&key=sk-${key}`;
+    case 'opencat':
+      return `opencat://team/join?domain=${encodedServerAddress}&token=sk-${key}`;
+    case 'next':
+      return nextUrl;
+    default:
+      return `sk-${key}`;
+  }
+};
+
 const EditToken = () => {
   const params = useParams();
   const tokenId = params.id;
@@ -19,6 +61,8 @@ const EditToken = () => {
     subnet: "",
   };
   const [inputs, setInputs] = useState(originInputs);
+  // the key of a new token is only returned once, when it's created
+  const [createdKey, setCreatedKey] = useState('');
   const { name, remain_quota, expired_time, unlimited_quota } = inputs;
   const navigate = useNavigate();
   const handleInputChange = (e, { name, value }) => {
@@ -42,6 +86,18 @@ const EditToken = () => {
     }
   };
 
+  const onCopy = async (type) => {
+    if (await copy(getKeyUrl(type, createdKey))) {
+      showSuccess('已复制到剪贴板！');
+    } else {
+      showWarning('无法复制到剪贴板，请手动复制。');
+    }
+  };
+
+  const onOpenLink = (type) => {
+    window.open(getKeyUrl(type === '' ? 'next' : type, createdKey), '_blank');
+  };
+
   const setUnlimitedQuota = () => {
     setInputs({ ...inputs, unlimited_quota: !unlimited_quota });
   };
@@ -107,12 +163,13 @@ const EditToken = () => {
     } else {
       res = await API.post(`/api/token/`, localInputs);
     }
-    const { success, message } = res.data;
+    const { success, message, data } = res.data;
     if (success) {
       if (isEdit) {
         showSuccess('令牌更新成功！');
       } else {
-        showSuccess('令牌创建成功，请在列表页面点击复制获取令牌！');
+        showSuccess('令牌创建成功！');
+        setCreatedKey(data.key);
         setInputs(originInputs);
       }
     } else {
@@ -124,6 +181,41 @@ const EditToken = () => {
     <>
       <Segment loading={loading}>
         <Header as='h3'>{isEdit ? '更新令牌信息' : '创建新的令牌'}</Header>
+        {createdKey && (
+          <Message positive>
+            <Message.Header>令牌已创建，密钥只显示这一次，请立即复制保存</Message.Header>
+            <p style={{ wordBreak: 'break-all' }}>{`sk-${createdKey}`}</p>
+            <Button.Group color='green' size={'small'}>
+              <Button size={'small'} positive onClick={() => onCopy('')}>
+                复制
+              </Button>
+              <Dropdown
+                className='button icon'
+                floating
+                options={COPY_OPTIONS.map(option => ({
+                  ...option,
+                  onClick: () => onCopy(option.value)
+                }))}
+                trigger={<></>}
+              />
+            </Button.Group>
+            {' '}
+            <Button.Group color='blue' size={'small'}>
+              <Button size={'small'} positive onClick={() => onOpenLink('')}>
+                聊天
+              </Button>
+              <Dropdown
+                className='button icon'
+                floating
+                options={OPEN_LINK_OPTIONS.map(option => ({
+                  ...option,
+                  onClick: () => onOpenLink(option.value)
+                }))}
+                trigger={<></>}
+              />
+            </Button.Group>
+          </Message>
+        )}
         <Form autoComplete='new-password'>
           <Form.Field>
             <Form.Input